@@ -0,0 +1,256 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// AddressParts are the components of a restaurant's address. They are split
+// out of the address, so they only change along with it, and the state is
+// the restaurant's state when the address doesn't name one. Only US
+// addresses are recognized, and Country is US for any address with a state
+// or ZIP code.
+type AddressParts struct {
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// postalCodePattern matches a ZIP code, with or without its four digit
+// extension
+var postalCodePattern = regexp.MustCompile(`^\d{5}(-\d{4})?$`)
+
+// stateNames maps the names of the states, DC and the territories to their
+// postal codes, by their lower-case names
+var stateNames = map[string]string{
+	"alabama": "AL", "alaska": "AK", "arizona": "AZ", "arkansas": "AR",
+	"california": "CA", "colorado": "CO", "connecticut": "CT", "delaware": "DE",
+	"florida": "FL", "georgia": "GA", "hawaii": "HI", "idaho": "ID",
+	"illinois": "IL", "indiana": "IN", "iowa": "IA", "kansas": "KS",
+	"kentucky": "KY", "louisiana": "LA", "maine": "ME", "maryland": "MD",
+	"massachusetts": "MA", "michigan": "MI", "minnesota": "MN", "mississippi": "MS",
+	"missouri": "MO", "montana": "MT", "nebraska": "NE", "nevada": "NV",
+	"new hampshire": "NH", "new jersey": "NJ", "new mexico": "NM", "new york": "NY",
+	"north carolina": "NC", "north dakota": "ND", "ohio": "OH", "oklahoma": "OK",
+	"oregon": "OR", "pennsylvania": "PA", "rhode island": "RI", "south carolina": "SC",
+	"south dakota": "SD", "tennessee": "TN", "texas": "TX", "utah": "UT",
+	"vermont": "VT", "virginia": "VA", "washington": "WA", "west virginia": "WV",
+	"wisconsin": "WI", "wyoming": "WY", "district of columbia": "DC",
+	"american samoa": "AS", "guam": "GU", "northern mariana islands": "MP",
+	"puerto rico": "PR", "virgin islands": "VI",
+}
+
+// countryNames are the ways an address can end in the United States
+var countryNames = map[string]bool{
+	"us": true, "usa": true, "united states": true, "united states of america": true,
+}
+
+// streetSuffixes, directionals and unitDesignators are the USPS standard
+// abbreviations of street address words, by their lower-case spellings
+var (
+	streetSuffixes = map[string]string{
+		"avenue": "Ave", "ave": "Ave", "av": "Ave",
+		"boulevard": "Blvd", "blvd": "Blvd",
+		"circle": "Cir", "cir": "Cir",
+		"court": "Ct", "ct": "Ct",
+		"drive": "Dr", "dr": "Dr",
+		"expressway": "Expy", "expy": "Expy",
+		"highway": "Hwy", "hwy": "Hwy",
+		"lane": "Ln", "ln": "Ln",
+		"parkway": "Pkwy", "pkwy": "Pkwy",
+		"place": "Pl", "pl": "Pl",
+		"plaza": "Plz", "plz": "Plz",
+		"road": "Rd", "rd": "Rd",
+		"square": "Sq", "sq": "Sq",
+		"street": "St", "st": "St", "str": "St",
+		"terrace": "Ter", "ter": "Ter",
+		"trail": "Trl", "trl": "Trl",
+	}
+	directionals = map[string]string{
+		"north": "N", "n": "N", "south": "S", "s": "S",
+		"east": "E", "e": "E", "west": "W", "w": "W",
+		"northeast": "NE", "ne": "NE", "northwest": "NW", "nw": "NW",
+		"southeast": "SE", "se": "SE", "southwest": "SW", "sw": "SW",
+	}
+	unitDesignators = map[string]string{
+		"apartment": "Apt", "apt": "Apt",
+		"building": "Bldg", "bldg": "Bldg",
+		"floor": "Fl", "fl": "Fl",
+		"room": "Rm", "rm": "Rm",
+		"suite": "Ste", "ste": "Ste",
+		"unit": "Unit",
+	}
+)
+
+// parseAddress splits an address such as "11 Madison Ave, New York, NY
+// 10010" into its parts. The ZIP code and state come off the end, after an
+// optional country, and whatever comes before them in the last part or the
+// part before that is the city. The rest is the street, with its street
+// type, directions and unit written the way the USPS abbreviates them.
+// What can't be told apart is left in the street.
+func parseAddress(address string) AddressParts {
+	var parts []string
+	for _, part := range strings.Split(address, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	var result AddressParts
+	if len(parts) > 1 && countryNames[strings.ToLower(strings.ReplaceAll(parts[len(parts)-1], ".", ""))] {
+		result.Country = "US"
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return result
+	}
+	split := len(parts) > 1
+
+	// The ZIP code ends the last part, or is a part of its own after the
+	// state
+	words := strings.Fields(parts[len(parts)-1])
+	if postalCodePattern.MatchString(words[len(words)-1]) {
+		result.PostalCode = words[len(words)-1]
+		words = words[:len(words)-1]
+		if len(words) == 0 && len(parts) > 1 {
+			parts = parts[:len(parts)-1]
+			words = strings.Fields(parts[len(parts)-1])
+		}
+	}
+
+	// Without a comma or a ZIP code to go by, a street type like Ct could
+	// be taken for a state. A state name on its own after the street is
+	// more likely a city, such as New York.
+	if split || result.PostalCode != "" {
+		for n := min(len(words), 4); n > 0; n-- {
+			name := strings.Join(words[len(words)-n:], " ")
+			state, ok := stateCode(name)
+			city := n == len(words) && len(name) > 2 && result.PostalCode == "" &&
+				len(parts) == 2 && startsWithNumber(parts[0])
+			if !ok || city {
+				continue
+			}
+			result.State = state
+			words = words[:len(words)-n]
+			break
+		}
+	}
+	if result.State != "" || result.PostalCode != "" {
+		result.Country = "US"
+	}
+	if len(words) == 0 {
+		parts = parts[:len(parts)-1]
+	} else {
+		parts[len(parts)-1] = strings.Join(words, " ")
+	}
+
+	// The city is the last part left, unless it is the street itself or a
+	// unit of it
+	if n := len(parts); n > 1 || n == 1 && split && !startsWithNumber(parts[0]) {
+		if _, unit := unitDesignators[strings.ToLower(strings.Fields(parts[n-1])[0])]; !unit {
+			result.City = parts[n-1]
+			parts = parts[:n-1]
+		}
+	}
+	for i, part := range parts {
+		parts[i] = normalizeStreet(part)
+	}
+	result.Street = strings.Join(parts, ", ")
+	return result
+}
+
+// stateCode returns the postal code of a state given by its code or its name
+func stateCode(name string) (string, bool) {
+	if code := strings.ToUpper(name); usStates[code] {
+		return code, true
+	}
+	code, ok := stateNames[strings.ToLower(name)]
+	return code, ok
+}
+
+// startsWithNumber reports whether text starts with a digit, as a street
+// address starts with its house number
+func startsWithNumber(text string) bool {
+	return text != "" && unicode.IsDigit(rune(text[0]))
+}
+
+// normalizeStreet abbreviates the words of one line of a street address the
+// way the USPS does. A direction is only abbreviated before or after the
+// street's name, and a street type only at the end of it, so that North Ave
+// and Avenue of the Americas keep their names.
+func normalizeStreet(street string) string {
+	words := strings.Fields(street)
+	keys := make([]string, len(words))
+	for i, word := range words {
+		keys[i] = strings.ToLower(strings.TrimSuffix(word, "."))
+	}
+
+	// The street's name ends at a unit, or at the end of the line
+	end := len(words)
+	for i, key := range keys {
+		if _, ok := unitDesignators[key]; ok {
+			end = i
+			break
+		}
+	}
+	for i := end; i < len(words); i++ {
+		if unit, ok := unitDesignators[keys[i]]; ok {
+			words[i] = unit
+		}
+	}
+
+	name := words[:end]
+	if len(name) > 0 && startsWithNumber(name[0]) {
+		name = name[1:]
+	}
+	offset := end - len(name)
+	abbreviate := func(i int, abbreviations map[string]string) {
+		if abbreviation, ok := abbreviations[keys[offset+i]]; ok {
+			words[offset+i] = abbreviation
+		}
+	}
+	last := len(name) - 1
+	if last > 0 {
+		if _, ok := directionals[keys[offset+last]]; ok {
+			if _, suffix := streetSuffixes[keys[offset+last-1]]; suffix || last > 1 {
+				abbreviate(last, directionals)
+				last--
+			}
+		}
+	}
+	if last > 0 {
+		abbreviate(last, streetSuffixes)
+	}
+	if last > 1 {
+		abbreviate(0, directionals)
+	}
+	return strings.Join(words, " ")
+}
+
+// String formats the parts back into one address, leaving out the country
+func (parts AddressParts) String() string {
+	var lines []string
+	for _, line := range []string{
+		parts.Street,
+		parts.City,
+		strings.TrimSpace(parts.State + " " + parts.PostalCode),
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, ", ")
+}
+
+// addressParts splits a restaurant's address, taking the state from the
+// restaurant when the address has none
+func addressParts(address, state string) AddressParts {
+	parts := parseAddress(address)
+	if parts.State == "" && state != "" {
+		parts.State = state
+		parts.Country = "US"
+	}
+	return parts
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddress(t *testing.T) {
+	for address, want := range map[string]AddressParts{
+		"11 Madison Ave, New York, NY 10010":                 {"11 Madison Ave", "New York", "NY", "10010", "US"},
+		"1723 North Halsted Street, Chicago, IL 60614-5504":  {"1723 N Halsted St", "Chicago", "IL", "60614-5504", "US"},
+		"6640 Washington St, Yountville, California, 94599":  {"6640 Washington St", "Yountville", "CA", "94599", "US"},
+		"155 W. 51st St., Suite 200, New York NY 10019, USA": {"155 W 51st St, Ste 200", "New York", "NY", "10019", "US"},
+		"178 Townsend St, San Francisco":                     {"178 Townsend St", "San Francisco", "", "", ""},
+		"Yountville, CA 94599":                               {"", "Yountville", "CA", "94599", "US"},
+		"Seattle, Washington":                                {"", "Seattle", "WA", "", "US"},
+		"1723 N Halsted St":                                  {"1723 N Halsted St", "", "", "", ""},
+		"953 W Fulton Market":                                {"953 W Fulton Market", "", "", "", ""},
+		"":                                                   {},
+
+		// A state name on its own after the street is the city
+		"11 Madison Ave, New York": {"11 Madison Ave", "New York", "", "", ""},
+		// Without a comma only a ZIP code gives the state away
+		"12 Oak Ct":                              {"12 Oak Ct", "", "", "", ""},
+		"6640 Washington St Yountville CA 94599": {"6640 Washington St Yountville", "", "CA", "94599", "US"},
+	} {
+		assert.Equal(t, want, parseAddress(address), address)
+	}
+}
+
+func TestNormalizeStreet(t *testing.T) {
+	for street, want := range map[string]string{
+		"1723 North Halsted Street":    "1723 N Halsted St",
+		"100 Main Street Northwest":    "100 Main St NW",
+		"1 North Avenue":               "1 North Ave",
+		"1 West North Avenue":          "1 W North Ave",
+		"1095 Avenue of the Americas":  "1095 Avenue of the Americas",
+		"2 Park Boulevard Apartment 3": "2 Park Blvd Apt 3",
+		"Suite 200":                    "Ste 200",
+		"Fulton Market":                "Fulton Market",
+	} {
+		assert.Equal(t, want, normalizeStreet(street), street)
+	}
+}
+
+func TestAddressPartsString(t *testing.T) {
+	parts := AddressParts{"11 Madison Ave", "New York", "NY", "10010", "US"}
+	assert.Equal(t, "11 Madison Ave, New York, NY 10010", parts.String())
+	assert.Equal(t, parts, parseAddress(parts.String()))
+	assert.Equal(t, "Chicago, IL", AddressParts{City: "Chicago", State: "IL"}.String())
+
+	// The restaurant's state fills in for an address without one
+	assert.Equal(t, AddressParts{"177 N Ada St", "Chicago", "IL", "", "US"}, addressParts("177 N Ada St, Chicago", "IL"))
+	assert.Equal(t, "NY", addressParts("11 Madison Ave, New York, NY", "IL").State)
+}
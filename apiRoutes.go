@@ -0,0 +1,2146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// server holds the dependencies that the route handlers share
+type server struct {
+	store    RestaurantStore
+	photos   PhotoStorage
+	geocoder Geocoder
+}
+
+// setupRouter builds the Gin engine with every route wired to handlers that
+// read and write restaurants through the given store. Uploaded photos are
+// kept in photos; when it is nil, uploads are turned away. The geocoder
+// places restaurants as they are written; when it is nil, they only have
+// the coordinates they are given.
+func setupRouter(store RestaurantStore, photos PhotoStorage, geocoder Geocoder) *gin.Engine {
+	s := &server{store: store, photos: photos, geocoder: geocoder}
+
+	// Load gin and HTML template support
+	router := gin.Default()
+	router.LoadHTMLGlob("templates/*.tmpl")
+	router.Use(formatOverride, requestID)
+
+	// Route for liveness checks
+	router.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	// Route to get all restaurants
+	router.GET("/api/v1/restaurants", s.GetRestaurantsHTML)
+
+	// Route to search restaurants by name, chef, address or info
+	router.GET("/api/v1/restaurants/search", s.SearchRestaurants)
+
+	// Route to find the restaurants within a radius of a point
+	router.GET("/api/v1/restaurants/nearby", s.GetNearbyRestaurants)
+
+	// Route to show the restaurants on a map, and the GeoJSON it plots
+	router.GET("/api/v1/restaurants/map", s.GetRestaurantsMap)
+	router.GET("/api/v1/restaurants.geojson", s.GetRestaurantsGeoJSON)
+
+	// Route to create restaurants in bulk from CSV or JSON Lines
+	router.POST("/api/v1/restaurants/import", s.ImportRestaurants)
+
+	// Route to download the restaurant catalog as CSV, JSON, JSONL or XLSX
+	router.GET("/api/v1/restaurants/export", s.ExportRestaurants)
+
+	// Route to subscribe to the opening hours of the listed restaurants
+	router.GET("/api/v1/restaurants/hours.ics", s.GetRestaurantsCalendar)
+
+	// Route to list the deleted restaurants that can still be restored
+	router.GET("/api/v1/restaurants/trash", s.GetTrash)
+
+	// Route to get a single restaurant page by ID
+	router.GET("/api/v1/restaurant/:id", s.GetRestaurantByIdHTML)
+
+	// Route to create a new restaurant
+	router.POST("/api/v1/restaurant/create", s.CreateRestaurantJSON)
+
+	// Route to update a restaurant by ID
+	router.PATCH("/api/v1/restaurant/update/:id", s.UpdateRestaurant)
+
+	// Route to move a restaurant to the trash by ID
+	router.DELETE("/api/v1/restaurant/delete/:id", s.DeleteRestaurant)
+
+	// Route to take a restaurant back out of the trash by ID
+	router.POST("/api/v1/restaurant/restore/:id", s.RestoreRestaurant)
+
+	// Route to subscribe to the opening hours of a restaurant by ID
+	router.GET("/api/v1/restaurant/:id/hours.ics", s.GetRestaurantCalendar)
+
+	// Route to list every change made to a restaurant by ID
+	router.GET("/api/v1/restaurant/:id/history", s.GetRestaurantHistory)
+
+	// Route to put a restaurant back the way one of its revisions left it
+	router.POST("/api/v1/restaurant/:id/revert/:revision", s.RevertRestaurant)
+
+	// Route to list the star ratings of a restaurant by year and guide
+	router.GET("/api/v1/restaurant/:id/ratings", s.GetRestaurantRatings)
+
+	// Route to record a year's star rating for a restaurant
+	router.POST("/api/v1/restaurant/:id/ratings", s.AddRestaurantRating)
+
+	// Route to list the current and past staff of a restaurant by role
+	router.GET("/api/v1/restaurant/:id/staff", s.GetRestaurantStaff)
+
+	// Route to add a person to the staff of a restaurant
+	router.POST("/api/v1/restaurant/:id/staff", s.AddRestaurantStaff)
+
+	// Route to move a staff member to another role or restaurant
+	router.POST("/api/v1/restaurant/:id/staff/:staff_id/move", s.MoveRestaurantStaff)
+
+	// Route to record that a staff member has left
+	router.POST("/api/v1/restaurant/:id/staff/:staff_id/retire", s.RetireRestaurantStaff)
+
+	// Route to list the current and archived menus of a restaurant
+	router.GET("/api/v1/restaurant/:id/menus", s.GetRestaurantMenus)
+
+	// Route to add a menu, or a new version of one, to a restaurant
+	router.POST("/api/v1/restaurant/:id/menus", s.AddRestaurantMenu)
+
+	// Route to get a single menu of a restaurant
+	router.GET("/api/v1/restaurant/:id/menus/:menu_id", s.GetRestaurantMenu)
+
+	// Route to update a menu of a restaurant
+	router.PATCH("/api/v1/restaurant/:id/menus/:menu_id", s.UpdateRestaurantMenu)
+
+	// Route to move a current menu to the archive
+	router.POST("/api/v1/restaurant/:id/menus/:menu_id/archive", s.ArchiveRestaurantMenu)
+
+	// Route to delete a menu of a restaurant
+	router.DELETE("/api/v1/restaurant/:id/menus/:menu_id", s.DeleteRestaurantMenu)
+
+	// Route to get the photo gallery of a restaurant
+	router.GET("/api/v1/restaurant/:id/photos", s.GetRestaurantPhotos)
+
+	// Route to upload photos of a restaurant
+	router.POST("/api/v1/restaurant/:id/photos", s.AddRestaurantPhotos)
+
+	// Route to serve an uploaded photo or one of its variants
+	router.GET("/api/v1/photos/*key", s.GetPhoto)
+
+	// Route to get all chefs
+	router.GET("/api/v1/chefs", s.GetChefs)
+
+	// Route to get a single chef page by ID
+	router.GET("/api/v1/chef/:id", s.GetChef)
+
+	// Route to create a new chef
+	router.POST("/api/v1/chef/create", s.CreateChef)
+
+	// Route to update a chef by ID
+	router.PATCH("/api/v1/chef/update/:id", s.UpdateChef)
+
+	// Route to delete a chef and their links by ID
+	router.DELETE("/api/v1/chef/delete/:id", s.DeleteChef)
+
+	// Route to give a chef a role at a restaurant
+	router.POST("/api/v1/chef/:id/restaurants", s.LinkChef)
+
+	// Route to take a role at a restaurant away from a chef
+	router.DELETE("/api/v1/chef/:id/restaurants/:restaurant_id", s.UnlinkChef)
+
+	return router
+}
+
+// offeredFormats lists the response formats every route can negotiate, in
+// order of preference. HTML comes first so HTMX requests, which send no
+// specific Accept header, keep getting template fragments.
+var offeredFormats = []string{gin.MIMEHTML, gin.MIMEJSON}
+
+// formatOverride lets clients pick a response format with ?format=json or
+// ?format=html instead of sending an Accept header
+func formatOverride(c *gin.Context) {
+	switch strings.ToLower(c.Query("format")) {
+	case "json":
+		c.SetAccepted(gin.MIMEJSON)
+	case "html":
+		c.SetAccepted(gin.MIMEHTML)
+	}
+	c.Next()
+}
+
+// restaurantID parses the :id path parameter. It responds with 404 and
+// returns false when the parameter isn't a number.
+func restaurantID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// restaurantPage is the JSON document for one page of the restaurant list
+type restaurantPage struct {
+	Restaurants []Restaurant `json:"restaurants"`
+	Total       int          `json:"total"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+	Previous    string       `json:"previous,omitempty"`
+	Next        string       `json:"next,omitempty"`
+}
+
+// GetRestaurantsHTML returns a page of restaurants, filtered and sorted by
+// the query string
+func (s *server) GetRestaurantsHTML(c *gin.Context) {
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	restaurants, total, err := s.store.List(c.Request.Context(), opts)
+	if err != nil {
+		log.Println("Error retrieving restaurants:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if notModified(c, listETag(c.NegotiateFormat(offeredFormats...), restaurants, total)) {
+		return
+	}
+	previous, next := pageLinks(c.Request.URL, opts, total)
+
+	// Render HTML using the built-in HTML rendering, or the page of
+	// restaurant documents when JSON is requested
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/restaurants.tmpl",
+		HTMLData: gin.H{
+			"title":       "Restaurants List",
+			"restaurants": restaurants,
+			"previous":    previous,
+			"next":        next,
+		},
+		JSONData: restaurantPage{
+			Restaurants: restaurants,
+			Total:       total,
+			Limit:       opts.Limit,
+			Offset:      opts.Offset,
+			Previous:    previous,
+			Next:        next,
+		},
+	})
+}
+
+// SearchRestaurants returns the restaurants that match the words of the ?q=
+// query, best matches first. The HTML response is the rows of the restaurant
+// table, so the search box on the list page can swap them in as you type; an
+// empty query brings back the first page of the list.
+func (s *server) SearchRestaurants(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+
+	limit := defaultSearchLimit
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be a number from 1 to %d", maxPageSize)})
+			return
+		}
+	}
+
+	var results []SearchResult
+	if query == "" {
+		restaurants, _, err := s.store.List(c.Request.Context(), ListOptions{Limit: defaultPageSize})
+		if err != nil {
+			log.Println("Error retrieving restaurants:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		results = make([]SearchResult, len(restaurants))
+		for i, restaurant := range restaurants {
+			results[i] = SearchResult{Restaurant: restaurant, Highlights: map[string]template.HTML{}}
+		}
+	} else {
+		var err error
+		results, err = s.store.Search(c.Request.Context(), query, limit)
+		if err != nil {
+			log.Println("Error searching restaurants:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/search.tmpl",
+		HTMLData: gin.H{
+			"results": results,
+		},
+		JSONData: gin.H{
+			"query":   query,
+			"results": results,
+		},
+	})
+}
+
+// GetNearbyRestaurants returns the restaurants within ?radius= meters of the
+// point at ?lat= and ?lng=, nearest first, with the distance to each. The
+// HTML response is the rows of the restaurant table, like a search.
+func (s *server) GetNearbyRestaurants(c *gin.Context) {
+	opts, err := parseNearbyOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := s.store.Nearby(c.Request.Context(), opts)
+	if err != nil {
+		log.Println("Error finding nearby restaurants:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/search.tmpl",
+		HTMLData: gin.H{
+			"results": results,
+		},
+		JSONData: gin.H{
+			"latitude":  opts.Latitude,
+			"longitude": opts.Longitude,
+			"radius":    opts.Radius,
+			"results":   results,
+		},
+	})
+}
+
+// GetRestaurantsMap returns the map of the restaurants. The page plots the
+// GeoJSON of the restaurants that its query string's list filters select,
+// so the filters are checked here first.
+func (s *server) GetRestaurantsMap(c *gin.Context) {
+	if _, err := parseListOptions(c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	geojson := "/api/v1/restaurants.geojson"
+	if c.Request.URL.RawQuery != "" {
+		geojson += "?" + c.Request.URL.RawQuery
+	}
+	c.HTML(http.StatusOK, "templates/map.tmpl", gin.H{
+		"title":   "Restaurant Map",
+		"geojson": geojson,
+	})
+}
+
+// GetRestaurantsGeoJSON returns every restaurant that the list filters
+// select and that has coordinates, across all pages, as GeoJSON
+func (s *server) GetRestaurantsGeoJSON(c *gin.Context) {
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var restaurants []Restaurant
+	err = eachRestaurant(c.Request.Context(), s.store, opts, func(restaurant Restaurant) error {
+		restaurants = append(restaurants, restaurant)
+		return nil
+	})
+	if err != nil {
+		log.Println("Error retrieving restaurants:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if notModified(c, listETag("geojson", restaurants, len(restaurants))) {
+		return
+	}
+
+	document, err := json.Marshal(restaurantFeatures(restaurants))
+	if err != nil {
+		log.Println("Error encoding GeoJSON:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	c.Data(http.StatusOK, mimeGeoJSON, document)
+}
+
+// maxImportBytes caps the size of a bulk import upload
+const maxImportBytes = 32 << 20
+
+// ImportRestaurants creates restaurants in bulk from a CSV or JSON Lines
+// body, or from a file uploaded as the "file" field of a multipart form.
+// Every row is validated and nothing is created unless all of them pass;
+// ?dry_run=true only validates. The response is the ImportReport, with 422
+// when any row is invalid.
+func (s *server) ImportRestaurants(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	var body io.Reader = c.Request.Body
+	var format string
+	var err error
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		file, header, fileErr := c.Request.FormFile("file")
+		if fileErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "multipart imports need a file field"})
+			return
+		}
+		defer file.Close()
+		body = file
+		format, err = importFormatFromFilename(header.Filename)
+	} else {
+		format, err = importFormatFromContentType(c.ContentType())
+	}
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := parseImport(body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := importRestaurants(c.Request.Context(), s.store, s.geocoder, rows, dryRun)
+	if err != nil {
+		log.Println("Error importing restaurants:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	for _, restaurant := range report.restaurants {
+		s.recordHistory(c, actionImport, Restaurant{}, restaurant)
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		c.JSON(http.StatusUnprocessableEntity, report)
+	case report.Imported > 0:
+		c.JSON(http.StatusCreated, report)
+	default:
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ExportRestaurants streams every restaurant that matches the list filters
+// as a file download in the ?format= given, which defaults to CSV. The sort
+// order of the list applies too, but the export isn't paged.
+func (s *server) ExportRestaurants(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", formatCSV))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of csv, json, jsonl or xlsx"})
+		return
+	}
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="restaurants.%s"`, format))
+	c.Status(http.StatusOK)
+
+	// The status is already sent once the first byte is written, so a
+	// failure part way through can only be logged and the download cut off
+	writer, err := newExportWriter(c.Writer, format)
+	if err == nil {
+		err = eachRestaurant(c.Request.Context(), s.store, opts, func(restaurant Restaurant) error {
+			return writer.Write(restaurant)
+		})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Println("Error exporting restaurants:", err)
+		c.Abort()
+	}
+}
+
+// GetRestaurantByIdHTML returns info about a single restaurant
+func (s *server) GetRestaurantByIdHTML(c *gin.Context) {
+	// Input parameters from URI
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	// Validate that the restaurant with this ID exists in the database
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+	case err == nil:
+		// The HTML page says whether the restaurant is open now and which
+		// closures are still to come, which changes without the restaurant
+		// changing, so only the JSON document carries a tag to revalidate
+		if format := c.NegotiateFormat(offeredFormats...); format != gin.MIMEJSON {
+			c.Header("Vary", "Accept")
+		} else if notModified(c, restaurantETag(format, restaurant)) {
+			return
+		}
+		menus, err := s.store.Menus(c.Request.Context(), id)
+		if err != nil {
+			log.Println("Error retrieving menus:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+
+		// Render HTML using the built-in HTML rendering, or the full
+		// restaurant document when JSON is requested
+		c.Negotiate(http.StatusOK, gin.Negotiate{
+			Offered:  offeredFormats,
+			HTMLName: "templates/restaurant.tmpl",
+			HTMLData: restaurantPageData(restaurant, menus),
+			JSONData: restaurant,
+		})
+	default:
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+	}
+}
+
+// restaurantPageData is what the restaurant page template renders. The
+// schedule comes with whether the restaurant is open right now and the
+// exceptions still to come, and the menus are the current ones.
+func restaurantPageData(restaurant Restaurant, menus []Menu) gin.H {
+	now := time.Now()
+	return gin.H{
+		"ID":         restaurant.ID,
+		"Name":       restaurant.Name,
+		"Stars":      restaurant.Stars,
+		"Address":    restaurant.Address,
+		"State":      restaurant.State,
+		"Hours":      restaurant.Hours,
+		"Schedule":   restaurant.Schedule,
+		"OpenNow":    restaurant.Schedule.OpenAt(now),
+		"Exceptions": restaurant.Schedule.upcoming(now),
+		"Website":    restaurant.Website,
+		"Chef":       restaurant.Chef,
+		"Chefs":      restaurant.Chefs,
+		"HeadChefID": restaurant.HeadChefID(),
+		"Info":       restaurant.Info,
+		"Staff":      restaurant.Staff,
+		"Photos":     photoGallery(restaurant.Photos),
+		"Menus":      currentMenus(menus),
+	}
+}
+
+// CreateRestaurantJSON creates a new restaurant from a JSON, urlencoded or
+// multipart body. A restaurant that fails validation gets a 422 listing what
+// is wrong with each field.
+func (s *server) CreateRestaurantJSON(c *gin.Context) {
+	restaurant := Restaurant{Staff: []string{}, Photos: []string{}, Menus: []string{}}
+	errs, ok := bindRestaurantBody(c, &restaurant)
+	if !ok {
+		return
+	}
+	normalizeRestaurant(&restaurant)
+	if errs = append(errs, validateRestaurant(restaurant)...); len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+	if err := geocodeRestaurant(c.Request.Context(), s.geocoder, Restaurant{}, &restaurant); err != nil {
+		log.Println("Error geocoding address:", err)
+	}
+
+	restaurant, err := s.store.Create(c.Request.Context(), restaurant)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordHistory(c, actionCreate, Restaurant{}, restaurant)
+
+	// Return the full document of the restaurant that was just created
+	c.Header("ETag", restaurantETag(gin.MIMEJSON, restaurant))
+	c.JSON(http.StatusCreated, restaurant)
+}
+
+// UpdateRestaurant updates an existing restaurant by ID. The body is either
+// a JSON Merge Patch, a JSON Patch, or a JSON or form body of the fields to
+// replace; either way only what the body mentions changes, and the result
+// has to pass validation.
+func (s *server) UpdateRestaurant(c *gin.Context) {
+	c.Header("Accept-Patch", mimeMergePatch+", "+mimeJSONPatch)
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	// Check if the restaurant with the given ID exists
+	existingRestaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error querying existing restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if !ifMatch(c, existingRestaurant) {
+		return
+	}
+
+	// Update the existing restaurant with the new data. Decoding can reuse
+	// the backing arrays of the collections, so the history gets a copy.
+	before := copyRestaurant(existingRestaurant)
+	errs, ok := bindRestaurantBody(c, &existingRestaurant)
+	if !ok {
+		return
+	}
+	normalizeRestaurant(&existingRestaurant)
+	errs = append(errs, validateRestaurant(existingRestaurant)...)
+
+	// A restaurant with ratings takes its stars from the current one, so
+	// they can only change by recording a rating
+	if existingRestaurant.Stars != before.Stars {
+		ratings, err := s.store.Ratings(c.Request.Context(), id)
+		if err != nil {
+			log.Println("Error retrieving ratings:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		if len(ratings) > 0 {
+			errs = append(errs, FieldError{"stars", fmt.Sprintf("follows the ratings, record one at /api/v1/restaurant/%d/ratings", id)})
+		}
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+	if err := geocodeRestaurant(c.Request.Context(), s.geocoder, before, &existingRestaurant); err != nil {
+		log.Println("Error geocoding address:", err)
+	}
+
+	// The store only writes over the version read above, so an edit that
+	// lands in between is reported rather than lost
+	updatedRestaurant, err := s.store.Update(c.Request.Context(), existingRestaurant)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if errors.Is(err, ErrStaleVersion) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Restaurant has changed, fetch it again before saving"})
+		return
+	}
+	if err != nil {
+		log.Println("Error updating restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	s.recordHistory(c, actionUpdate, before, updatedRestaurant)
+
+	// Return the updated restaurant
+	c.Header("ETag", restaurantETag(gin.MIMEJSON, updatedRestaurant))
+	c.JSON(http.StatusOK, updatedRestaurant)
+}
+
+// bindRestaurantBody decodes the request body into restaurant and returns the
+// field errors found along the way. It responds and returns false when the
+// body can't be decoded at all.
+func bindRestaurantBody(c *gin.Context, restaurant *Restaurant) ([]FieldError, bool) {
+	errs, err := bindRestaurant(c, restaurant)
+	var patchErr *patchError
+	switch {
+	case errors.Is(err, errUnsupportedBody):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return nil, false
+	case errors.Is(err, errPatchTestFailed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return nil, false
+	case errors.As(err, &patchErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return errs, true
+}
+
+// DeleteRestaurant moves a restaurant to the trash by ID. It stays there,
+// hidden from the list, until it is restored or the purger removes it.
+func (s *server) DeleteRestaurant(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	log.Println("deleting id:", id)
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if !ifMatch(c, restaurant) {
+		return
+	}
+
+	// JSON clients get back what was deleted, with the time it was deleted.
+	// The store only deletes the version read above, so an edit that lands
+	// in between is reported rather than thrown away.
+	before := restaurant
+	restaurant, err = s.store.Delete(c.Request.Context(), id, restaurant.Version)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if errors.Is(err, ErrStaleVersion) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Restaurant has changed, fetch it again before saving"})
+		return
+	}
+	if err != nil {
+		log.Println("Error deleting restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordHistory(c, actionDelete, before, restaurant)
+
+	deletedText := "Deleted"
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/deleted.tmpl",
+		HTMLData: gin.H{
+			"deletedText": deletedText,
+			"ID":          restaurant.ID,
+			"Name":        restaurant.Name,
+		},
+		JSONData: restaurant,
+	})
+}
+
+// RestoreRestaurant takes a restaurant back out of the trash by ID. The HTML
+// response is the restaurant's row of the list table, which the Undo button
+// swaps back in for the deleted notice.
+func (s *server) RestoreRestaurant(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	restaurant, err := s.store.Restore(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found in the trash"})
+		return
+	}
+	if err != nil {
+		log.Println("Error restoring restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordHistory(c, actionRestore, s.lastRevision(c, restaurant), restaurant)
+
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), restaurant))
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "restaurant-row",
+		HTMLData: restaurant,
+		JSONData: restaurant,
+	})
+}
+
+// GetTrash returns a page of the restaurants in the trash, most recently
+// deleted first unless the query asks for another order. The list filters
+// apply here too.
+func (s *server) GetTrash(c *gin.Context) {
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts.Deleted = true
+	if opts.Sort == "" {
+		opts.Sort = "-deleted"
+	}
+
+	restaurants, total, err := s.store.List(c.Request.Context(), opts)
+	if err != nil {
+		log.Println("Error retrieving trash:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	previous, next := pageLinks(c.Request.URL, opts, total)
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/trash.tmpl",
+		HTMLData: gin.H{
+			"title":       "Trash",
+			"restaurants": restaurants,
+			"previous":    previous,
+			"next":        next,
+		},
+		JSONData: restaurantPage{
+			Restaurants: restaurants,
+			Total:       total,
+			Limit:       opts.Limit,
+			Offset:      opts.Offset,
+			Previous:    previous,
+			Next:        next,
+		},
+	})
+}
+
+// GetRestaurantHistory returns every change made to a restaurant, newest
+// first. The HTML response is the history tab of the restaurant page, with a
+// button to revert to each revision.
+func (s *server) GetRestaurantHistory(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	history, err := s.store.History(c.Request.Context(), id)
+	if err != nil {
+		log.Println("Error retrieving history:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	// Restaurants from before history was kept have none, which is only
+	// worth a 404 when the restaurant doesn't exist either
+	if len(history) == 0 {
+		if _, err := s.store.Get(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+			return
+		}
+	}
+
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/history.tmpl",
+		HTMLData: gin.H{
+			"ID":      id,
+			"history": history,
+		},
+		JSONData: gin.H{
+			"restaurant_id": id,
+			"history":       history,
+		},
+	})
+}
+
+// RevertRestaurant puts every field of a restaurant back to how the given
+// revision of its history left it. The revert is itself an update, so it
+// honours If-Match, has to pass validation and is added to the history.
+func (s *server) RevertRestaurant(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	current, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if !ifMatch(c, current) {
+		return
+	}
+
+	history, err := s.store.History(c.Request.Context(), id)
+	if err != nil {
+		log.Println("Error retrieving history:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	var reverted *Restaurant
+	for _, entry := range history {
+		if entry.Revision == revision {
+			reverted = &entry.Restaurant
+			break
+		}
+	}
+	if reverted == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	restaurant := *reverted
+	restaurant.ID, restaurant.Version, restaurant.DeletedAt = current.ID, current.Version, nil
+	normalizeRestaurant(&restaurant)
+	if errs := validateRestaurant(restaurant); len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	updated, err := s.store.Update(c.Request.Context(), restaurant)
+	if errors.Is(err, ErrStaleVersion) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Restaurant has changed, fetch it again before saving"})
+		return
+	}
+	if err != nil {
+		log.Println("Error reverting restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordHistory(c, actionRevert, current, updated)
+	menus, err := s.store.Menus(c.Request.Context(), updated.ID)
+	if err != nil {
+		log.Println("Error retrieving menus:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), updated))
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/restaurant.tmpl",
+		HTMLData: restaurantPageData(updated, menus),
+		JSONData: updated,
+	})
+}
+
+// GetRestaurantRatings returns the timeline of a restaurant's star ratings,
+// oldest first, with each rating's change from the same guide's previous
+// one. The HTML response is the ratings tab of the restaurant page.
+func (s *server) GetRestaurantRatings(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.respondRatings(c, http.StatusOK, restaurant)
+}
+
+// AddRestaurantRating records the stars a guide gave a restaurant for a
+// year, from JSON or a form, replacing that guide's rating for the year if it
+// already has one. When the rating is the restaurant's current one its stars
+// change too, which is added to the history.
+func (s *server) AddRestaurantRating(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var rating Rating
+	var errs []FieldError
+	if err := c.ShouldBind(&rating); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		errs = fieldErrors("rating", err)
+	}
+	normalizeRating(&rating)
+	if len(errs) == 0 {
+		errs = validateRating(rating, time.Now())
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	before, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	restaurant, err := s.store.AddRating(c.Request.Context(), id, rating)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error recording rating:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if restaurant.Stars != before.Stars {
+		s.recordHistory(c, actionRate, before, restaurant)
+	}
+
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), restaurant))
+	s.respondRatings(c, http.StatusCreated, restaurant)
+}
+
+// respondRatings sends the rating timeline of a restaurant
+func (s *server) respondRatings(c *gin.Context, status int, restaurant Restaurant) {
+	ratings, err := s.store.Ratings(c.Request.Context(), restaurant.ID)
+	if err != nil {
+		log.Println("Error retrieving ratings:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	timeline := ratingTimeline(ratings)
+
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/ratings.tmpl",
+		HTMLData: gin.H{
+			"ID":      restaurant.ID,
+			"Stars":   restaurant.Stars,
+			"ratings": timeline,
+			"year":    time.Now().Year(),
+		},
+		JSONData: gin.H{
+			"restaurant_id": restaurant.ID,
+			"stars":         restaurant.Stars,
+			"ratings":       timeline,
+		},
+	})
+}
+
+// GetRestaurantCalendar returns the opening hours and closures of a
+// restaurant as an iCalendar feed that calendar apps can subscribe to. A
+// restaurant without a schedule gets an empty calendar, which fills in once
+// its hours are added.
+func (s *server) GetRestaurantCalendar(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	calendar := restaurantCalendar(restaurant.Name+" hours", []Restaurant{restaurant}, time.Now())
+	c.Data(http.StatusOK, mimeCalendar, calendar)
+}
+
+// GetRestaurantsCalendar returns one iCalendar feed with the hours of every
+// restaurant that the list filters select, across all pages
+func (s *server) GetRestaurantsCalendar(c *gin.Context) {
+	opts, err := parseListOptions(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var restaurants []Restaurant
+	err = eachRestaurant(c.Request.Context(), s.store, opts, func(restaurant Restaurant) error {
+		restaurants = append(restaurants, restaurant)
+		return nil
+	})
+	if err != nil {
+		log.Println("Error retrieving restaurants:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+
+	calendar := restaurantCalendar("Restaurant hours", restaurants, time.Now())
+	c.Data(http.StatusOK, mimeCalendar, calendar)
+}
+
+// chefID parses the :id path parameter of the chef routes. It responds with
+// 404 and returns false when the parameter isn't a number.
+func chefID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindChef decodes a chef from a JSON, urlencoded or multipart body on top
+// of the chef given, so updates only need to send what changes. It responds
+// and returns false when the body can't be read or the chef isn't valid.
+func bindChef(c *gin.Context, chef *Chef) bool {
+	id, restaurants := chef.ID, chef.Restaurants
+	err := c.ShouldBind(chef)
+	chef.ID, chef.Restaurants = id, restaurants
+	if err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		respondInvalid(c, fieldErrors("chef", err))
+		return false
+	}
+	normalizeChef(chef)
+	if chef.Name == "" {
+		respondInvalid(c, []FieldError{{"name", "is required"}})
+		return false
+	}
+	return true
+}
+
+// respondChef sends a chef page, or the chef document when JSON is requested
+func respondChef(c *gin.Context, status int, chef Chef) {
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/chef.tmpl",
+		HTMLData: chef,
+		JSONData: chef,
+	})
+}
+
+// GetChefs lists every chef by name with the restaurants they are linked to
+func (s *server) GetChefs(c *gin.Context) {
+	chefs, err := s.store.Chefs(c.Request.Context())
+	if err != nil {
+		log.Println("Error retrieving chefs:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/chefs.tmpl",
+		HTMLData: gin.H{"chefs": chefs},
+		JSONData: chefs,
+	})
+}
+
+// GetChef returns a chef page by ID, with their roles at restaurants
+func (s *server) GetChef(c *gin.Context) {
+	id, ok := chefID(c)
+	if !ok {
+		return
+	}
+
+	chef, err := s.store.GetChef(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, ErrChefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+	case err == nil:
+		respondChef(c, http.StatusOK, chef)
+	default:
+		log.Println("Error retrieving chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+	}
+}
+
+// CreateChef creates a new chef from a JSON, urlencoded or multipart body
+func (s *server) CreateChef(c *gin.Context) {
+	var chef Chef
+	if !bindChef(c, &chef) {
+		return
+	}
+
+	chef, err := s.store.CreateChef(c.Request.Context(), chef)
+	if err != nil {
+		log.Println("Error creating chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	respondChef(c, http.StatusCreated, chef)
+}
+
+// UpdateChef changes the name, bio or photo of a chef by ID. Fields the body
+// doesn't mention keep their values.
+func (s *server) UpdateChef(c *gin.Context) {
+	id, ok := chefID(c)
+	if !ok {
+		return
+	}
+
+	chef, err := s.store.GetChef(c.Request.Context(), id)
+	if errors.Is(err, ErrChefNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if !bindChef(c, &chef) {
+		return
+	}
+	before, ok := s.chefRestaurants(c, linkedRestaurantIDs(chef)...)
+	if !ok {
+		return
+	}
+
+	chef, err = s.store.UpdateChef(c.Request.Context(), chef)
+	if errors.Is(err, ErrChefNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error updating chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordChefChanges(c, before)
+	respondChef(c, http.StatusOK, chef)
+}
+
+// DeleteChef deletes a chef and their links by ID. The restaurants keep the
+// chef's name in their Chef field. JSON clients get back the deleted chef;
+// the HTML response is the list of the chefs that are left.
+func (s *server) DeleteChef(c *gin.Context) {
+	id, ok := chefID(c)
+	if !ok {
+		return
+	}
+
+	chef, err := s.store.GetChef(c.Request.Context(), id)
+	var before []Restaurant
+	if err == nil {
+		var ok bool
+		if before, ok = s.chefRestaurants(c, linkedRestaurantIDs(chef)...); !ok {
+			return
+		}
+		err = s.store.DeleteChef(c.Request.Context(), id)
+	}
+	if errors.Is(err, ErrChefNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error deleting chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordChefChanges(c, before)
+
+	chefs, err := s.store.Chefs(c.Request.Context())
+	if err != nil {
+		log.Println("Error retrieving chefs:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	c.Negotiate(http.StatusOK, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/chefs.tmpl",
+		HTMLData: gin.H{"chefs": chefs},
+		JSONData: chef,
+	})
+}
+
+// LinkChef gives a chef a role at a restaurant, from a body with the
+// restaurant_id, role, start and end. Linking a role the chef already has
+// there replaces its dates. The response is the chef with every link.
+func (s *server) LinkChef(c *gin.Context) {
+	id, ok := chefID(c)
+	if !ok {
+		return
+	}
+
+	var link ChefLink
+	var errs []FieldError
+	if err := c.ShouldBind(&link); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		errs = fieldErrors("link", err)
+	}
+	link.ChefID = id
+	normalizeChefLink(&link)
+	if len(errs) == 0 {
+		errs = validateChefLink(link)
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	before, ok := s.chefRestaurants(c, link.RestaurantID)
+	if !ok {
+		return
+	}
+	_, err := s.store.LinkChef(c.Request.Context(), link)
+	switch {
+	case errors.Is(err, ErrChefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	case err != nil:
+		log.Println("Error linking chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordChefChanges(c, before)
+	s.respondChefByID(c, http.StatusCreated, id)
+}
+
+// UnlinkChef takes a role at a restaurant away from a chef. The role comes
+// from ?role= and defaults to head chef. The response is the chef with the
+// links that are left.
+func (s *server) UnlinkChef(c *gin.Context) {
+	id, ok := chefID(c)
+	if !ok {
+		return
+	}
+	restaurantID, err := strconv.Atoi(c.Param("restaurant_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+
+	link := ChefLink{ChefID: id, RestaurantID: restaurantID, Role: c.Query("role")}
+	normalizeChefLink(&link)
+	before, ok := s.chefRestaurants(c, link.RestaurantID)
+	if !ok {
+		return
+	}
+	err = s.store.UnlinkChef(c.Request.Context(), link.ChefID, link.RestaurantID, link.Role)
+	if errors.Is(err, ErrChefLinkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error unlinking chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.recordChefChanges(c, before)
+	s.respondChefByID(c, http.StatusOK, id)
+}
+
+// respondChefByID reads a chef back from the store and sends it
+func (s *server) respondChefByID(c *gin.Context, status int, id int) {
+	chef, err := s.store.GetChef(c.Request.Context(), id)
+	if errors.Is(err, ErrChefNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chef not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving chef:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	respondChef(c, status, chef)
+}
+
+// GetRestaurantStaff returns the roster of a restaurant: for each role, who
+// holds it now and who held it before
+func (s *server) GetRestaurantStaff(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	s.respondRoster(c, http.StatusOK, restaurant)
+}
+
+// AddRestaurantStaff adds a person to the staff of a restaurant from JSON or
+// a form with their name, role and dates. Giving an end date records
+// someone who has already left.
+func (s *server) AddRestaurantStaff(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var member StaffMember
+	var errs []FieldError
+	if err := c.ShouldBind(&member); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		errs = fieldErrors("member", err)
+	}
+	normalizeStaffMember(&member)
+	if len(errs) == 0 {
+		errs = validateStaffMember(member)
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	member.ID, member.RestaurantID = 0, id
+	if _, err := s.store.AddStaff(c.Request.Context(), member); err != nil {
+		s.respondStaffError(c, "Error adding staff:", err)
+		return
+	}
+	restaurant, ok := s.recordChange(c, actionStaff, before)
+	if !ok {
+		return
+	}
+	s.respondRoster(c, http.StatusCreated, restaurant)
+}
+
+// MoveRestaurantStaff moves a current staff member to another role or
+// restaurant. Their stint ends on the move's date, today by default, and the
+// next one starts the same day.
+func (s *server) MoveRestaurantStaff(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var move StaffMove
+	if err := c.ShouldBind(&move); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondInvalid(c, fieldErrors("move", err))
+		return
+	}
+	move.Role = strings.Join(strings.Fields(move.Role), " ")
+	move.Date = strings.TrimSpace(move.Date)
+	if move.Date == "" {
+		move.Date = time.Now().Format(time.DateOnly)
+	}
+
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	member, ok := s.currentStaffMember(c, id)
+	if !ok {
+		return
+	}
+	errs := validateStaffDate(member, move.Date, time.Now())
+	if (move.RestaurantID == 0 || move.RestaurantID == id) && (move.Role == "" || move.Role == member.Role) {
+		errs = append(errs, FieldError{"role", "must change unless the restaurant does"})
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	var destination Restaurant
+	if move.RestaurantID != 0 && move.RestaurantID != id {
+		if destination, ok = s.changingRestaurant(c, move.RestaurantID); !ok {
+			return
+		}
+	}
+	if _, err := s.store.MoveStaff(c.Request.Context(), member.ID, move); err != nil {
+		s.respondStaffError(c, "Error moving staff:", err)
+		return
+	}
+	if destination.ID != 0 {
+		if _, ok := s.recordChange(c, actionStaff, destination); !ok {
+			return
+		}
+	}
+	restaurant, ok := s.recordChange(c, actionStaff, before)
+	if !ok {
+		return
+	}
+	s.respondRoster(c, http.StatusCreated, restaurant)
+}
+
+// RetireRestaurantStaff records that a current staff member left a
+// restaurant on a date, today by default. They stay on the roster among the
+// past holders of their role.
+func (s *server) RetireRestaurantStaff(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var retirement StaffRetirement
+	if err := c.ShouldBind(&retirement); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondInvalid(c, fieldErrors("retirement", err))
+		return
+	}
+	retirement.Date = strings.TrimSpace(retirement.Date)
+	if retirement.Date == "" {
+		retirement.Date = time.Now().Format(time.DateOnly)
+	}
+
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	member, ok := s.currentStaffMember(c, id)
+	if !ok {
+		return
+	}
+	if errs := validateStaffDate(member, retirement.Date, time.Now()); len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	if _, err := s.store.RetireStaff(c.Request.Context(), member.ID, retirement.Date); err != nil {
+		s.respondStaffError(c, "Error retiring staff:", err)
+		return
+	}
+	restaurant, ok := s.recordChange(c, actionStaff, before)
+	if !ok {
+		return
+	}
+	s.respondRoster(c, http.StatusOK, restaurant)
+}
+
+// changingRestaurant reads a restaurant whose staff or menus are about to
+// change, so the change can be recorded against it. It responds and returns
+// false when the restaurant can't be read.
+func (s *server) changingRestaurant(c *gin.Context, id int) (Restaurant, bool) {
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return Restaurant{}, false
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return Restaurant{}, false
+	}
+	return restaurant, true
+}
+
+// currentStaffMember finds the current stint named by the :staff_id path
+// parameter on a restaurant's roster. It responds with 404 and returns false
+// when there is no such stint.
+func (s *server) currentStaffMember(c *gin.Context, restaurantID int) (StaffMember, bool) {
+	staffID, err := strconv.Atoi(c.Param("staff_id"))
+	if err == nil {
+		members, err := s.store.Roster(c.Request.Context(), restaurantID)
+		if err != nil {
+			log.Println("Error retrieving staff:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return StaffMember{}, false
+		}
+		for _, member := range members {
+			if member.ID == staffID && member.Current() {
+				return member, true
+			}
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+	return StaffMember{}, false
+}
+
+// respondStaffError answers a failed change to the roster
+func (s *server) respondStaffError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+	case errors.Is(err, ErrStaffNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+	default:
+		log.Println(message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+	}
+}
+
+// recordChange reads a restaurant back after a change to its roster or
+// menus and adds the change to its history under action when its Staff or
+// Menus changed. It responds and returns false when the restaurant can't be
+// read.
+func (s *server) recordChange(c *gin.Context, action string, before Restaurant) (Restaurant, bool) {
+	after, ok := s.changingRestaurant(c, before.ID)
+	if !ok {
+		return Restaurant{}, false
+	}
+	if len(diffRestaurants(before, after)) > 0 {
+		s.recordHistory(c, action, before, after)
+	}
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), after))
+	return after, true
+}
+
+// chefRestaurants reads the restaurants a change to a chef's links is about
+// to touch, so the change can be recorded in their history afterwards.
+// Restaurants that are gone are skipped.
+func (s *server) chefRestaurants(c *gin.Context, ids ...int) ([]Restaurant, bool) {
+	restaurants := []Restaurant{}
+	for _, id := range ids {
+		restaurant, err := s.store.Get(c.Request.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Println("Error retrieving restaurant:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return nil, false
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+	return restaurants, true
+}
+
+// recordChefChanges adds a history entry for each restaurant whose chefs a
+// change to a chef touched. The change is already made, so a failure to
+// read a restaurant back is only logged.
+func (s *server) recordChefChanges(c *gin.Context, before []Restaurant) {
+	for _, restaurant := range before {
+		after, err := s.store.Get(c.Request.Context(), restaurant.ID)
+		if err != nil {
+			log.Println("Error retrieving restaurant:", err)
+			continue
+		}
+		if len(diffRestaurants(restaurant, after)) > 0 {
+			s.recordHistory(c, actionChefs, restaurant, after)
+		}
+	}
+}
+
+// linkedRestaurantIDs returns the IDs of the restaurants a chef is linked
+// to, once each
+func linkedRestaurantIDs(chef Chef) []int {
+	ids := []int{}
+	for _, link := range chef.Restaurants {
+		if !slices.Contains(ids, link.RestaurantID) {
+			ids = append(ids, link.RestaurantID)
+		}
+	}
+	return ids
+}
+
+// respondRoster sends the roster of a restaurant
+func (s *server) respondRoster(c *gin.Context, status int, restaurant Restaurant) {
+	members, err := s.store.Roster(c.Request.Context(), restaurant.ID)
+	if err != nil {
+		log.Println("Error retrieving staff:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	roster := staffRoster(members)
+
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/staff.tmpl",
+		HTMLData: gin.H{
+			"ID":     restaurant.ID,
+			"roster": roster,
+		},
+		JSONData: gin.H{
+			"restaurant_id": restaurant.ID,
+			"staff":         restaurant.Staff,
+			"roster":        roster,
+		},
+	})
+}
+
+// GetRestaurantPhotos returns the photo gallery of a restaurant
+func (s *server) GetRestaurantPhotos(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	respondPhotos(c, http.StatusOK, restaurant)
+}
+
+// AddRestaurantPhotos uploads one or more photos of a restaurant, each as a
+// "photo" field of a multipart form. The files have to be JPEG, PNG or GIF
+// images, whatever their names say, and none is stored unless all of them
+// are. Each one is stored with its thumbnail and large variants and added to
+// the restaurant's photos, which is added to the history.
+func (s *server) AddRestaurantPhotos(c *gin.Context) {
+	if s.photos == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Photo uploads are not available"})
+		return
+	}
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPhotoUploadBytes)
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["photo"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "photo uploads need a multipart form with a photo field"})
+		return
+	}
+
+	var uploads []photoUpload
+	for _, header := range form.File["photo"] {
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		upload, err := decodePhoto(data)
+		if errors.Is(err, errPhotoType) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			respondInvalid(c, []FieldError{{"photo", header.Filename + " " + err.Error()}})
+			return
+		}
+		uploads = append(uploads, upload)
+	}
+
+	restaurant, err := s.store.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if !ifMatch(c, restaurant) {
+		return
+	}
+
+	// Uploading a photo the restaurant already has stores it again under
+	// the same key but doesn't add it twice
+	before := copyRestaurant(restaurant)
+	for _, upload := range uploads {
+		url, err := storePhoto(c.Request.Context(), s.photos, id, upload)
+		if err != nil {
+			log.Println("Error storing photo:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		if !slices.Contains(restaurant.Photos, url) {
+			restaurant.Photos = append(restaurant.Photos, url)
+		}
+	}
+
+	restaurant, err = s.store.Update(c.Request.Context(), restaurant)
+	if errors.Is(err, ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+		return
+	}
+	if errors.Is(err, ErrStaleVersion) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Restaurant has changed, fetch it again before saving"})
+		return
+	}
+	if err != nil {
+		log.Println("Error updating restaurant:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	if len(diffRestaurants(before, restaurant)) > 0 {
+		s.recordHistory(c, actionPhotos, before, restaurant)
+	}
+
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), restaurant))
+	respondPhotos(c, http.StatusCreated, restaurant)
+}
+
+// respondPhotos sends the photo gallery of a restaurant
+func respondPhotos(c *gin.Context, status int, restaurant Restaurant) {
+	gallery := photoGallery(restaurant.Photos)
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/photos.tmpl",
+		HTMLData: gin.H{
+			"ID":     restaurant.ID,
+			"Name":   restaurant.Name,
+			"Photos": gallery,
+		},
+		JSONData: gin.H{
+			"restaurant_id": restaurant.ID,
+			"photos":        gallery,
+		},
+	})
+}
+
+// photoCacheControl lets browsers and proxies keep photos for a year. A key
+// names the content it holds, so a cached photo never goes stale.
+const photoCacheControl = "public, max-age=31536000, immutable"
+
+// GetPhoto serves an uploaded photo or one of its variants by key
+func (s *server) GetPhoto(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if s.photos == nil || !photoKeyPattern.MatchString(key) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+
+	c.Header("Cache-Control", photoCacheControl)
+	if notModified(c, `"`+path.Base(key)+`"`) {
+		return
+	}
+
+	body, size, err := s.photos.Get(c.Request.Context(), key)
+	if err != nil {
+		c.Header("Cache-Control", "")
+		c.Header("ETag", "")
+	}
+	if errors.Is(err, ErrPhotoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		return
+	}
+	if err != nil {
+		log.Println("Error retrieving photo:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	defer body.Close()
+	c.DataFromReader(http.StatusOK, size, photoContentTypes[path.Ext(key)], body, nil)
+}
+
+// GetRestaurantMenus returns the current menus of a restaurant and the
+// archive of its earlier ones
+func (s *server) GetRestaurantMenus(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	restaurant, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	s.respondMenus(c, http.StatusOK, restaurant)
+}
+
+// bindMenu decodes a menu from a JSON, urlencoded or multipart body on top
+// of the menu given, so updates only need to send what changes. Courses can
+// only come as JSON and replace all of the menu's courses when they do. It
+// responds and returns false when the body can't be read or the menu isn't
+// valid.
+func bindMenu(c *gin.Context, menu *Menu) bool {
+	// Decoding JSON into a slice reuses its elements, which would merge the
+	// courses sent into the stored ones
+	courses := menu.Courses
+	menu.Courses = nil
+
+	var errs []FieldError
+	if err := c.ShouldBind(menu); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		errs = fieldErrors("menu", err)
+	}
+	if menu.Courses == nil {
+		menu.Courses = courses
+	}
+	normalizeMenu(menu)
+	if len(errs) == 0 {
+		errs = validateMenu(*menu)
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return false
+	}
+	return true
+}
+
+// AddRestaurantMenu adds a menu to a restaurant from JSON, with its courses,
+// or from a form with its name, kind, season and price. A current menu
+// starts today unless it says otherwise and archives the current menu with
+// the same name as of that day, so adding the fall menu again with new
+// dishes starts its next version. Giving an end date records a menu that
+// has already been archived.
+func (s *server) AddRestaurantMenu(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var menu Menu
+	if !bindMenu(c, &menu) {
+		return
+	}
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	if menu.Current() {
+		menus, err := s.store.Menus(c.Request.Context(), id)
+		if err != nil {
+			log.Println("Error retrieving menus:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return
+		}
+		start, errs := menuVersionStart(menu, menus, time.Now())
+		if len(errs) > 0 {
+			respondInvalid(c, errs)
+			return
+		}
+		menu.Start = start
+	}
+
+	menu.ID, menu.RestaurantID = 0, id
+	if _, err := s.store.AddMenu(c.Request.Context(), menu); err != nil {
+		s.respondMenuError(c, "Error adding menu:", err)
+		return
+	}
+	restaurant, ok := s.recordChange(c, actionMenus, before)
+	if !ok {
+		return
+	}
+	s.respondMenus(c, http.StatusCreated, restaurant)
+}
+
+// GetRestaurantMenu returns one menu of a restaurant, current or archived
+func (s *server) GetRestaurantMenu(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	if _, ok := s.changingRestaurant(c, id); !ok {
+		return
+	}
+	menu, ok := s.restaurantMenu(c, id)
+	if !ok {
+		return
+	}
+	respondMenu(c, http.StatusOK, menu)
+}
+
+// UpdateRestaurantMenu changes a menu of a restaurant by ID. Fields the body
+// leaves out keep their values. The change is made to the menu in place; to
+// keep the old dishes in the archive, add a new version instead.
+func (s *server) UpdateRestaurantMenu(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	menu, ok := s.restaurantMenu(c, id)
+	if !ok {
+		return
+	}
+
+	menuID := menu.ID
+	if !bindMenu(c, &menu) {
+		return
+	}
+	menu.ID, menu.RestaurantID = menuID, id
+
+	menu, err := s.store.UpdateMenu(c.Request.Context(), menu)
+	if err != nil {
+		s.respondMenuError(c, "Error updating menu:", err)
+		return
+	}
+	if _, ok := s.recordChange(c, actionMenus, before); !ok {
+		return
+	}
+	respondMenu(c, http.StatusOK, menu)
+}
+
+// ArchiveRestaurantMenu moves a current menu to the archive as of a date,
+// today by default
+func (s *server) ArchiveRestaurantMenu(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+
+	var archival MenuArchival
+	if err := c.ShouldBind(&archival); err != nil {
+		var invalid validator.ValidationErrors
+		if !errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondInvalid(c, fieldErrors("archival", err))
+		return
+	}
+
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	menu, ok := s.restaurantMenu(c, id)
+	if !ok {
+		return
+	}
+	if !menu.Current() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu not found"})
+		return
+	}
+	now := time.Now()
+	date := strings.TrimSpace(archival.Date)
+	if date == "" {
+		date = now.Format(time.DateOnly)
+	}
+	if date < menu.Start {
+		respondInvalid(c, []FieldError{{"date", "must not be before " + menu.Start}})
+		return
+	}
+	if date > now.Format(time.DateOnly) {
+		respondInvalid(c, []FieldError{{"date", "must not be in the future"}})
+		return
+	}
+
+	if _, err := s.store.ArchiveMenu(c.Request.Context(), menu.ID, date); err != nil {
+		s.respondMenuError(c, "Error archiving menu:", err)
+		return
+	}
+	restaurant, ok := s.recordChange(c, actionMenus, before)
+	if !ok {
+		return
+	}
+	s.respondMenus(c, http.StatusOK, restaurant)
+}
+
+// DeleteRestaurantMenu deletes a menu of a restaurant, current or archived.
+// Archiving keeps a menu's history; deleting is for menus added by mistake.
+func (s *server) DeleteRestaurantMenu(c *gin.Context) {
+	id, ok := restaurantID(c)
+	if !ok {
+		return
+	}
+	before, ok := s.changingRestaurant(c, id)
+	if !ok {
+		return
+	}
+	menu, ok := s.restaurantMenu(c, id)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteMenu(c.Request.Context(), menu.ID); err != nil {
+		s.respondMenuError(c, "Error deleting menu:", err)
+		return
+	}
+	restaurant, ok := s.recordChange(c, actionMenus, before)
+	if !ok {
+		return
+	}
+	s.respondMenus(c, http.StatusOK, restaurant)
+}
+
+// restaurantMenu finds the menu named by the :menu_id path parameter among
+// a restaurant's menus. It responds with 404 and returns false when there
+// is no such menu.
+func (s *server) restaurantMenu(c *gin.Context, restaurantID int) (Menu, bool) {
+	menuID, err := strconv.Atoi(c.Param("menu_id"))
+	if err == nil {
+		menus, err := s.store.Menus(c.Request.Context(), restaurantID)
+		if err != nil {
+			log.Println("Error retrieving menus:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+			return Menu{}, false
+		}
+		for _, menu := range menus {
+			if menu.ID == menuID {
+				return menu, true
+			}
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Menu not found"})
+	return Menu{}, false
+}
+
+// respondMenuError answers a failed change to a menu
+func (s *server) respondMenuError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
+	case errors.Is(err, ErrMenuNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu not found"})
+	default:
+		log.Println(message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+	}
+}
+
+// respondMenu sends one menu, rendered the way the restaurant page shows it
+func respondMenu(c *gin.Context, status int, menu Menu) {
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/menu.tmpl",
+		HTMLData: menu,
+		JSONData: menu,
+	})
+}
+
+// respondMenus sends the current and archived menus of a restaurant
+func (s *server) respondMenus(c *gin.Context, status int, restaurant Restaurant) {
+	menus, err := s.store.Menus(c.Request.Context(), restaurant.ID)
+	if err != nil {
+		log.Println("Error retrieving menus:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
+		return
+	}
+	current, archive := currentMenus(menus), archivedMenus(menus)
+
+	c.Negotiate(status, gin.Negotiate{
+		Offered:  offeredFormats,
+		HTMLName: "templates/menus.tmpl",
+		HTMLData: gin.H{
+			"ID":      restaurant.ID,
+			"current": current,
+			"archive": archive,
+		},
+		JSONData: gin.H{
+			"restaurant_id": restaurant.ID,
+			"menus":         current,
+			"archive":       archive,
+		},
+	})
+}
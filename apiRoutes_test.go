@@ -1,15 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetRestaurantsHTML(t *testing.T) {
-	router := setupRouter()
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// seedStore returns an in-memory store holding a single restaurant
+func seedStore(t *testing.T) (*memoryStore, Restaurant) {
+	store := newMemoryStore()
+	restaurant, err := store.Create(context.Background(), Restaurant{
+		Name:    "Alinea",
+		Stars:   3,
+		Address: "1723 N Halsted St, Chicago, IL 60614",
+		State:   "IL",
+		Chef:    "Grant Achatz",
+		Website: "https://www.alinearestaurant.com",
+		Staff:   []string{"Nick Kokonas"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, restaurant
+}
+
+func TestPing(t *testing.T) {
+	router := setupRouter(newMemoryStore(), nil, nil)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/ping", nil)
@@ -18,3 +51,1270 @@ func TestGetRestaurantsHTML(t *testing.T) {
 	assert.Equal(t, 200, w.Code)
 	assert.Equal(t, "pong", w.Body.String())
 }
+
+func TestGetRestaurantsHTML(t *testing.T) {
+	store, _ := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/restaurants", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "Alinea")
+}
+
+func TestGetRestaurantsJSON(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/v1/restaurants?format=json", nil),
+		func() *http.Request {
+			req := httptest.NewRequest("GET", "/api/v1/restaurants", nil)
+			req.Header.Set("Accept", "application/json")
+			return req
+		}(),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 200, w.Code)
+		var page restaurantPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, []Restaurant{restaurant}, page.Restaurants)
+		assert.Equal(t, 1, page.Total)
+	}
+}
+
+func TestGetRestaurantsPagination(t *testing.T) {
+	store := newMemoryStore()
+	for _, name := range []string{"Saison", "Masa", "Per Se", "SingleThread", "Atelier Crenn"} {
+		store.Create(context.Background(), Restaurant{Name: name, Stars: 3, State: "CA"})
+	}
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/restaurants?format=json&sort=name&limit=2&offset=2", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	var page restaurantPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 5, page.Total)
+	assert.Equal(t, "Per Se", page.Restaurants[0].Name)
+	assert.Equal(t, "Saison", page.Restaurants[1].Name)
+	assert.Equal(t, "/api/v1/restaurants?format=json&limit=2&offset=0&sort=name", page.Previous)
+	assert.Equal(t, "/api/v1/restaurants?format=json&limit=2&offset=4&sort=name", page.Next)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/restaurants?limit=2", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `hx-get="http://localhost:8083/api/v1/restaurants?limit=2&amp;offset=2"`)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/restaurants?sort=chef", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestGetRestaurantById(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/restaurant/1", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Nick Kokonas")
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/restaurant/1?format=json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var got Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, restaurant, got)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/restaurant/2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestCreateRestaurant(t *testing.T) {
+	store := newMemoryStore()
+	router := setupRouter(store, nil, nil)
+
+	form := url.Values{
+		"name":    {"Le Bernardin"},
+		"stars":   {"3"},
+		"address": {"155 W 51st St, New York, NY 10019"},
+		"chef":    {"Eric Ripert"},
+		"staff":   {"Aldo Sohm", "Maguy Le Coze"},
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 201, w.Code)
+	var created Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "Le Bernardin", created.Name)
+	assert.Equal(t, []string{"Aldo Sohm", "Maguy Le Coze"}, created.Staff)
+	assert.Equal(t, "NY", created.State)
+	assert.Equal(t, AddressParts{"155 W 51st St", "New York", "NY", "10019", "US"}, created.AddressParts)
+
+	stored, err := store.Get(context.Background(), created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, created, stored)
+}
+
+func TestCreateRestaurantInvalid(t *testing.T) {
+	store := newMemoryStore()
+	router := setupRouter(store, nil, nil)
+
+	form := url.Values{
+		"stars":   {"three"},
+		"address": {"155 W 51st St, New York, NY 10019"},
+		"state":   {"ZZ"},
+		"website": {"le-bernardin"},
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 422, w.Code)
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Validation failed", body.Error)
+	assert.Equal(t, []FieldError{
+		{"stars", "must be a number"},
+		{"name", "is required"},
+		{"state", "must be a two letter US state code"},
+		{"website", "must be an http or https URL"},
+		{"state", "must match the address, which is in NY"},
+	}, body.Fields)
+
+	_, total, _ := store.List(context.Background(), ListOptions{})
+	assert.Equal(t, 0, total)
+}
+
+func TestUpdateRestaurant(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	update := func(id string, form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/"+id, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A blank name used to stop the server; now it's a validation error
+	w := update("1", url.Values{"updateName": {" "}, "updateStars": {"5"}})
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"name","message":"is required"}`)
+	assert.Contains(t, w.Body.String(), `{"field":"stars","message":"must be at most 3"}`)
+	stored, _ := store.Get(context.Background(), 1)
+	assert.Equal(t, restaurant, stored)
+
+	w = update("1", url.Values{"updateStars": {"2"}, "state": {"il "}})
+	assert.Equal(t, 200, w.Code)
+	var updated Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	restaurant.Stars = 2
+	restaurant.Version = 2
+	assert.Equal(t, restaurant, updated)
+
+	w = update("99", url.Values{"updateName": {"Smyth"}})
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestPatchRestaurant(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := patch("application/merge-patch+json", `{"stars":2,"website":null}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/merge-patch+json, application/json-patch+json", w.Header().Get("Accept-Patch"))
+	var updated Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	restaurant.Stars = 2
+	restaurant.Website = ""
+	restaurant.Version = 2
+	assert.Equal(t, restaurant, updated)
+
+	w = patch("application/json-patch+json", `[{"op":"add","path":"/staff/-","value":"Simon Davies"}]`)
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, []string{"Nick Kokonas", "Simon Davies"}, updated.Staff)
+
+	w = patch("application/json-patch+json", `[{"op":"test","path":"/stars","value":3},{"op":"replace","path":"/stars","value":1}]`)
+	assert.Equal(t, 409, w.Code)
+
+	w = patch("application/json-patch+json", `[{"op":"remove","path":"/hours/0"}]`)
+	assert.Equal(t, 422, w.Code)
+
+	w = patch("application/merge-patch+json", `{"name":null}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"name","message":"is required"}`)
+
+	stored, _ := store.Get(context.Background(), 1)
+	assert.Equal(t, updated, stored)
+}
+
+func TestRestaurantETags(t *testing.T) {
+	store, _ := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	request := func(method, target string, header http.Header, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header = header
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/v1/restaurant/1", http.Header{}, "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `"1-json"`, w.Header().Get("ETag"))
+	w = request("GET", "/api/v1/restaurant/1", http.Header{"If-None-Match": {`"1-json"`}}, "")
+	assert.Equal(t, 304, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// The HTML page says whether the restaurant is open right now, so it is
+	// never answered with 304, whatever tag is sent
+	for _, tag := range []string{`"1-json"`, `"1-html"`, "*"} {
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/restaurant/1", nil)
+		req.Header.Set("If-None-Match", tag)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code, tag)
+		assert.Empty(t, w.Header().Get("ETag"), tag)
+		assert.Contains(t, w.Body.String(), "Alinea", tag)
+	}
+
+	w = request("GET", "/api/v1/restaurants", http.Header{}, "")
+	assert.Equal(t, 200, w.Code)
+	listETag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(listETag, `W/"`))
+	w = request("GET", "/api/v1/restaurants", http.Header{"If-None-Match": {listETag}}, "")
+	assert.Equal(t, 304, w.Code)
+
+	w = request("PATCH", "/api/v1/restaurant/update/1", http.Header{"If-Match": {`"1-json"`}}, `{"stars":2}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+
+	// The other editor still holds version 1
+	w = request("PATCH", "/api/v1/restaurant/update/1", http.Header{"If-Match": {`"1-json"`}}, `{"stars":1}`)
+	assert.Equal(t, 412, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+	w = request("DELETE", "/api/v1/restaurant/delete/1", http.Header{"If-Match": {`"1-json"`}}, "")
+	assert.Equal(t, 412, w.Code)
+	stored, _ := store.Get(context.Background(), 1)
+	assert.Equal(t, 2, stored.Stars)
+
+	w = request("GET", "/api/v1/restaurants", http.Header{"If-None-Match": {listETag}}, "")
+	assert.Equal(t, 200, w.Code)
+	// Either format's tag names the version to delete
+	w = request("DELETE", "/api/v1/restaurant/delete/1", http.Header{"If-Match": {`"2-html"`}}, "")
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestRestaurantRowIfMatch(t *testing.T) {
+	store, _ := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	// The buttons of each row in the table send back the tag they were
+	// rendered with
+	rowIfMatch := func() map[string]string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants", nil))
+		assert.Equal(t, 200, w.Code)
+		tags := map[string]string{}
+		for _, match := range regexp.MustCompile(`delete/(\d+)"[^>]*hx-headers='([^']*)'`).FindAllStringSubmatch(w.Body.String(), -1) {
+			var headers map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(html.UnescapeString(match[2])), &headers))
+			tags[match[1]] = headers["If-Match"]
+		}
+		return tags
+	}
+
+	tags := rowIfMatch()
+	assert.Equal(t, map[string]string{"1": `"1-html"`}, tags)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/1", strings.NewReader(`{"name":"Alinea Chicago"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", tags["1"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	// The row was rendered before the update, so its delete is refused
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/api/v1/restaurant/delete/1", nil)
+	req.Header.Set("If-Match", tags["1"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 412, w.Code)
+
+	tags = rowIfMatch()
+	assert.Equal(t, `"2-html"`, tags["1"])
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/api/v1/restaurant/delete/1", nil)
+	req.Header.Set("If-Match", tags["1"])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	_, err := store.Get(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateRestaurantBodies(t *testing.T) {
+	router := setupRouter(newMemoryStore(), nil, nil)
+
+	create := func(contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create("application/json", `{"id":9,"name":"Smyth","stars":2,"address":"177 N Ada St","staff":["John Shields"],"michelin":true}`)
+	assert.Equal(t, 201, w.Code)
+	var created Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, Restaurant{
+		ID:      1,
+		Version: 1,
+		Name:    "Smyth",
+		Stars:   2,
+		Address: "177 N Ada St",
+		Chefs:   []ChefLink{},
+		Staff:   []string{"John Shields"},
+		Photos:  []string{},
+		Menus:   []string{},
+
+		AddressParts: AddressParts{Street: "177 N Ada St"},
+	}, created)
+
+	multipart := "--b\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\nOriole\r\n" +
+		"--b\r\nContent-Disposition: form-data; name=\"address\"\r\n\r\n661 W Walnut St\r\n--b--\r\n"
+	w = create("multipart/form-data; boundary=b", multipart)
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Oriole"`)
+
+	w = create("application/json", `{"name":"Smyth","stars":"two","address":"177 N Ada St"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"stars","message":"must be a number"}`)
+
+	w = create("text/plain", "Smyth")
+	assert.Equal(t, 415, w.Code)
+}
+
+func TestCreateRestaurantStrict(t *testing.T) {
+	router := setupRouter(newMemoryStore(), nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create?strict=true",
+		strings.NewReader(`{"name":"Smyth","address":"177 N Ada St","michelin":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"michelin","message":"is not a restaurant field"}`)
+
+	form := url.Values{"name": {"Smyth"}, "address": {"177 N Ada St"}, "rating": {"2"}, "cuisine": {"American"}}
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/api/v1/restaurant/create?strict=true", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `[{"field":"cuisine","message":"is not a restaurant field"},{"field":"rating","message":"is not a restaurant field"}]`)
+}
+
+func TestDeleteRestaurant(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/api/v1/restaurant/delete/1", nil)
+	req.Header.Set("Accept", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	var deleted Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &deleted))
+	assert.NotNil(t, deleted.DeletedAt)
+	deleted.DeletedAt = nil
+	assert.Equal(t, restaurant, deleted)
+
+	_, err := store.Get(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTrashRoutes(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := request("DELETE", "/api/v1/restaurant/delete/1")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `hx-post="http://localhost:8083/api/v1/restaurant/restore/1"`)
+	assert.Contains(t, w.Body.String(), "Undo")
+
+	w = request("GET", "/api/v1/restaurants/trash")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Alinea")
+
+	w = request("GET", "/api/v1/restaurants/trash?format=json")
+	var page restaurantPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 1, page.Total)
+
+	// Undo swaps the restaurant's row back into the table
+	w = request("POST", "/api/v1/restaurant/restore/1")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `<tr restaurantID="1">`)
+	stored, err := store.Get(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, restaurant, stored)
+
+	w = request("POST", "/api/v1/restaurant/restore/1")
+	assert.Equal(t, 404, w.Code)
+	w = request("GET", "/api/v1/restaurants/trash")
+	assert.Contains(t, w.Body.String(), "The trash is empty")
+}
+
+func TestSearchRestaurants(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/restaurants/search?q=achatz&format=json", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	var body struct {
+		Results []SearchResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.Results, 1) {
+		assert.Equal(t, restaurant, body.Results[0].Restaurant)
+		assert.Equal(t, "Grant <mark>Achatz</mark>", string(body.Results[0].Highlights["chef"]))
+	}
+
+	// The HTML response is table rows for the live search box
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/restaurants/search?q=", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `<tr restaurantID="1">`)
+}
+
+func TestNearbyRestaurantsRoute(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	// Coordinates can be posted in a form like any other field
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/1", strings.NewReader("latitude=41.9134&longitude=-87.6482"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("PATCH", "/api/v1/restaurant/update/1", strings.NewReader("latitude=north"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"latitude","message":"must be a number"}`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/nearby?format=json&lat=41.8841&lng=-87.6520&radius=5000", nil))
+	assert.Equal(t, 200, w.Code)
+	var body struct {
+		Radius  float64        `json:"radius"`
+		Results []NearbyResult `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, 5000.0, body.Radius)
+	if assert.Len(t, body.Results, 1) {
+		assert.Equal(t, restaurant.ID, body.Results[0].Restaurant.ID)
+		assert.Equal(t, 3273.0, body.Results[0].Distance)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/nearby?lat=41.8841&lng=-87.6520", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "Alinea")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/nearby?lat=41.8841&lng=-87.6520&radius=1000", nil))
+	assert.NotContains(t, w.Body.String(), "Alinea")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/nearby?lat=41.8841", nil))
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestRestaurantMapRoutes(t *testing.T) {
+	store, restaurant := seedStore(t)
+	smyth := Restaurant{Name: "Smyth", Stars: 2, Address: "177 N Ada St, Chicago, IL 60607"}
+	smyth.Latitude, smyth.Longitude = coordinates(41.8842, -87.6522)
+	store.Create(context.Background(), smyth)
+	router := setupRouter(store, nil, nil)
+
+	// Only restaurants with coordinates are on the map
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants.geojson", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, mimeGeoJSON, w.Header().Get("Content-Type"))
+	var collection featureCollection
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &collection))
+	if assert.Len(t, collection.Features, 1) {
+		assert.Equal(t, "Smyth", collection.Features[0].Properties.Name)
+		assert.Equal(t, [2]float64{-87.6522, 41.8842}, collection.Features[0].Geometry.Coordinates)
+	}
+
+	// The list filters apply, and the map page passes them on
+	req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/"+strconv.Itoa(restaurant.ID), strings.NewReader(`{"latitude":41.9134,"longitude":-87.6482}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants.geojson?stars=3", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &collection))
+	if assert.Len(t, collection.Features, 1) {
+		assert.Equal(t, restaurant.ID, collection.Features[0].ID)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/map?stars=3", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `data-geojson="http://localhost:8083/api/v1/restaurants.geojson?stars=3"`)
+
+	// Leaflet is pinned to a release and checked against its hash
+	assert.Contains(t, w.Body.String(), `href="https://unpkg.com/leaflet@1.9.4/dist/leaflet.css" integrity="sha256-`)
+	assert.Contains(t, w.Body.String(), `"https://unpkg.com/leaflet@1.9.4/dist/leaflet.js", "sha256-`)
+
+	for _, path := range []string{"/api/v1/restaurants.geojson?stars=three", "/api/v1/restaurants/map?sort=size"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, 400, w.Code, path)
+	}
+}
+
+func TestGeocodeRoutes(t *testing.T) {
+	store, _ := seedStore(t)
+	router := setupRouter(store, nil, testGazetteer(t))
+
+	// A new restaurant is placed by its ZIP code
+	form := url.Values{"name": {"Oriole"}, "stars": {"2"}, "address": {"661 W Walnut St, Chicago, IL 60607"}}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+	var created Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	if assert.NotNil(t, created.Latitude) {
+		assert.Equal(t, 41.88, *created.Latitude)
+		assert.Equal(t, -87.65, *created.Longitude)
+	}
+
+	// Moving it places it again, unless the coordinates come along
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("PATCH", "/api/v1/restaurant/update/"+strconv.Itoa(created.ID), strings.NewReader(`{"address":"11 Madison Ave, New York, NY 10010","state":"NY"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	stored, _ := store.Get(context.Background(), created.ID)
+	assert.Equal(t, 40.74, *stored.Latitude)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("PATCH", "/api/v1/restaurant/update/"+strconv.Itoa(created.ID), strings.NewReader(`{"address":"661 W Walnut St, Chicago, IL 60607","state":"IL","latitude":41.8858,"longitude":-87.6435}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	stored, _ = store.Get(context.Background(), created.ID)
+	assert.Equal(t, 41.8858, *stored.Latitude)
+}
+
+func TestImportRestaurantsRoute(t *testing.T) {
+	store := newMemoryStore()
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurants/import",
+		strings.NewReader("name,stars,address\nMasa,3,10 Columbus Cir\nPer Se,9,\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 422, w.Code)
+	var report ImportReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 3, report.Errors[0].Line)
+	assert.Len(t, report.Errors[0].Errors, 2)
+
+	// A row that isn't valid CSV is reported with the others
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/api/v1/restaurants/import",
+		strings.NewReader("name,stars,address\nMasa,3,10 Columbus Cir\nPer Se \"NYC\",3,10 Columbus Cir\nLe Bernardin,3,155 W 51st St\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 422, w.Code)
+	report = ImportReport{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 3, report.Rows)
+	if assert.Len(t, report.Errors, 1) {
+		assert.Equal(t, 3, report.Errors[0].Line)
+		assert.Equal(t, FieldError{"row", `is not valid CSV: bare " in non-quoted-field`}, report.Errors[0].Errors[0])
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/api/v1/restaurants/import",
+		strings.NewReader(`{"name":"Masa","stars":3,"address":"10 Columbus Cir"}`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 201, w.Code)
+	restaurants, _, _ := store.List(context.Background(), ListOptions{})
+	assert.Len(t, restaurants, 1)
+	history, _ := store.History(context.Background(), restaurants[0].ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "import", history[0].Action)
+		assert.Equal(t, restaurants[0], history[0].Restaurant)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/api/v1/restaurants/import", strings.NewReader("<xml/>"))
+	req.Header.Set("Content-Type", "application/xml")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 415, w.Code)
+}
+
+func TestRestaurantHistory(t *testing.T) {
+	store := newMemoryStore()
+	router := setupRouter(store, nil, nil)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		req.Header.Set("X-Actor", "editor@example.com")
+		req.Header.Set("X-Request-ID", "req-"+method)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(`{"name":"Alinea","stars":3,"address":"1723 N Halsted St"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+
+	assert.Equal(t, 200, request("PATCH", "/api/v1/restaurant/update/1", `{"stars":2}`).Code)
+	assert.Equal(t, 200, request("DELETE", "/api/v1/restaurant/delete/1", "").Code)
+	assert.Equal(t, 200, request("POST", "/api/v1/restaurant/restore/1", "").Code)
+
+	var body struct {
+		RestaurantID int            `json:"restaurant_id"`
+		History      []HistoryEntry `json:"history"`
+	}
+	w = request("GET", "/api/v1/restaurant/1/history", "")
+	assert.Equal(t, 200, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.History, 4) {
+		actions := []string{}
+		for _, entry := range body.History {
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []string{"restore", "delete", "update", "create"}, actions)
+
+		update := body.History[2]
+		assert.Equal(t, "editor@example.com", update.Actor)
+		assert.Equal(t, "req-PATCH", update.RequestID)
+		assert.Equal(t, []FieldChange{{"stars", 3.0, 2.0}}, update.Changes)
+		assert.Equal(t, "anonymous", body.History[3].Actor)
+		assert.Equal(t, "deleted_at", body.History[0].Changes[0].Field)
+		assert.Nil(t, body.History[0].Changes[0].After)
+	}
+
+	// Reverting to the first revision brings the stars back and is itself
+	// part of the history
+	w = request("POST", "/api/v1/restaurant/1/revert/1", "")
+	assert.Equal(t, 200, w.Code)
+	var reverted Restaurant
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reverted))
+	assert.Equal(t, 3, reverted.Stars)
+	assert.Equal(t, 3, reverted.Version)
+	history, _ := store.History(context.Background(), 1)
+	assert.Equal(t, "revert", history[0].Action)
+
+	assert.Equal(t, 404, request("POST", "/api/v1/restaurant/1/revert/99", "").Code)
+	assert.Equal(t, 404, request("GET", "/api/v1/restaurant/2/history", "").Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1/history", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `hx-post="http://localhost:8083/api/v1/restaurant/1/revert/1"`)
+}
+
+func TestRestaurantRatings(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	record := func(contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/restaurant/1/ratings", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 201, record("application/json", `{"year":2023,"stars":3}`).Code)
+	w := record("application/x-www-form-urlencoded", "year=2024&source=michelin&stars=2")
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+
+	var body struct {
+		RestaurantID int             `json:"restaurant_id"`
+		Stars        int             `json:"stars"`
+		Ratings      []TimelineEntry `json:"ratings"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, 2, body.Stars)
+	if assert.Len(t, body.Ratings, 2) {
+		assert.Equal(t, Rating{2024, "Michelin", 2}, body.Ratings[1].Rating)
+		assert.Equal(t, -1, body.Ratings[1].Change)
+	}
+
+	// Losing a star shows up on the restaurant and in its history
+	updated, _ := store.Get(context.Background(), restaurant.ID)
+	assert.Equal(t, 2, updated.Stars)
+	history, _ := store.History(context.Background(), restaurant.ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "rate", history[0].Action)
+		assert.Equal(t, []FieldChange{{"stars", 3, 2}}, history[0].Changes)
+	}
+
+	w = record("application/json", `{"year":1800,"stars":5}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"stars"`)
+	assert.Equal(t, 400, record("application/json", `{"year":"last"}`).Code)
+
+	// Stars follow the ratings, so an update can't set them directly
+	patch := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PATCH", "/api/v1/restaurant/update/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w = patch(`{"stars":3}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `{"field":"stars","message":"follows the ratings, record one at /api/v1/restaurant/1/ratings"}`)
+	assert.Equal(t, 200, patch(`{"stars":2,"chef":"Grant Achatz and Simon Davies"}`).Code)
+
+	ratings := func() {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/restaurant/1/ratings", nil)
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	}
+	ratings()
+	assert.Equal(t, 2, body.Stars)
+	assert.Equal(t, Rating{2024, "Michelin", 2}, body.Ratings[len(body.Ratings)-1].Rating)
+
+	// Reverting to before the latest rating keeps its stars too
+	assert.Equal(t, 201, record("application/json", `{"year":2025,"stars":3}`).Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/restaurant/1/revert/1", nil))
+	assert.Equal(t, 200, w.Code)
+	ratings()
+	assert.Equal(t, 3, body.Stars)
+	updated, _ = store.Get(context.Background(), restaurant.ID)
+	assert.Equal(t, 3, updated.Stars)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1/ratings", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<del>-1</del>")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/2/ratings", nil))
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestRestaurantSchedule(t *testing.T) {
+	store := newMemoryStore()
+	router := setupRouter(store, nil, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/restaurant/create", strings.NewReader(`{
+		"name": "Smyth",
+		"address": "177 N Ada St",
+		"schedule": {
+			"time_zone": "America/Chicago",
+			"weekly": [{"day": "Tuesday", "services": [{"name": "dinner", "opens": "17:00", "closes": "22:00"}]}],
+			"exceptions": [{"date": "2999-12-25", "name": "Christmas"}]
+		}
+	}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+	smyth, _ := store.Get(context.Background(), 1)
+	assert.Equal(t, "tuesday", smyth.Schedule.Weekly[0].Day)
+
+	list := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants?format=json&"+query, nil))
+		return w
+	}
+	assert.Contains(t, list("open_at="+url.QueryEscape("2024-06-04T20:00:00-05:00")).Body.String(), `"total":1`)
+	assert.Contains(t, list("open_at="+url.QueryEscape("2024-06-05T20:00:00-05:00")).Body.String(), `"total":0`)
+	assert.Equal(t, 400, list("open_at=tonight").Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1", nil))
+	assert.Contains(t, w.Body.String(), "17:00–22:00")
+	assert.Contains(t, w.Body.String(), `<time datetime="2999-12-25">2999-12-25</time> (Christmas)`)
+	assert.Contains(t, w.Body.String(), "Times in America/Chicago")
+}
+
+func TestRestaurantCalendarRoutes(t *testing.T) {
+	store := newMemoryStore()
+	store.Create(context.Background(), Restaurant{Name: "Smyth", State: "IL", Schedule: smythSchedule()})
+	store.Create(context.Background(), Restaurant{Name: "Saison", State: "CA", Schedule: &Schedule{
+		TimeZone: "America/Los_Angeles",
+		Weekly:   []DayHours{{Day: "tuesday", Services: []Service{{"dinner", "17:30", "21:00"}}}},
+	}})
+	router := setupRouter(store, nil, nil)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	w := get("/api/v1/restaurant/1/hours.ics")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "X-WR-CALNAME:Smyth hours\r\n")
+	assert.Equal(t, 404, get("/api/v1/restaurant/3/hours.ics").Code)
+
+	w = get("/api/v1/restaurants/hours.ics")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "TZID:America/Chicago\r\n")
+	assert.Contains(t, w.Body.String(), "TZID:America/Los_Angeles\r\n")
+
+	w = get("/api/v1/restaurants/hours.ics?state=CA")
+	assert.NotContains(t, w.Body.String(), "Smyth")
+	assert.Contains(t, w.Body.String(), "SUMMARY:Saison dinner\r\n")
+	assert.Equal(t, 400, get("/api/v1/restaurants/hours.ics?sort=chef").Code)
+}
+
+func TestChefRoutes(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	send := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/api/v1/chef/create", "application/json", `{"id":7,"name":" Grant  Achatz ","bio":"Alinea's founder"}`)
+	assert.Equal(t, 201, w.Code)
+	var chef Chef
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &chef))
+	assert.Equal(t, Chef{ID: 1, Name: "Grant Achatz", Bio: "Alinea's founder", Restaurants: []ChefLink{}}, chef)
+	assert.Equal(t, 422, send("POST", "/api/v1/chef/create", "application/json", `{"name":" "}`).Code)
+
+	// Updates keep the fields they don't send
+	w = send("PATCH", "/api/v1/chef/update/1", "application/x-www-form-urlencoded", "photo=https://example.com/grant.jpg")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"bio":"Alinea's founder"`)
+	assert.Equal(t, 404, send("PATCH", "/api/v1/chef/update/9", "application/json", `{"name":"Nobody"}`).Code)
+
+	w = send("POST", "/api/v1/chef/1/restaurants", "application/json", `{"restaurant_id":1,"start":"2005-05-04"}`)
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"restaurant":"Alinea","role":"head chef","start":"2005-05-04"`)
+	w = send("POST", "/api/v1/chef/1/restaurants", "application/json", `{"restaurant_id":1,"start":"2005-05-04","end":"2001-01-01"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"end"`)
+	assert.Equal(t, 422, send("POST", "/api/v1/chef/1/restaurants", "application/json", `{"restaurant_id":1,"start":"May 2005"}`).Code)
+	assert.Equal(t, 404, send("POST", "/api/v1/chef/1/restaurants", "application/json", `{"restaurant_id":9}`).Code)
+	assert.Equal(t, 404, send("POST", "/api/v1/chef/9/restaurants", "application/json", `{"restaurant_id":1}`).Code)
+
+	// The restaurant page links its chef's name to the chef page
+	linked, _ := store.Get(context.Background(), restaurant.ID)
+	assert.Len(t, linked.Chefs, 1)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1", nil))
+	assert.Contains(t, w.Body.String(), `hx-get="http://localhost:8083/api/v1/chef/1"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/chef/1", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `<time datetime="2005-05-04">2005-05-04</time> – present`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/chefs?format=json", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Grant Achatz"`)
+
+	assert.Equal(t, 404, send("DELETE", "/api/v1/chef/1/restaurants/1?role=owner", "", "").Code)
+	w = send("DELETE", "/api/v1/chef/1/restaurants/1", "", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"restaurants":[]`)
+
+	assert.Equal(t, 200, send("DELETE", "/api/v1/chef/delete/1", "", "").Code)
+	assert.Equal(t, 404, send("DELETE", "/api/v1/chef/delete/1", "", "").Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/chef/1", nil))
+	assert.Equal(t, 404, w.Code)
+}
+
+func TestChefLinksChangeRestaurantETag(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+	ctx := context.Background()
+	grant, _ := store.CreateChef(ctx, Chef{Name: "Grant Achatz"})
+
+	send := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header = header
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	path := fmt.Sprintf("/api/v1/restaurant/%d", restaurant.ID)
+	etag := send("GET", path, "", http.Header{}).Header().Get("ETag")
+
+	// Each change to the chefs a restaurant shows makes its cached copy stale,
+	// and is recorded in its history
+	changes := []struct{ method, path, body string }{
+		{"POST", fmt.Sprintf("/api/v1/chef/%d/restaurants", grant.ID), fmt.Sprintf(`{"restaurant_id":%d}`, restaurant.ID)},
+		{"PATCH", fmt.Sprintf("/api/v1/chef/update/%d", grant.ID), `{"name":"Chef Grant Achatz"}`},
+		{"DELETE", fmt.Sprintf("/api/v1/chef/%d/restaurants/%d", grant.ID, restaurant.ID), ""},
+	}
+	for _, change := range changes {
+		w := send(change.method, change.path, change.body, http.Header{})
+		assert.Less(t, w.Code, 300, change.path)
+
+		w = send("GET", path, "", http.Header{"If-None-Match": {etag}})
+		assert.Equal(t, 200, w.Code, change.path)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"), change.path)
+		etag = w.Header().Get("ETag")
+	}
+
+	history, err := store.History(ctx, restaurant.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		for _, entry := range history {
+			assert.Equal(t, actionChefs, entry.Action)
+			assert.Equal(t, "chefs", entry.Changes[0].Field)
+		}
+	}
+
+	// Linking the same role again with the same dates changes nothing
+	send("POST", changes[0].path, changes[0].body, http.Header{})
+	etag = send("GET", path, "", http.Header{}).Header().Get("ETag")
+	send("POST", changes[0].path, changes[0].body, http.Header{})
+	assert.Equal(t, 304, send("GET", path, "", http.Header{"If-None-Match": {etag}}).Code)
+
+	// Deleting the chef takes them off the restaurant too
+	assert.Equal(t, 200, send("DELETE", fmt.Sprintf("/api/v1/chef/delete/%d", grant.ID), "", http.Header{}).Code)
+	assert.Equal(t, 200, send("GET", path, "", http.Header{"If-None-Match": {etag}}).Code)
+	history, _ = store.History(ctx, restaurant.ID)
+	assert.Len(t, history, 5)
+}
+
+func TestRestaurantStaff(t *testing.T) {
+	store, restaurant := seedStore(t)
+	next, _ := store.Create(context.Background(), Restaurant{Name: "Next", Address: "953 W Fulton Market"})
+	router := setupRouter(store, nil, nil)
+
+	send := func(path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/api/v1/restaurant/1/staff", "application/json", `{"name":"Joe Catterson","role":"Wine Director","start":"2005-05-04"}`)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+	var body struct {
+		Staff  []string     `json:"staff"`
+		Roster []RosterRole `json:"roster"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, []string{"Nick Kokonas", "Joe Catterson"}, body.Staff)
+	if assert.Len(t, body.Roster, 2) {
+		assert.Equal(t, "Wine Director", body.Roster[0].Role)
+	}
+	joe := body.Roster[0].Current[0].ID
+
+	w = send("/api/v1/restaurant/1/staff", "application/json", `{"name":" ","start":"2005-05-04","end":"2001-01-01"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"end"`)
+	assert.Equal(t, 404, send("/api/v1/restaurant/9/staff", "application/json", `{"name":"Nobody"}`).Code)
+
+	// A move has to go somewhere, and can't end a stint before it started
+	path := fmt.Sprintf("/api/v1/restaurant/1/staff/%d/move", joe)
+	assert.Equal(t, 422, send(path, "application/x-www-form-urlencoded", "role=Wine+Director").Code)
+	assert.Equal(t, 422, send(path, "application/x-www-form-urlencoded", "role=Sommelier&date=2001-01-01").Code)
+	assert.Equal(t, 404, send(path, "application/x-www-form-urlencoded", "restaurant_id=9").Code)
+	w = send(path, "application/x-www-form-urlencoded", fmt.Sprintf("restaurant_id=%d&date=2011-04-06", next.ID))
+	assert.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"staff":["Nick Kokonas"]`)
+	assert.Contains(t, w.Body.String(), `"end":"2011-04-06"`)
+	assert.Equal(t, 404, send(path, "application/x-www-form-urlencoded", "role=Sommelier").Code)
+
+	moved, _ := store.Get(context.Background(), next.ID)
+	assert.Equal(t, []string{"Joe Catterson"}, moved.Staff)
+	history, _ := store.History(context.Background(), restaurant.ID)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "staff", history[0].Action)
+		assert.Equal(t, []FieldChange{{"staff", []string{"Nick Kokonas", "Joe Catterson"}, []string{"Nick Kokonas"}}}, history[0].Changes)
+	}
+
+	w = send("/api/v1/restaurant/1/staff/1/retire", "application/x-www-form-urlencoded", "")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"staff":[]`)
+	assert.Equal(t, 404, send("/api/v1/restaurant/1/staff/1/retire", "application/x-www-form-urlencoded", "").Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1/staff", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `<td>Wine Director</td>`)
+	assert.Contains(t, w.Body.String(), `Joe Catterson <small><time datetime="2005-05-04">2005-05-04</time> – <time datetime="2011-04-06">2011-04-06</time></small>`)
+	assert.Contains(t, w.Body.String(), "Vacant")
+}
+
+func TestRestaurantMenus(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, nil, nil)
+
+	send := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", contentType)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	var body struct {
+		Menus   []Menu `json:"menus"`
+		Archive []Menu `json:"archive"`
+	}
+
+	w := send("POST", "/api/v1/restaurant/1/menus", "application/json", `{
+		"name": "Tasting", "kind": "tasting", "price": "295", "currency": "USD", "start": "2024-06-01",
+		"courses": [{"name": "First", "dishes": [{"name": "Black Truffle Explosion", "allergens": ["wheat"]}]}]
+	}`)
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if !assert.Len(t, body.Menus, 1) {
+		return
+	}
+	assert.Equal(t, "2024-06-01", body.Menus[0].Start)
+
+	w = send("POST", "/api/v1/restaurant/1/menus", "application/json", `{"name":"Tasting","price":"a lot","courses":[{"dishes":[{"name":"Pie","diets":["paleo"]}]}]}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"price"`)
+	assert.Contains(t, w.Body.String(), `"field":"courses[0].dishes[0].diets[0]"`)
+	w = send("POST", "/api/v1/restaurant/1/menus", "application/x-www-form-urlencoded", "name=Tasting&start=2024-01-01")
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"start"`)
+	assert.Equal(t, 404, send("POST", "/api/v1/restaurant/9/menus", "application/json", `{"name":"Nothing"}`).Code)
+
+	// Adding the menu again starts its next version and archives this one
+	w = send("POST", "/api/v1/restaurant/1/menus", "application/x-www-form-urlencoded", "name=Tasting&season=Fall+2024&start=2024-09-01")
+	assert.Equal(t, 201, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.Menus, 1) && assert.Len(t, body.Archive, 1) {
+		assert.Equal(t, "Fall 2024", body.Menus[0].Season)
+		assert.Equal(t, "2024-09-01", body.Archive[0].End)
+		assert.Len(t, body.Archive[0].Courses, 1)
+	}
+	fall := body.Menus[0]
+	// The names of the current menus are the same, so there's nothing new to
+	// record
+	history, _ := store.History(context.Background(), restaurant.ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "menus", history[0].Action)
+		assert.Equal(t, []FieldChange{{"menus", []string{}, []string{"Tasting"}}}, history[0].Changes)
+	}
+
+	// Updating keeps what the body leaves out, and courses sent replace them
+	path := fmt.Sprintf("/api/v1/restaurant/1/menus/%d", fall.ID)
+	w = send("PATCH", path, "application/json", `{"courses":[{"dishes":[{"name":"Garden","diets":["vegetarian"]}]}]}`)
+	assert.Equal(t, 200, w.Code)
+	var menu Menu
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &menu))
+	assert.Equal(t, "Fall 2024", menu.Season)
+	assert.Equal(t, []Course{{Dishes: []Dish{{Name: "Garden", Diets: []string{"vegetarian"}, Allergens: []string{}}}}}, menu.Courses)
+	w = send("PATCH", path, "application/x-www-form-urlencoded", "kind=buffet")
+	assert.Equal(t, 422, w.Code)
+	assert.Equal(t, 404, send("PATCH", fmt.Sprintf("/api/v1/restaurant/1/menus/%d", fall.ID+1), "application/json", `{}`).Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants?diet=vegetarian", nil))
+	assert.Contains(t, w.Body.String(), "Alinea")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants?dish=truffle", nil))
+	assert.NotContains(t, w.Body.String(), "Alinea")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<mark>vegetarian</mark>")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1", nil))
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`/menus/%d"`, fall.ID))
+
+	archive := path + "/archive"
+	assert.Equal(t, 422, send("POST", archive, "application/x-www-form-urlencoded", "date=2024-08-01").Code)
+	assert.Equal(t, 422, send("POST", archive, "application/x-www-form-urlencoded", "date=2999-01-01").Code)
+	w = send("POST", archive, "application/x-www-form-urlencoded", "date=2024-12-01")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"menus":[]`)
+	assert.Equal(t, 404, send("POST", archive, "application/x-www-form-urlencoded", "").Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1/menus", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "No menus are being served")
+	assert.Contains(t, w.Body.String(), `<time datetime="2024-12-01">2024-12-01</time>`)
+
+	assert.Equal(t, 200, send("DELETE", path, "", "").Code)
+	assert.Equal(t, 404, send("DELETE", path, "", "").Code)
+	assert.Equal(t, 404, send("GET", path, "", "").Code)
+}
+
+func TestRestaurantPhotos(t *testing.T) {
+	store, restaurant := seedStore(t)
+	router := setupRouter(store, newLocalPhotoStorage(t.TempDir()), nil)
+
+	upload := func(path string, files map[string][]byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, data := range files {
+			part, _ := form.CreateFormFile("photo", name)
+			part.Write(data)
+		}
+		form.Close()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Files are judged by their content, and none is stored unless all are
+	// images
+	w := upload("/api/v1/restaurant/1/photos", map[string][]byte{"menu.png": []byte("%PDF-1.4"), "room.png": testPNG(t, 10, 10)})
+	assert.Equal(t, 415, w.Code)
+	w = upload("/api/v1/restaurant/1/photos", map[string][]byte{"room.png": testPNG(t, 10, 10)[:60]})
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"photo"`)
+	assert.Equal(t, 400, upload("/api/v1/restaurant/1/photos", nil).Code)
+	assert.Equal(t, 404, upload("/api/v1/restaurant/9/photos", map[string][]byte{"room.png": testPNG(t, 10, 10)}).Code)
+
+	w = upload("/api/v1/restaurant/1/photos", map[string][]byte{"room.png": testPNG(t, 600, 400)})
+	assert.Equal(t, 201, w.Code)
+	assert.Equal(t, `"2-json"`, w.Header().Get("ETag"))
+	var body struct {
+		Photos []Photo `json:"photos"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if !assert.Len(t, body.Photos, 1) {
+		return
+	}
+	photo := body.Photos[0]
+
+	saved, _ := store.Get(context.Background(), restaurant.ID)
+	assert.Equal(t, []string{photo.URL}, saved.Photos)
+	history, _ := store.History(context.Background(), restaurant.ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "photos", history[0].Action)
+	}
+
+	// The same photo again isn't added twice
+	assert.Equal(t, 201, upload("/api/v1/restaurant/1/photos", map[string][]byte{"again.png": testPNG(t, 600, 400)}).Code)
+	saved, _ = store.Get(context.Background(), restaurant.ID)
+	assert.Len(t, saved.Photos, 1)
+
+	for path, contentType := range map[string]string{
+		photo.URL:           "image/png",
+		photo.Thumbnail:     "image/png",
+		photo.ThumbnailWebP: "image/webp",
+		photo.LargeWebP:     "image/webp",
+	} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, 200, w.Code, path)
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, photoCacheControl, w.Header().Get("Cache-Control"))
+		assert.Equal(t, strconv.Itoa(w.Body.Len()), w.Header().Get("Content-Length"))
+
+		w2 := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+		router.ServeHTTP(w2, req)
+		assert.Equal(t, 304, w2.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/photos/restaurants/1/0123456789abcdef.png", nil))
+	assert.Equal(t, 404, w.Code)
+	assert.Empty(t, w.Header().Get("Cache-Control"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/photos/../main.go", nil))
+	assert.Equal(t, 404, w.Code)
+
+	// The restaurant page shows the gallery, with WebP for browsers that
+	// take it
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurant/1", nil))
+	assert.Contains(t, w.Body.String(), `<source srcset="http://localhost:8083`+photo.ThumbnailWebP+`" type="image/webp">`)
+
+	// Without storage there is nowhere to put uploads
+	w = httptest.NewRecorder()
+	setupRouter(store, nil, nil).ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/restaurant/1/photos", nil))
+	assert.Equal(t, 503, w.Code)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUnsupportedBody is returned by bindRestaurant for a request body in a
+// format it can't decode
+var errUnsupportedBody = errors.New("send the restaurant as application/json, application/x-www-form-urlencoded or multipart/form-data, " +
+	"or a patch as application/merge-patch+json or application/json-patch+json")
+
+// restaurantFields maps the JSON name of every Restaurant field to its index
+// in the struct. Form posts use the same names as JSON bodies.
+var restaurantFields = map[string]int{}
+
+func init() {
+	t := reflect.TypeOf(Restaurant{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		restaurantFields[name] = i
+	}
+}
+
+// bindRestaurant decodes the request body into restaurant according to its
+// Content-Type. Fields the body doesn't mention keep the value they already
+// had, which lets updates send only what changes, and the two patch formats
+// are applied to the restaurant as it stands. The ID, version, chefs and
+// DeletedAt are never taken from the body; chefs change through their links.
+//
+// With ?strict=true, fields that aren't part of Restaurant are reported as
+// errors instead of being ignored. Problems with single fields come back as
+// field errors; the error is only set when the body can't be read, or is a
+// patch that can't be applied.
+func bindRestaurant(c *gin.Context, restaurant *Restaurant) ([]FieldError, error) {
+	strict, _ := strconv.ParseBool(c.Query("strict"))
+	id, version, chefs, deletedAt := restaurant.ID, restaurant.Version, restaurant.Chefs, restaurant.DeletedAt
+	defer func() {
+		restaurant.ID, restaurant.Version, restaurant.Chefs, restaurant.DeletedAt = id, version, chefs, deletedAt
+	}()
+
+	switch c.ContentType() {
+	case gin.MIMEJSON:
+		decoder := json.NewDecoder(c.Request.Body)
+		if strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(restaurant); err != nil {
+			return []FieldError{jsonFieldError(err)}, nil
+		}
+		return nil, nil
+	case gin.MIMEPOSTForm:
+		if err := c.Request.ParseForm(); err != nil {
+			return nil, fmt.Errorf("reading form: %w", err)
+		}
+		return bindForm(restaurant, c.Request.PostForm, strict), nil
+	case gin.MIMEMultipartPOSTForm:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("reading multipart form: %w", err)
+		}
+		return bindForm(restaurant, form.Value, strict), nil
+	case mimeMergePatch, mimeJSONPatch:
+		return patchRestaurant(restaurant, c.Request.Body, c.ContentType(), strict)
+	}
+	return nil, errUnsupportedBody
+}
+
+// bindForm sets the fields of restaurant from form values. The update form
+// on the list page names its fields updateName, updateStars and so on, so
+// that prefix is accepted as well.
+func bindForm(restaurant *Restaurant, form map[string][]string, strict bool) []FieldError {
+	var errs []FieldError
+	value := reflect.ValueOf(restaurant).Elem()
+	for key, values := range form {
+		name := formFieldName(key)
+		index, ok := restaurantFields[name]
+		if !ok {
+			if strict {
+				errs = append(errs, FieldError{key, "is not a restaurant field"})
+			}
+			continue
+		}
+		if name == "id" || name == "version" || name == "chefs" || name == "deleted_at" || len(values) == 0 {
+			continue
+		}
+
+		field := value.Field(index)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(values[0])
+		case reflect.Int:
+			text := strings.TrimSpace(values[0])
+			if text == "" {
+				continue
+			}
+			number, err := strconv.Atoi(text)
+			if err != nil {
+				errs = append(errs, FieldError{name, "must be a number"})
+				continue
+			}
+			field.SetInt(int64(number))
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(append([]string{}, values...)))
+		case reflect.Pointer:
+			// Structured fields such as the schedule are posted as JSON, as
+			// are the coordinates, which are numbers, and a blank one clears
+			// the field
+			text := strings.TrimSpace(values[0])
+			if text == "" {
+				field.Set(reflect.Zero(field.Type()))
+				continue
+			}
+			fresh := reflect.New(field.Type().Elem())
+			if err := json.Unmarshal([]byte(text), fresh.Interface()); err != nil {
+				if field.Type().Elem().Kind() == reflect.Float64 {
+					errs = append(errs, FieldError{name, "must be a number"})
+				} else {
+					errs = append(errs, FieldError{name, "must be a JSON object"})
+				}
+				continue
+			}
+			field.Set(fresh)
+		}
+	}
+
+	// Map order is random, so sort the errors to keep responses stable
+	sortFieldErrors(errs)
+	return errs
+}
+
+// formFieldName turns a form key such as updateStars into the JSON name of
+// the field it sets
+func formFieldName(key string) string {
+	rest, ok := strings.CutPrefix(key, "update")
+	if !ok || rest == "" || !unicode.IsUpper(rune(rest[0])) {
+		return key
+	}
+	return strings.ToLower(rest[:1]) + rest[1:]
+}
+
+// sortFieldErrors orders field errors by the position of their field in
+// Restaurant, with unknown fields last in name order. Errors in nested
+// fields such as schedule.time_zone sort with the field they are in.
+func sortFieldErrors(errs []FieldError) {
+	position := func(e FieldError) int {
+		name, _, _ := strings.Cut(e.Field, ".")
+		if index, ok := restaurantFields[name]; ok {
+			return index
+		}
+		return len(restaurantFields)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if position(errs[i]) != position(errs[j]) {
+			return position(errs[i]) < position(errs[j])
+		}
+		return errs[i].Field < errs[j].Field
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormFieldName(t *testing.T) {
+	assert.Equal(t, "name", formFieldName("name"))
+	assert.Equal(t, "stars", formFieldName("updateStars"))
+	assert.Equal(t, "staff", formFieldName("updateStaff"))
+	assert.Equal(t, "updated", formFieldName("updated"))
+	assert.Equal(t, "update", formFieldName("update"))
+}
+
+func TestBindForm(t *testing.T) {
+	restaurant := Restaurant{ID: 4, Name: "Alinea", Stars: 3, Chef: "Grant Achatz"}
+	errs := bindForm(&restaurant, map[string][]string{
+		"updateId": {"9"},
+		"name":     {"Next"},
+		"stars":    {""},
+		"staff":    {"Dave Beran", "Jenner Tomaska"},
+		"cuisine":  {"American"},
+	}, false)
+	assert.Empty(t, errs)
+	assert.Equal(t, Restaurant{
+		ID:    4,
+		Name:  "Next",
+		Stars: 3,
+		Chef:  "Grant Achatz",
+		Staff: []string{"Dave Beran", "Jenner Tomaska"},
+	}, restaurant)
+
+	errs = bindForm(&restaurant, map[string][]string{"cuisine": {"American"}, "stars": {"three"}}, true)
+	assert.Equal(t, []FieldError{
+		{"stars", "must be a number"},
+		{"cuisine", "is not a restaurant field"},
+	}, errs)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Bulk import formats
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// collectionSeparator joins the entries of staff, photos and menus in a
+// single CSV cell
+const collectionSeparator = ";"
+
+// csvColumns are the CSV header names of the restaurant fields, matching
+// their JSON names. The id, chefs, version, address_parts and deleted_at
+// columns are accepted but ignored, since imported restaurants always get
+// new IDs, chefs are linked to them through the chef's own links, and the
+// rest are worked out by the store.
+var csvColumns = []string{
+	"id", "name", "stars", "address", "state", "hours", "schedule",
+	"chef", "chefs", "staff", "photos", "website", "info", "menus",
+	"latitude", "longitude", "version", "address_parts", "deleted_at",
+}
+
+// ImportRowError lists what is wrong with one row of an import. Line is the
+// line of the input file that the row starts on.
+type ImportRowError struct {
+	Line   int          `json:"line"`
+	Errors []FieldError `json:"errors"`
+}
+
+// ImportReport is the outcome of a bulk import. Nothing is imported unless
+// every row is valid, so Imported is either zero or Rows.
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Rows     int              `json:"rows"`
+	Imported int              `json:"imported"`
+	IDs      []int            `json:"ids"`
+	Errors   []ImportRowError `json:"errors"`
+
+	// restaurants are the imported restaurants with their new IDs
+	restaurants []Restaurant
+}
+
+// importRow is one parsed row of an import and the errors found in it
+type importRow struct {
+	line       int
+	restaurant Restaurant
+	errs       []FieldError
+}
+
+// importFormatFromContentType picks the import format for a request body
+func importFormatFromContentType(contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return formatCSV, nil
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines":
+		return formatJSONL, nil
+	}
+	return "", fmt.Errorf("unsupported import content type %q, use text/csv or application/x-ndjson", contentType)
+}
+
+// importFormatFromFilename picks the import format for a file by extension
+func importFormatFromFilename(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return formatCSV, nil
+	case ".jsonl", ".ndjson":
+		return formatJSONL, nil
+	}
+	return "", fmt.Errorf("cannot tell the import format of %q, use a .csv or .jsonl file", name)
+}
+
+// parseImport reads every row of an import. It only returns an error when the
+// input as a whole can't be read; problems with single rows are recorded on
+// the rows.
+func parseImport(r io.Reader, format string) ([]importRow, error) {
+	switch format {
+	case formatCSV:
+		return parseCSV(r)
+	case formatJSONL:
+		return parseJSONL(r)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+func parseCSV(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, column := range csvColumns {
+		known[column] = true
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+
+		// A row that can't be parsed has no field positions, and its error
+		// already says which line it is on
+		row := importRow{}
+		switch {
+		case errors.Is(err, csv.ErrFieldCount):
+			row.line = parseErr.StartLine
+			row.errs = append(row.errs, FieldError{"row", fmt.Sprintf("has %d fields, the header has %d", len(record), len(header))})
+		case err != nil:
+			row.line = parseErr.StartLine
+			row.errs = append(row.errs, FieldError{"row", "is not valid CSV: " + parseErr.Err.Error()})
+		default:
+			row.line, _ = reader.FieldPos(0)
+		}
+		if err != nil {
+			rows = append(rows, row)
+			continue
+		}
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		list := func(name string) []string {
+			values := []string{}
+			for _, value := range strings.Split(cell(name), collectionSeparator) {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+			return values
+		}
+
+		row.restaurant = Restaurant{
+			Name:    cell("name"),
+			Address: cell("address"),
+			State:   cell("state"),
+			Hours:   cell("hours"),
+			Chef:    cell("chef"),
+			Staff:   list("staff"),
+			Photos:  list("photos"),
+			Website: cell("website"),
+			Info:    cell("info"),
+			Menus:   list("menus"),
+		}
+		if schedule := cell("schedule"); schedule != "" {
+			if err := json.Unmarshal([]byte(schedule), &row.restaurant.Schedule); err != nil {
+				row.errs = append(row.errs, FieldError{"schedule", "must be a JSON object"})
+			}
+		}
+		for _, coordinate := range []struct {
+			name  string
+			field **float64
+		}{
+			{"latitude", &row.restaurant.Latitude},
+			{"longitude", &row.restaurant.Longitude},
+		} {
+			if text := cell(coordinate.name); text != "" {
+				value, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					row.errs = append(row.errs, FieldError{coordinate.name, "must be a number"})
+					continue
+				}
+				*coordinate.field = &value
+			}
+		}
+		if stars := cell("stars"); stars != "" {
+			row.restaurant.Stars, err = strconv.Atoi(stars)
+			if err != nil {
+				row.errs = append(row.errs, FieldError{"stars", "must be a number"})
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseJSONL(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []importRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row.restaurant); err != nil {
+			row.errs = append(row.errs, jsonFieldError(err))
+		}
+		row.restaurant.ID, row.restaurant.Chefs = 0, nil
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading JSON Lines: %w", err)
+	}
+	return rows, nil
+}
+
+// jsonFieldError turns an error from decoding a restaurant into the field it
+// is about, where encoding/json says which one that is
+func jsonFieldError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return FieldError{typeErr.Field, "must be " + jsonTypeName(typeErr.Type)}
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{strings.Trim(field, `"`), "is not a restaurant field"}
+	}
+	return FieldError{"body", "is not valid JSON: " + err.Error()}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "a list of " + strings.TrimPrefix(jsonTypeName(t.Elem()), "a ") + "s"
+	}
+	return "a " + t.String()
+}
+
+// importRestaurants validates every row and, unless this is a dry run or a
+// row is invalid, geocodes the rows without coordinates and creates all of
+// the restaurants in a single transaction
+func importRestaurants(ctx context.Context, store RestaurantStore, geocoder Geocoder, rows []importRow, dryRun bool) (ImportReport, error) {
+	report := ImportReport{
+		DryRun: dryRun,
+		Rows:   len(rows),
+		IDs:    []int{},
+		Errors: []ImportRowError{},
+	}
+
+	restaurants := make([]Restaurant, len(rows))
+	for i, row := range rows {
+		normalizeRestaurant(&row.restaurant)
+		errs := append(row.errs, validateRestaurant(row.restaurant)...)
+		if len(errs) > 0 {
+			report.Errors = append(report.Errors, ImportRowError{Line: row.line, Errors: errs})
+		}
+		restaurants[i] = row.restaurant
+	}
+	if dryRun || len(report.Errors) > 0 || len(restaurants) == 0 {
+		return report, nil
+	}
+	for i := range restaurants {
+		if err := geocodeRestaurant(ctx, geocoder, Restaurant{}, &restaurants[i]); err != nil {
+			return report, err
+		}
+	}
+
+	ids, err := store.CreateAll(ctx, restaurants)
+	if err != nil {
+		return report, err
+	}
+	report.Imported = len(ids)
+	report.IDs = ids
+	for i, id := range ids {
+		restaurants[i].ID = id
+		restaurants[i].Version = 1
+	}
+	report.restaurants = restaurants
+	return report, nil
+}
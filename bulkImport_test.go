@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	rows, err := parseImport(strings.NewReader(
+		"name,stars,address,state,staff\n"+
+			"Alinea,3,\"1723 N Halsted St, Chicago, IL 60614\",IL,Grant Achatz; Nick Kokonas\n"+
+			"Smyth,two,\"177 N Ada St, Chicago, IL 60607\",IL,\n"+
+			"Oriole,2\n",
+	), formatCSV)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, 2, rows[0].line)
+		assert.Equal(t, "1723 N Halsted St, Chicago, IL 60614", rows[0].restaurant.Address)
+		assert.Equal(t, []string{"Grant Achatz", "Nick Kokonas"}, rows[0].restaurant.Staff)
+		assert.Empty(t, rows[0].errs)
+
+		assert.Equal(t, []FieldError{{"stars", "must be a number"}}, rows[1].errs)
+		assert.Equal(t, "row", rows[2].errs[0].Field)
+	}
+
+	_, err = parseImport(strings.NewReader("name,rating\n"), formatCSV)
+	assert.ErrorContains(t, err, `unknown CSV column "rating"`)
+
+	// A malformed row is reported on its own line, and the rows after it
+	// are still read
+	rows, err = parseImport(strings.NewReader("name,stars\nAlinea,3\nSmyth \"Chicago\",2\nOriole,2\n"), formatCSV)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Empty(t, rows[0].errs)
+		assert.Equal(t, 3, rows[1].line)
+		assert.Equal(t, []FieldError{{"row", "is not valid CSV: " + csv.ErrBareQuote.Error()}}, rows[1].errs)
+		assert.Equal(t, 4, rows[2].line)
+		assert.Equal(t, "Oriole", rows[2].restaurant.Name)
+		assert.Empty(t, rows[2].errs)
+	}
+}
+
+func TestParseJSONL(t *testing.T) {
+	rows, err := parseImport(strings.NewReader(
+		`{"id":7,"name":"Alinea","stars":3,"address":"1723 N Halsted St"}`+"\n\n"+
+			`{"name":"Smyth","stars":"two"}`+"\n"+
+			`{"name":"Oriole","rating":2}`+"\n",
+	), formatJSONL)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, 0, rows[0].restaurant.ID)
+		assert.Empty(t, rows[0].errs)
+		assert.Equal(t, 3, rows[1].line)
+		assert.Equal(t, []FieldError{{"stars", "must be a number"}}, rows[1].errs)
+		assert.Equal(t, []FieldError{{"rating", "is not a restaurant field"}}, rows[2].errs)
+	}
+}
+
+func TestImportRestaurants(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	valid := []importRow{
+		{line: 1, restaurant: Restaurant{Name: "Alinea", Stars: 3, Address: "1723 N Halsted St"}},
+		{line: 2, restaurant: Restaurant{Name: "Smyth", Stars: 2, Address: "177 N Ada St"}},
+	}
+
+	report, err := importRestaurants(ctx, store, nil, valid, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Imported)
+	_, total, _ := store.List(ctx, ListOptions{})
+	assert.Equal(t, 0, total)
+
+	invalid := append(valid, importRow{line: 3, restaurant: Restaurant{Stars: 4, Address: "x"}})
+	report, err = importRestaurants(ctx, store, nil, invalid, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, []ImportRowError{{Line: 3, Errors: []FieldError{
+		{"name", "is required"},
+		{"stars", "must be at most 3"},
+	}}}, report.Errors)
+
+	report, err = importRestaurants(ctx, store, nil, valid, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, []int{1, 2}, report.IDs)
+}
@@ -0,0 +1,82 @@
+package main
+
+import "strings"
+
+// defaultChefRole is the role of a chef linked to a restaurant without one
+const defaultChefRole = "head chef"
+
+// actionChefs is the history action of a change to the chefs a restaurant
+// shows, through a chef's links or name
+const actionChefs = "chefs"
+
+// Chef is a chef document. Restaurants lists where the chef works or has
+// worked; it is read only here and changes through the chef's links.
+type Chef struct {
+	ID          int        `json:"id" form:"-"`
+	Name        string     `json:"name" form:"name" binding:"required"`
+	Bio         string     `json:"bio" form:"bio"`
+	Photo       string     `json:"photo" form:"photo"`
+	Restaurants []ChefLink `json:"restaurants" form:"-"`
+}
+
+// ChefLink is a chef's role at a restaurant, with the dates they started and
+// left. Either date is empty when it isn't known, and End is empty while the
+// chef is still there. The names come from the chef and the restaurant and
+// are only filled in when a link is read.
+type ChefLink struct {
+	ChefID         int    `json:"chef_id" form:"-"`
+	ChefName       string `json:"chef" form:"-"`
+	RestaurantID   int    `json:"restaurant_id" form:"restaurant_id" binding:"required"`
+	RestaurantName string `json:"restaurant" form:"-"`
+	Role           string `json:"role" form:"role"`
+	Start          string `json:"start" form:"start" binding:"omitempty,datetime=2006-01-02"`
+	End            string `json:"end" form:"end" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// Current reports whether the chef still holds the role
+func (link ChefLink) Current() bool {
+	return link.End == ""
+}
+
+// HeadChefID returns the ID of the linked chef that the restaurant's Chef
+// name refers to, so templates can link the name to the chef's page. It
+// falls back to a current head chef, and is zero when there is neither.
+func (r Restaurant) HeadChefID() int {
+	fallback := 0
+	for _, link := range r.Chefs {
+		if strings.EqualFold(link.ChefName, r.Chef) {
+			return link.ChefID
+		}
+		if fallback == 0 && link.Role == defaultChefRole && link.Current() {
+			fallback = link.ChefID
+		}
+	}
+	return fallback
+}
+
+// normalizeChef trims the text fields of a chef
+func normalizeChef(chef *Chef) {
+	chef.Name = strings.Join(strings.Fields(chef.Name), " ")
+	chef.Bio = strings.TrimSpace(chef.Bio)
+	chef.Photo = strings.TrimSpace(chef.Photo)
+}
+
+// normalizeChefLink trims the dates and lower-cases the role, which defaults
+// to head chef
+func normalizeChefLink(link *ChefLink) {
+	link.Role = strings.ToLower(strings.Join(strings.Fields(link.Role), " "))
+	if link.Role == "" {
+		link.Role = defaultChefRole
+	}
+	link.Start = strings.TrimSpace(link.Start)
+	link.End = strings.TrimSpace(link.End)
+}
+
+// validateChefLink checks what the binding rules can't: that the chef
+// didn't leave before they started
+func validateChefLink(link ChefLink) []FieldError {
+	if link.Start != "" && link.End != "" && link.End < link.Start {
+		return []FieldError{{"end", "must not be before start"}}
+	}
+	return nil
+}
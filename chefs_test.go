@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeadChefID(t *testing.T) {
+	restaurant := Restaurant{Chef: "grant achatz", Chefs: []ChefLink{
+		{ChefID: 2, ChefName: "Simon Davies", Role: "head chef", End: "2019-05-01"},
+		{ChefID: 3, ChefName: "Mike Bagale", Role: "head chef"},
+		{ChefID: 1, ChefName: "Grant Achatz", Role: "owner"},
+	}}
+	assert.Equal(t, 1, restaurant.HeadChefID())
+
+	// Without a match on the name, the current head chef is linked
+	restaurant.Chef = "G. Achatz"
+	assert.Equal(t, 3, restaurant.HeadChefID())
+
+	assert.Zero(t, Restaurant{Chef: "Grant Achatz"}.HeadChefID())
+}
+
+func TestNormalizeChefLink(t *testing.T) {
+	link := ChefLink{Role: "  Pastry   CHEF ", Start: " 2020-01-01 "}
+	normalizeChefLink(&link)
+	assert.Equal(t, ChefLink{Role: "pastry chef", Start: "2020-01-01"}, link)
+
+	link = ChefLink{}
+	normalizeChefLink(&link)
+	assert.Equal(t, defaultChefRole, link.Role)
+}
+
+func TestValidateChefLink(t *testing.T) {
+	assert.Empty(t, validateChefLink(ChefLink{Start: "2020-01-01", End: "2020-01-01"}))
+	assert.Empty(t, validateChefLink(ChefLink{End: "2020-01-01"}))
+	assert.Equal(t, []FieldError{{"end", "must not be before start"}},
+		validateChefLink(ChefLink{Start: "2020-01-01", End: "2019-12-31"}))
+}
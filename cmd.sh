@@ -1,29 +1,6 @@
-# Restaurant 1
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Eleven Madison Park","stars":3,"address":"11 Madison Ave, New York, NY 10010","chef":""}' http://localhost:8080/api/v1/restaurants/create
+# Load the seed restaurants in one transaction. Add ?dry_run=true to only
+# validate them.
+curl -X POST -H "Content-Type: application/x-ndjson" --data-binary @seed/restaurants.jsonl http://localhost:8083/api/v1/restaurants/import
 
-# Restaurant 2
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Alinea","stars":3,"address":"1723 N Halsted St, Chicago, IL 60614","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 3
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Atelier Crenn","stars":3,"address":"3127 Fillmore St, San Francisco, CA 94123","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 4
-curl -X POST -H "Content-Type: application/json" -d '{"name":"The Inn at Little Washington","stars":3,"address":"309 Middle St, Washington, VA 22747","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 5
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Le Bernardin","stars":3,"address":"155 W 51st St, New York, NY 10019","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 6
-curl -X POST -H "Content-Type: application/json" -d '{"name":"The French Laundry","stars":3,"address":"6640 Washington St, Yountville, CA 94599","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 7
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Per Se","stars":3,"address":"10 Columbus Cir, New York, NY 10019","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 8
-curl -X POST -H "Content-Type: application/json" -d '{"name":"SingleThread","stars":3,"address":"131 North St, Healdsburg, CA 95448","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 9
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Masa","stars":3,"address":"10 Columbus Cir, New York, NY 10019","chef":""}' http://localhost:8080/api/v1/restaurants/create
-
-# Restaurant 10
-curl -X POST -H "Content-Type: application/json" -d '{"name":"Saison","stars":3,"address":"178 Townsend St, San Francisco, CA 94107","chef":""}' http://localhost:8080/api/v1/restaurants/create
+# The same import from the command line, without a running server:
+#   DB=restaurants.db ./bumped import seed/restaurants.jsonl
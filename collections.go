@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// restaurantCollection describes a child table that stores one of the list
+// fields of Restaurant. Each entry is a row keyed by the restaurant id, and
+// the position column keeps the entries in the order they were written.
+type restaurantCollection struct {
+	table  string
+	column string
+	field  func(r *Restaurant) *[]string
+}
+
+var restaurantCollections = []restaurantCollection{
+	{
+		table:  "restaurant_photos",
+		column: "url",
+		field:  func(r *Restaurant) *[]string { return &r.Photos },
+	},
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// loadCollections fills the Staff, Photos, Menus and Chefs fields of every
+// restaurant in the slice with one query per child table. Staff are the
+// names of the current staff, in the order they joined, and Menus the names
+// of the current menus, in the order they were added.
+func loadCollections(ctx context.Context, q queryer, restaurants []Restaurant) error {
+	if len(restaurants) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Restaurant, len(restaurants))
+	placeholders := make([]string, len(restaurants))
+	ids := make([]any, len(restaurants))
+	for i := range restaurants {
+		byID[restaurants[i].ID] = &restaurants[i]
+		placeholders[i] = "?"
+		ids[i] = restaurants[i].ID
+		for _, collection := range restaurantCollections {
+			*collection.field(&restaurants[i]) = []string{}
+		}
+		restaurants[i].Staff = []string{}
+		restaurants[i].Menus = []string{}
+		restaurants[i].Chefs = []ChefLink{}
+	}
+
+	for _, collection := range restaurantCollections {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(
+			`SELECT restaurant_id, %s FROM %s
+			 WHERE restaurant_id IN (%s)
+			 ORDER BY restaurant_id, position`,
+			collection.column,
+			collection.table,
+			strings.Join(placeholders, ", "),
+		), ids...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var restaurantID int
+			var value string
+			if err := rows.Scan(&restaurantID, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			field := collection.field(byID[restaurantID])
+			*field = append(*field, value)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for table, field := range map[string]func(r *Restaurant) *[]string{
+		"staff_members": func(r *Restaurant) *[]string { return &r.Staff },
+		"menus":         func(r *Restaurant) *[]string { return &r.Menus },
+	} {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(
+			`SELECT restaurant_id, name FROM %s
+			 WHERE restaurant_id IN (%s) AND end_date = ''
+			 ORDER BY restaurant_id, id`,
+			table,
+			strings.Join(placeholders, ", "),
+		), ids...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var restaurantID int
+			var name string
+			if err := rows.Scan(&restaurantID, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			names := field(byID[restaurantID])
+			*names = append(*names, name)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	links, err := queryChefLinks(ctx, q,
+		fmt.Sprintf(`restaurant_chefs.restaurant_id IN (%s)`, strings.Join(placeholders, ", ")), ids...)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		restaurant := byID[link.RestaurantID]
+		restaurant.Chefs = append(restaurant.Chefs, link)
+	}
+	return nil
+}
+
+// saveCollection replaces every entry of one collection of a restaurant
+func saveCollection(ctx context.Context, tx execer, collection restaurantCollection, restaurantID int, values []string) error {
+	_, err := tx.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE restaurant_id = ?`, collection.table),
+		restaurantID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for position, value := range values {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`INSERT INTO %s (restaurant_id, position, %s) VALUES (?, ?, ?)`,
+				collection.table, collection.column),
+			restaurantID,
+			position,
+			value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCollections replaces the photos of a restaurant with the ones in the
+// given document, and brings its current staff and menus in line with the
+// document's
+func saveCollections(ctx context.Context, tx execer, restaurantID int, restaurant Restaurant) error {
+	for _, collection := range restaurantCollections {
+		values := *collection.field(&restaurant)
+		if err := saveCollection(ctx, tx, collection, restaurantID, values); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if err := saveStaff(ctx, tx, restaurantID, restaurant.Staff, now); err != nil {
+		return err
+	}
+	return saveMenus(ctx, tx, restaurantID, restaurant.Menus, now)
+}
+
+// saveStaff retires the current staff of a restaurant whose names aren't in
+// the list as of today, and adds the names that aren't current staff yet
+// without a role or dates
+func saveStaff(ctx context.Context, tx execer, restaurantID int, names []string, now time.Time) error {
+	args := []any{now.Format(time.DateOnly), restaurantID}
+	placeholders := []string{}
+	for _, name := range names {
+		args = append(args, name)
+		placeholders = append(placeholders, "?")
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE staff_members SET end_date = ?
+		 WHERE restaurant_id = ? AND end_date = '' AND name NOT IN (%s)`,
+		strings.Join(placeholders, ", "),
+	), args...)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO staff_members (restaurant_id, name)
+			 SELECT ?, ? WHERE NOT EXISTS (
+				SELECT 1 FROM staff_members WHERE restaurant_id = ? AND name = ? AND end_date = ''
+			 )`,
+			restaurantID, name, restaurantID, name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveMenus archives the current menus of a restaurant whose names aren't in
+// the list as of today, and adds the names that aren't current menus yet as
+// menus without courses or dates
+func saveMenus(ctx context.Context, tx execer, restaurantID int, names []string, now time.Time) error {
+	args := []any{now.Format(time.DateOnly), restaurantID}
+	placeholders := []string{}
+	for _, name := range names {
+		args = append(args, name)
+		placeholders = append(placeholders, "?")
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE menus SET end_date = ?
+		 WHERE restaurant_id = ? AND end_date = '' AND name NOT IN (%s)`,
+		strings.Join(placeholders, ", "),
+	), args...)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO menus (restaurant_id, name)
+			 SELECT ?, ? WHERE NOT EXISTS (
+				SELECT 1 FROM menus WHERE restaurant_id = ? AND name = ? AND end_date = ''
+			 )`,
+			restaurantID, name, restaurantID, name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
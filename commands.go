@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jcardarelli/fancy-api/migrations"
+)
+
+// runCommand runs a maintenance subcommand against the database instead of
+// starting the server
+func runCommand(db *sql.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(db, args[1:])
+	case "import":
+		return importCommand(db, args[1:])
+	case "geocode":
+		return geocodeCommand(db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// migrateCommand handles `migrate up`, `migrate down <version>` and
+// `migrate version`
+func migrateCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down <version> | version")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrations.Up(db)
+	case "down":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate down <version>")
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrations.Down(db, target)
+	case "version":
+		version, err := migrations.Version(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("database version %d, binary version %d\n", version, migrations.Latest())
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// importCommand handles `import [-dry-run] [-format csv|jsonl] <file>`. It
+// prints the import report and fails if any row was invalid.
+func importCommand(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without importing it")
+	format := flags.String("format", "", "csv or jsonl, instead of going by the file extension")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-dry-run] [-format csv|jsonl] <file>")
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		var err error
+		*format, err = importFormatFromFilename(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := parseImport(file, *format)
+	if err != nil {
+		return err
+	}
+
+	if err := migrations.Up(db); err != nil {
+		return err
+	}
+	geocoder, err := geocoderFromEnv()
+	if err != nil {
+		return err
+	}
+	report, err := importRestaurants(context.Background(), newSQLiteStore(db), geocoder, rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d rows are invalid, nothing was imported", len(report.Errors), report.Rows)
+	}
+	return nil
+}
+
+// geocodeCommand handles `geocode [-all]`. It fills in the coordinates of
+// the restaurants that have none, or of every restaurant with -all, from
+// the gazetteer, and prints a report that lists the addresses it couldn't
+// place.
+func geocodeCommand(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("geocode", flag.ContinueOnError)
+	all := flags.Bool("all", false, "geocode restaurants that already have coordinates too")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("usage: geocode [-all]")
+	}
+
+	geocoder, err := geocoderFromEnv()
+	if err != nil {
+		return err
+	}
+	if geocoder == nil {
+		return fmt.Errorf("no gazetteer to geocode with, set GAZETTEER to a file of ZIP code centroids")
+	}
+	if err := migrations.Up(db); err != nil {
+		return err
+	}
+	report, err := backfillCoordinates(context.Background(), newSQLiteStore(db), geocoder, *all)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// restaurantETag is the entity tag of a restaurant in a given format, which
+// changes whenever the restaurant is updated. The HTML and JSON documents of
+// the same version are different bytes, so like listETag it names the
+// format, and a cache never answers one with the other.
+func restaurantETag(format string, restaurant Restaurant) string {
+	_, subtype, _ := strings.Cut(format, "/")
+	return `"` + strconv.Itoa(restaurant.Version) + "-" + subtype + `"`
+}
+
+// listETag is the entity tag of one page of the restaurant list in a given
+// format. It covers the ID and version of every restaurant on the page, so
+// any change to one of them, or to which restaurants are on it, changes the
+// tag. The tag is weak because it isn't computed from the response bytes.
+func listETag(format string, restaurants []Restaurant, total int) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %d", format, total)
+	for _, restaurant := range restaurants {
+		fmt.Fprintf(hash, " %d.%d", restaurant.ID, restaurant.Version)
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagList splits an If-Match or If-None-Match header into its entity tags
+func etagList(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatch reports whether the If-Match header of the request, if it has one,
+// names the current version of the restaurant, in any of the formats it is
+// offered in. Weak tags never match, as RFC 9110 asks. It responds with 412
+// and the current tag when the header doesn't match.
+func ifMatch(c *gin.Context, restaurant Restaurant) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range etagList(header) {
+		if tag == "*" {
+			return true
+		}
+		for _, format := range offeredFormats {
+			if tag == restaurantETag(format, restaurant) {
+				return true
+			}
+		}
+	}
+	c.Header("ETag", restaurantETag(c.NegotiateFormat(offeredFormats...), restaurant))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Restaurant has changed, fetch it again before saving"})
+	return false
+}
+
+// notModified sets the ETag header and reports whether the If-None-Match
+// header of the request already names it, responding with 304 if it does.
+// Weak and strong tags compare equal here.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Vary", "Accept")
+	for _, tag := range etagList(c.GetHeader("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
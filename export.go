@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Export formats, on top of the bulk import ones
+const (
+	formatJSON = "json"
+	formatXLSX = "xlsx"
+)
+
+// exportBatchSize is how many restaurants an export reads from the store at
+// a time, which bounds how much of the catalog is in memory at once
+const exportBatchSize = 500
+
+// exportContentTypes maps each export format to its media type
+var exportContentTypes = map[string]string{
+	formatCSV:   "text/csv; charset=utf-8",
+	formatJSON:  "application/json; charset=utf-8",
+	formatJSONL: "application/x-ndjson; charset=utf-8",
+	formatXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// exportWriter encodes restaurants one at a time in an export format
+type exportWriter interface {
+	Write(restaurant Restaurant) error
+	Close() error
+}
+
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		return &csvExportWriter{writer}, writer.Write(csvColumns)
+	case formatJSON:
+		_, err := io.WriteString(w, "[")
+		return &jsonExportWriter{w: w}, err
+	case formatJSONL:
+		return &jsonlExportWriter{json.NewEncoder(w)}, nil
+	case formatXLSX:
+		writer, err := newXLSXWriter(w, "Restaurants")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]any, len(csvColumns))
+		for i, column := range csvColumns {
+			header[i] = column
+		}
+		return &xlsxExportWriter{writer}, writer.WriteRow(header)
+	}
+	return nil, fmt.Errorf("unsupported export format %q, use csv, json, jsonl or xlsx", format)
+}
+
+// exportCells returns the fields of a restaurant in csvColumns order, with
+// the entries of each collection joined by collectionSeparator and the
+// schedule, chef links and address parts as JSON documents
+func exportCells(restaurant Restaurant) []any {
+	list := func(values []string) string {
+		return strings.Join(values, collectionSeparator+" ")
+	}
+	schedule := ""
+	if restaurant.Schedule != nil {
+		document, _ := json.Marshal(restaurant.Schedule)
+		schedule = string(document)
+	}
+	chefs := ""
+	if len(restaurant.Chefs) > 0 {
+		document, _ := json.Marshal(restaurant.Chefs)
+		chefs = string(document)
+	}
+	addressParts, _ := json.Marshal(restaurant.AddressParts)
+	deletedAt := ""
+	if restaurant.DeletedAt != nil {
+		deletedAt = restaurant.DeletedAt.Format(time.RFC3339Nano)
+	}
+	return []any{
+		restaurant.ID,
+		restaurant.Name,
+		restaurant.Stars,
+		restaurant.Address,
+		restaurant.State,
+		restaurant.Hours,
+		schedule,
+		restaurant.Chef,
+		chefs,
+		list(restaurant.Staff),
+		list(restaurant.Photos),
+		restaurant.Website,
+		restaurant.Info,
+		list(restaurant.Menus),
+		coordinate(restaurant.Latitude),
+		coordinate(restaurant.Longitude),
+		restaurant.Version,
+		string(addressParts),
+		deletedAt,
+	}
+}
+
+// coordinate is the cell of a latitude or longitude, which is blank when it
+// isn't known
+func coordinate(value *float64) any {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) Write(restaurant Restaurant) error {
+	cells := exportCells(restaurant)
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = fmt.Sprint(cell)
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonExportWriter writes a JSON array one element at a time
+type jsonExportWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (w *jsonExportWriter) Write(restaurant Restaurant) error {
+	document, err := json.Marshal(restaurant)
+	if err != nil {
+		return err
+	}
+	if w.written {
+		if _, err := io.WriteString(w.w, ","); err != nil {
+			return err
+		}
+	}
+	w.written = true
+	_, err = w.w.Write(document)
+	return err
+}
+
+func (w *jsonExportWriter) Close() error {
+	_, err := io.WriteString(w.w, "]\n")
+	return err
+}
+
+type jsonlExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlExportWriter) Write(restaurant Restaurant) error {
+	return w.encoder.Encode(restaurant)
+}
+
+func (w *jsonlExportWriter) Close() error {
+	return nil
+}
+
+type xlsxExportWriter struct {
+	writer *xlsxWriter
+}
+
+func (w *xlsxExportWriter) Write(restaurant Restaurant) error {
+	return w.writer.WriteRow(exportCells(restaurant))
+}
+
+func (w *xlsxExportWriter) Close() error {
+	return w.writer.Close()
+}
+
+// eachRestaurant calls fn for every restaurant that matches the filters and
+// sort order of opts, reading them from the store a batch at a time.
+// opts.Limit and opts.Offset are ignored.
+func eachRestaurant(ctx context.Context, store RestaurantStore, opts ListOptions, fn func(Restaurant) error) error {
+	opts.Limit = exportBatchSize
+	for opts.Offset = 0; ; opts.Offset += exportBatchSize {
+		restaurants, _, err := store.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, restaurant := range restaurants {
+			if err := fn(restaurant); err != nil {
+				return err
+			}
+		}
+		if len(restaurants) < exportBatchSize {
+			return nil
+		}
+	}
+}
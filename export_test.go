@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func exportStore(t *testing.T) *memoryStore {
+	store := newMemoryStore()
+	for _, restaurant := range []Restaurant{
+		{Name: "Alinea", Stars: 3, State: "IL", Address: "1723 N Halsted St, Chicago", Staff: []string{"Grant Achatz", "Nick Kokonas"}},
+		{Name: "Smyth", Stars: 2, State: "IL", Address: "177 N Ada St, Chicago"},
+		{Name: "Saison", Stars: 2, State: "CA", Address: "178 Townsend St, San Francisco", Info: `Wood-fired "open" kitchen`},
+	} {
+		if _, err := store.Create(context.Background(), restaurant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func export(t *testing.T, router http.Handler, query string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/restaurants/export?"+query, nil))
+	return w
+}
+
+func TestExportCSVRoundTrips(t *testing.T) {
+	store := exportStore(t)
+	ctx := context.Background()
+	grant, _ := store.CreateChef(ctx, Chef{Name: "Grant Achatz"})
+	store.LinkChef(ctx, ChefLink{ChefID: grant.ID, RestaurantID: 1, Role: "head chef", Start: "2005-05-04"})
+	w := export(t, setupRouter(store, nil, nil), "format=csv&state=IL")
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `attachment; filename="restaurants.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), `"[{""chef_id"":1,""chef"":""Grant Achatz"",""restaurant_id"":1`)
+
+	// The version and address parts are exported like the JSON has them
+	assert.Contains(t, w.Body.String(), `,2,"{""street"":""1723 N Halsted St"",""city"":""Chicago"",""state"":""IL""`)
+
+	// Import leaves the chef links out, as they belong to the chefs
+	rows, err := parseImport(w.Body, formatCSV)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		alinea, _ := store.Get(context.Background(), 1)
+		alinea.ID, alinea.Version, alinea.Chefs, alinea.AddressParts = 0, 0, nil, AddressParts{}
+		assert.Equal(t, alinea, rows[0].restaurant)
+		assert.Equal(t, "Smyth", rows[1].restaurant.Name)
+	}
+}
+
+func TestExportJSONAndJSONL(t *testing.T) {
+	router := setupRouter(exportStore(t), nil, nil)
+
+	var restaurants []Restaurant
+	w := export(t, router, "format=json&sort=-name")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &restaurants))
+	if assert.Len(t, restaurants, 3) {
+		assert.Equal(t, "Smyth", restaurants[0].Name)
+		assert.Equal(t, []string{"Grant Achatz", "Nick Kokonas"}, restaurants[2].Staff)
+	}
+
+	w = export(t, router, "format=jsonl&stars>=3")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"name":"Alinea"`)
+
+	w = export(t, router, "format=pdf")
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestExportXLSX(t *testing.T) {
+	w := export(t, setupRouter(exportStore(t), nil, nil), "format=xlsx")
+	assert.Equal(t, 200, w.Code)
+
+	body := w.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.NoError(t, err)
+	var sheet string
+	for _, file := range archive.File {
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			reader, _ := file.Open()
+			content, _ := io.ReadAll(reader)
+			sheet = string(content)
+		}
+	}
+	assert.Contains(t, sheet, `<c r="B1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="C2"><v>3</v></c>`)
+	assert.Contains(t, sheet, `Wood-fired &#34;open&#34; kitchen`)
+	assert.Contains(t, sheet, `<row r="4">`)
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAddressNotFound is returned by a Geocoder that can't place an address
+var ErrAddressNotFound = errors.New("address not found")
+
+// Geocoder turns the address and state of a restaurant into coordinates
+type Geocoder interface {
+	// Geocode returns the latitude and longitude of an address, or
+	// ErrAddressNotFound
+	Geocode(ctx context.Context, address, state string) (float64, float64, error)
+}
+
+// defaultGazetteer is the gazetteer loaded when GAZETTEER isn't set. It
+// only covers the ZIP codes of the seed restaurants.
+const defaultGazetteer = "gazetteer/zip-centroids.csv"
+
+// geocoderFromEnv loads the gazetteer file that GAZETTEER names, or the
+// bundled one by default. Without a gazetteer there is no geocoder and
+// restaurants keep whatever coordinates they are given.
+func geocoderFromEnv() (Geocoder, error) {
+	path, set := os.LookupEnv("GAZETTEER")
+	if !set {
+		path = defaultGazetteer
+	}
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !set {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gazetteer, err := loadGazetteer(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading gazetteer %s: %w", path, err)
+	}
+	return gazetteer, nil
+}
+
+// gazetteerColumns are the header names a gazetteer's columns can go by,
+// which cover the Census Bureau's ZCTA gazetteer files as well as plain
+// zip,city,state,latitude,longitude CSV
+var gazetteerColumns = map[string]string{
+	"zip":       "zip",
+	"zipcode":   "zip",
+	"zip_code":  "zip",
+	"zcta":      "zip",
+	"geoid":     "zip",
+	"city":      "city",
+	"state":     "state",
+	"latitude":  "latitude",
+	"lat":       "latitude",
+	"intptlat":  "latitude",
+	"longitude": "longitude",
+	"lng":       "longitude",
+	"lon":       "longitude",
+	"intptlong": "longitude",
+}
+
+// gazetteerPoint is the centroid of a place, and how many ZIP codes were
+// averaged into it
+type gazetteerPoint struct {
+	latitude, longitude float64
+	zips                int
+}
+
+// gazetteer is the offline Geocoder. It places an address at the centroid
+// of its ZIP code, or when the ZIP code isn't known, at the average of the
+// centroids of its city's ZIP codes.
+type gazetteer struct {
+	zips   map[string]gazetteerPoint
+	cities map[string]gazetteerPoint
+}
+
+// cityKey is how cities are looked up, by name and state
+func cityKey(city, state string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " ")) + "|" + strings.ToUpper(state)
+}
+
+// loadGazetteer reads a gazetteer of ZIP code centroids from CSV or tab
+// separated text with a header row. ZIP codes, latitudes and longitudes are
+// required; cities and states are optional and let addresses without a
+// known ZIP code be placed by city.
+func loadGazetteer(r io.Reader) (*gazetteer, error) {
+	// Census files are tab separated, which the header line gives away
+	buffered := bufio.NewReader(r)
+	first, err := buffered.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(first), buffered))
+	if strings.Contains(first, "\t") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if column, ok := gazetteerColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[column] = i
+		}
+	}
+	for _, column := range []string{"zip", "latitude", "longitude"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("header has no %s column", column)
+		}
+	}
+
+	g := &gazetteer{zips: map[string]gazetteerPoint{}, cities: map[string]gazetteerPoint{}}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return g, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		cell := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		zip := cell("zip")
+		latitude, latErr := strconv.ParseFloat(cell("latitude"), 64)
+		longitude, lngErr := strconv.ParseFloat(cell("longitude"), 64)
+		if len(zip) != 5 || latErr != nil || lngErr != nil ||
+			latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return nil, fmt.Errorf("line %d: want a five digit ZIP code and coordinates", line)
+		}
+		g.zips[zip] = gazetteerPoint{latitude, longitude, 1}
+
+		if city, state := cell("city"), cell("state"); city != "" && state != "" {
+			key := cityKey(city, state)
+			point := g.cities[key]
+			point.latitude += (latitude - point.latitude) / float64(point.zips+1)
+			point.longitude += (longitude - point.longitude) / float64(point.zips+1)
+			point.zips++
+			g.cities[key] = point
+		}
+	}
+}
+
+// Geocode looks up the ZIP code of the address, and then its city in the
+// state the address names, or the restaurant's state when it names none
+func (g *gazetteer) Geocode(ctx context.Context, address, state string) (float64, float64, error) {
+	parts := addressParts(address, state)
+	zip, _, _ := strings.Cut(parts.PostalCode, "-")
+	if point, ok := g.zips[zip]; ok {
+		return point.latitude, point.longitude, nil
+	}
+	if point, ok := g.cities[cityKey(parts.City, parts.State)]; ok && parts.City != "" {
+		return point.latitude, point.longitude, nil
+	}
+	return 0, 0, ErrAddressNotFound
+}
+
+// geocodeRestaurant places a restaurant being written when its address or
+// state changed, or it has no coordinates yet. Coordinates the write sets
+// itself are kept. When a new address can't be placed the old coordinates
+// are dropped, since they no longer say where the restaurant is. before is
+// the zero Restaurant for a new one.
+func geocodeRestaurant(ctx context.Context, geocoder Geocoder, before Restaurant, restaurant *Restaurant) error {
+	if geocoder == nil || !sameCoordinates(before, *restaurant) {
+		return nil
+	}
+	moved := restaurant.Address != before.Address || restaurant.State != before.State
+	if !moved && restaurant.Latitude != nil {
+		return nil
+	}
+
+	latitude, longitude, err := geocoder.Geocode(ctx, restaurant.Address, restaurant.State)
+	switch {
+	case err == nil:
+		restaurant.Latitude, restaurant.Longitude = &latitude, &longitude
+	case errors.Is(err, ErrAddressNotFound):
+		restaurant.Latitude, restaurant.Longitude = nil, nil
+	default:
+		return err
+	}
+	return nil
+}
+
+// sameCoordinates reports whether two restaurants are at the same place, or
+// both have no coordinates
+func sameCoordinates(a, b Restaurant) bool {
+	same := func(x, y *float64) bool {
+		return x == nil && y == nil || x != nil && y != nil && *x == *y
+	}
+	return same(a.Latitude, b.Latitude) && same(a.Longitude, b.Longitude)
+}
+
+// actionGeocode is the history action of coordinates filled in by the
+// geocode command
+const actionGeocode = "geocode"
+
+// GeocodeReport is the outcome of geocoding the restaurants already stored
+type GeocodeReport struct {
+	Checked    int                 `json:"checked"`
+	Geocoded   int                 `json:"geocoded"`
+	Unresolved []UnresolvedAddress `json:"unresolved"`
+}
+
+// UnresolvedAddress is a restaurant whose address the geocoder couldn't
+// place
+type UnresolvedAddress struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	State   string `json:"state"`
+}
+
+// backfillCoordinates geocodes the stored restaurants that have no
+// coordinates, or every restaurant when all is set, and records each one
+// it moves in the restaurant's history. Restaurants it can't place keep
+// the coordinates they had and are listed in the report.
+func backfillCoordinates(ctx context.Context, store RestaurantStore, geocoder Geocoder, all bool) (GeocodeReport, error) {
+	report := GeocodeReport{Unresolved: []UnresolvedAddress{}}
+	restaurants, _, err := store.List(ctx, ListOptions{})
+	if err != nil {
+		return report, err
+	}
+
+	for _, restaurant := range restaurants {
+		if !all && restaurant.Latitude != nil {
+			continue
+		}
+		report.Checked++
+		latitude, longitude, err := geocoder.Geocode(ctx, restaurant.Address, restaurant.State)
+		if errors.Is(err, ErrAddressNotFound) {
+			report.Unresolved = append(report.Unresolved, UnresolvedAddress{restaurant.ID, restaurant.Name, restaurant.Address, restaurant.State})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		before := copyRestaurant(restaurant)
+		restaurant.Latitude, restaurant.Longitude = &latitude, &longitude
+		if sameCoordinates(before, restaurant) {
+			continue
+		}
+		updated, err := store.Update(ctx, restaurant)
+		if err != nil {
+			return report, fmt.Errorf("updating restaurant %d: %w", restaurant.ID, err)
+		}
+		report.Geocoded++
+		_, err = store.AddHistory(ctx, HistoryEntry{
+			RestaurantID: updated.ID,
+			Action:       actionGeocode,
+			Actor:        "bumped geocode",
+			Time:         time.Now().UTC(),
+			Changes:      diffRestaurants(before, updated),
+			Restaurant:   updated,
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
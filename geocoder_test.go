@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testGazetteer is a gazetteer with two Chicago ZIP codes and one in New
+// York
+func testGazetteer(t *testing.T) *gazetteer {
+	g, err := loadGazetteer(strings.NewReader(`zip,city,state,latitude,longitude
+60614,Chicago,IL,41.92,-87.65
+60607,Chicago,IL,41.88,-87.65
+10010,New York,NY,40.74,-73.98
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestLoadGazetteer(t *testing.T) {
+	g := testGazetteer(t)
+	assert.Len(t, g.zips, 3)
+	assert.Equal(t, gazetteerPoint{41.9, -87.65, 2}, roundPoint(g.cities["chicago|IL"]))
+
+	// The Census Bureau's ZCTA files are tab separated, with padded headers
+	census, err := loadGazetteer(strings.NewReader("GEOID\tALAND\tAWATER\tALAND_SQMI\tAWATER_SQMI\tINTPTLAT\tINTPTLONG                                                                                                               \n" +
+		"60614\t8146213\t0\t3.145\t0.000\t41.922695\t-87.653337                  \n"))
+	assert.NoError(t, err)
+	assert.Equal(t, gazetteerPoint{41.922695, -87.653337, 1}, census.zips["60614"])
+	assert.Empty(t, census.cities)
+
+	_, err = loadGazetteer(strings.NewReader("zip,city\n60614,Chicago\n"))
+	assert.ErrorContains(t, err, "no latitude column")
+	_, err = loadGazetteer(strings.NewReader("zip,latitude,longitude\n60614,41.92,-87.65\n6061,41.92,-87.65\n"))
+	assert.ErrorContains(t, err, "line 3")
+	_, err = loadGazetteer(strings.NewReader("zip,latitude,longitude\n60614,141.92,-87.65\n"))
+	assert.Error(t, err)
+}
+
+// roundPoint rounds away the error of averaging floats
+func roundPoint(point gazetteerPoint) gazetteerPoint {
+	round := func(x float64) float64 { return float64(int(x*1e6+0.5)) / 1e6 }
+	if point.longitude < 0 {
+		point.longitude = -round(-point.longitude)
+	}
+	point.latitude = round(point.latitude)
+	return point
+}
+
+func TestGazetteerGeocode(t *testing.T) {
+	g := testGazetteer(t)
+	ctx := context.Background()
+
+	latitude, longitude, err := g.Geocode(ctx, "1723 N Halsted St, Chicago, IL 60614", "IL")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{41.92, -87.65}, []float64{latitude, longitude})
+
+	// House numbers can look like ZIP codes, and ZIP+4 codes count
+	latitude, _, err = g.Geocode(ctx, "10010 Madison Ave, New York, NY 60607-1234", "NY")
+	assert.NoError(t, err)
+	assert.Equal(t, 41.88, latitude)
+
+	// An unknown ZIP code falls back to the middle of the city
+	latitude, _, err = g.Geocode(ctx, "1 W Erie St,  chicago , IL 60654", "IL")
+	assert.NoError(t, err)
+	assert.InDelta(t, 41.9, latitude, 1e-9)
+
+	// The state the address names wins over the restaurant's
+	latitude, _, err = g.Geocode(ctx, "1 W Erie St, Chicago, IL 60654", "")
+	assert.NoError(t, err)
+	assert.InDelta(t, 41.9, latitude, 1e-9)
+
+	for _, address := range []struct{ address, state string }{
+		{"1 W Erie St, Chicago 60654", ""},
+		{"1 Main St, Chicago", "OH"},
+		{"1 Main St, Chicago, OH", "IL"},
+		{"somewhere", ""},
+	} {
+		_, _, err = g.Geocode(ctx, address.address, address.state)
+		assert.ErrorIs(t, err, ErrAddressNotFound, address.address)
+	}
+}
+
+func TestBundledGazetteer(t *testing.T) {
+	// Every seed restaurant can be placed with the bundled gazetteer
+	file, err := os.Open(defaultGazetteer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	g, err := loadGazetteer(file)
+	assert.NoError(t, err)
+
+	seed, err := os.Open("seed/restaurants.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seed.Close()
+	rows, err := parseJSONL(seed)
+	assert.NoError(t, err)
+	for _, row := range rows {
+		_, _, err := g.Geocode(context.Background(), row.restaurant.Address, row.restaurant.State)
+		assert.NoError(t, err, row.restaurant.Address)
+	}
+}
+
+func TestGeocoderFromEnv(t *testing.T) {
+	t.Setenv("GAZETTEER", "")
+	geocoder, err := geocoderFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, geocoder)
+
+	t.Setenv("GAZETTEER", defaultGazetteer)
+	geocoder, err = geocoderFromEnv()
+	assert.NoError(t, err)
+	assert.NotNil(t, geocoder)
+
+	t.Setenv("GAZETTEER", "gazetteer/missing.csv")
+	_, err = geocoderFromEnv()
+	assert.Error(t, err)
+}
+
+func TestGeocodeRestaurant(t *testing.T) {
+	g := testGazetteer(t)
+	ctx := context.Background()
+
+	restaurant := Restaurant{Name: "Alinea", Address: "1723 N Halsted St, Chicago, IL 60614", State: "IL"}
+	assert.NoError(t, geocodeRestaurant(ctx, g, Restaurant{}, &restaurant))
+	assert.Equal(t, 41.92, *restaurant.Latitude)
+
+	// Coordinates given with the write are kept
+	given := Restaurant{Name: "Alinea", Address: restaurant.Address, State: "IL"}
+	given.Latitude, given.Longitude = coordinates(41.9134, -87.6482)
+	assert.NoError(t, geocodeRestaurant(ctx, g, Restaurant{}, &given))
+	assert.Equal(t, 41.9134, *given.Latitude)
+	assert.NoError(t, geocodeRestaurant(ctx, g, restaurant, &given))
+	assert.Equal(t, 41.9134, *given.Latitude)
+
+	// An update that leaves the address alone leaves the coordinates alone
+	before := given
+	assert.NoError(t, geocodeRestaurant(ctx, g, before, &given))
+	assert.Equal(t, 41.9134, *given.Latitude)
+
+	// Moving places the restaurant again, or forgets where it was
+	moved := before
+	moved.Address, moved.State = "11 Madison Ave, New York, NY 10010", "NY"
+	assert.NoError(t, geocodeRestaurant(ctx, g, before, &moved))
+	assert.Equal(t, 40.74, *moved.Latitude)
+	moved = before
+	moved.Address = "1 Main St, Springfield, IL 62701"
+	assert.NoError(t, geocodeRestaurant(ctx, g, before, &moved))
+	assert.Nil(t, moved.Latitude)
+	assert.Nil(t, moved.Longitude)
+
+	// Without a geocoder nothing changes
+	unplaced := Restaurant{Address: restaurant.Address, State: "IL"}
+	assert.NoError(t, geocodeRestaurant(ctx, nil, Restaurant{}, &unplaced))
+	assert.Nil(t, unplaced.Latitude)
+}
+
+func TestBackfillCoordinates(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Address: "1723 N Halsted St, Chicago, IL 60614", State: "IL"})
+	lost, _ := store.Create(ctx, Restaurant{Name: "Lost", Address: "Nowhere"})
+	placed := Restaurant{Name: "Placed", Address: "11 Madison Ave, New York, NY 10010", State: "NY"}
+	placed.Latitude, placed.Longitude = coordinates(40.7416, -73.9872)
+	placed, _ = store.Create(ctx, placed)
+
+	report, err := backfillCoordinates(ctx, store, testGazetteer(t), false)
+	assert.NoError(t, err)
+	assert.Equal(t, GeocodeReport{
+		Checked:    2,
+		Geocoded:   1,
+		Unresolved: []UnresolvedAddress{{lost.ID, "Lost", "Nowhere", ""}},
+	}, report)
+	restaurant, _ := store.Get(ctx, alinea.ID)
+	assert.Equal(t, 41.92, *restaurant.Latitude)
+	history, _ := store.History(ctx, alinea.ID)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "geocode", history[0].Action)
+		assert.Len(t, history[0].Changes, 2)
+	}
+
+	// Going over every restaurant moves the ones the gazetteer places
+	// elsewhere, and only those
+	report, err = backfillCoordinates(ctx, store, testGazetteer(t), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 1, report.Geocoded)
+	restaurant, _ = store.Get(ctx, placed.ID)
+	assert.Equal(t, 40.74, *restaurant.Latitude)
+	history, _ = store.History(ctx, alinea.ID)
+	assert.Len(t, history, 1)
+}
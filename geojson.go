@@ -0,0 +1,62 @@
+package main
+
+// mimeGeoJSON is the media type of GeoJSON documents
+const mimeGeoJSON = "application/geo+json"
+
+// featureCollection is a GeoJSON (RFC 7946) document of restaurants, one
+// point feature for each
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+// feature is a restaurant as a GeoJSON feature, identified by the
+// restaurant's ID
+type feature struct {
+	Type       string            `json:"type"`
+	ID         int               `json:"id"`
+	Geometry   pointGeometry     `json:"geometry"`
+	Properties featureProperties `json:"properties"`
+}
+
+// pointGeometry is a GeoJSON point. Its coordinates are the longitude first,
+// then the latitude.
+type pointGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// featureProperties are what the map shows of a restaurant
+type featureProperties struct {
+	Name    string `json:"name"`
+	Stars   int    `json:"stars"`
+	Chef    string `json:"chef"`
+	Address string `json:"address"`
+}
+
+// restaurantFeatures returns the restaurants as a GeoJSON feature
+// collection. Restaurants without coordinates can't be placed and are left
+// out.
+func restaurantFeatures(restaurants []Restaurant) featureCollection {
+	collection := featureCollection{Type: "FeatureCollection", Features: []feature{}}
+	for _, restaurant := range restaurants {
+		if restaurant.Latitude == nil || restaurant.Longitude == nil {
+			continue
+		}
+		collection.Features = append(collection.Features, feature{
+			Type: "Feature",
+			ID:   restaurant.ID,
+			Geometry: pointGeometry{
+				Type:        "Point",
+				Coordinates: [2]float64{*restaurant.Longitude, *restaurant.Latitude},
+			},
+			Properties: featureProperties{
+				Name:    restaurant.Name,
+				Stars:   restaurant.Stars,
+				Chef:    restaurant.Chef,
+				Address: restaurant.Address,
+			},
+		})
+	}
+	return collection
+}
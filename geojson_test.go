@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestaurantFeatures(t *testing.T) {
+	alinea := Restaurant{ID: 1, Name: "Alinea", Stars: 3, Chef: "Grant Achatz", Address: "1723 N Halsted St, Chicago, IL 60614"}
+	alinea.Latitude, alinea.Longitude = coordinates(41.9134, -87.6482)
+	document, err := json.Marshal(restaurantFeatures([]Restaurant{alinea, {ID: 2, Name: "Nowhere"}}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "FeatureCollection",
+		"features": [{
+			"type": "Feature",
+			"id": 1,
+			"geometry": {"type": "Point", "coordinates": [-87.6482, 41.9134]},
+			"properties": {"name": "Alinea", "stars": 3, "chef": "Grant Achatz", "address": "1723 N Halsted St, Chicago, IL 60614"}
+		}]
+	}`, string(document))
+
+	document, _ = json.Marshal(restaurantFeatures(nil))
+	assert.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, string(document))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions recorded in the history of a restaurant
+const (
+	actionCreate  = "create"
+	actionImport  = "import"
+	actionUpdate  = "update"
+	actionDelete  = "delete"
+	actionRestore = "restore"
+	actionRevert  = "revert"
+)
+
+// HistoryEntry is one change to a restaurant: who made it, when, in which
+// request, and what each field was before and after. Restaurant is the whole
+// restaurant as the change left it, which is what reverting to the entry's
+// revision brings back.
+type HistoryEntry struct {
+	Revision     int           `json:"revision"`
+	RestaurantID int           `json:"restaurant_id"`
+	Action       string        `json:"action"`
+	Actor        string        `json:"actor"`
+	RequestID    string        `json:"request_id"`
+	Time         time.Time     `json:"time"`
+	Changes      []FieldChange `json:"changes"`
+	Restaurant   Restaurant    `json:"restaurant"`
+}
+
+// FieldChange is the value of one restaurant field before and after a change
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// diffRestaurants lists the fields that differ between two restaurants, in
+// struct order. The ID and version are bookkeeping rather than content, so
+// they are left out, and an empty collection counts the same as a missing
+// one.
+func diffRestaurants(before, after Restaurant) []FieldChange {
+	changes := []FieldChange{}
+	a, b := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < a.NumField(); i++ {
+		name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("json"), ",")
+		if name == "id" || name == "version" || name == "address_parts" {
+			continue
+		}
+		x, y := a.Field(i), b.Field(i)
+		if x.Kind() == reflect.Slice && x.Len() == 0 && y.Len() == 0 {
+			continue
+		}
+		if reflect.DeepEqual(x.Interface(), y.Interface()) {
+			continue
+		}
+		changes = append(changes, FieldChange{name, x.Interface(), y.Interface()})
+	}
+	return changes
+}
+
+// requestIDKey is the context key of the request ID
+const requestIDKey = "requestID"
+
+// requestID tags every request with an ID, taken from the X-Request-ID
+// header when a proxy in front of the server already assigned one, and sends
+// it back in the response so a history entry can be matched to its logs
+func requestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if id == "" {
+		random := make([]byte, 16)
+		rand.Read(random)
+		id = hex.EncodeToString(random)
+	}
+	c.Set(requestIDKey, id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// actorName is who the history records as making a change. There are no
+// user accounts, so this is whatever the X-Actor header says, which a proxy
+// that does authenticate users can set.
+func actorName(c *gin.Context) string {
+	if actor := strings.TrimSpace(c.GetHeader("X-Actor")); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// lastRevision returns the restaurant as the newest entry of its history left
+// it, or the restaurant itself when it has no history
+func (s *server) lastRevision(c *gin.Context, restaurant Restaurant) Restaurant {
+	history, err := s.store.History(c.Request.Context(), restaurant.ID)
+	if err != nil || len(history) == 0 {
+		return restaurant
+	}
+	return history[0].Restaurant
+}
+
+// recordHistory adds an entry for a change the handler has already made. A
+// failure to record it doesn't undo the change, so it is only logged.
+func (s *server) recordHistory(c *gin.Context, action string, before, after Restaurant) {
+	entry := HistoryEntry{
+		RestaurantID: after.ID,
+		Action:       action,
+		Actor:        actorName(c),
+		RequestID:    c.GetString(requestIDKey),
+		Time:         time.Now().UTC(),
+		Changes:      diffRestaurants(before, after),
+		Restaurant:   after,
+	}
+	if _, err := s.store.AddHistory(c.Request.Context(), entry); err != nil {
+		log.Println("Error recording history:", err)
+	}
+}
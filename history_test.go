@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRestaurants(t *testing.T) {
+	before := Restaurant{ID: 1, Version: 1, Name: "Alinea", Stars: 3, Staff: []string{"Nick Kokonas"}}
+	after := Restaurant{ID: 1, Version: 2, Name: "Alinea", Stars: 2, Staff: []string{}, Photos: []string{}}
+	assert.Equal(t, []FieldChange{
+		{"stars", 3, 2},
+		{"staff", []string{"Nick Kokonas"}, []string{}},
+	}, diffRestaurants(before, after))
+
+	assert.Empty(t, diffRestaurants(before, before))
+}
+
+func TestRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(requestID)
+	router.GET("/", func(c *gin.Context) {
+		c.String(200, c.GetString(requestIDKey))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Len(t, w.Body.String(), 32)
+	assert.Equal(t, w.Body.String(), w.Header().Get("X-Request-ID"))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "from-the-proxy")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "from-the-proxy", w.Body.String())
+}
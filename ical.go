@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// mimeCalendar is the media type of iCalendar feeds
+const mimeCalendar = "text/calendar; charset=utf-8"
+
+// iCalendar date and time layouts. Times with a TZID are wall clock times in
+// that zone; DTSTAMP is always UTC.
+const (
+	icalDate      = "20060102"
+	icalLocalTime = "20060102T150405"
+	icalUTCTime   = "20060102T150405Z"
+)
+
+// icalDays are the RRULE BYDAY codes, indexed by time.Weekday
+var icalDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// calendar builds an RFC 5545 iCalendar document. Lines are folded at 75
+// octets and end in CRLF, as the RFC requires.
+type calendar struct {
+	buf bytes.Buffer
+}
+
+// line writes one content line, folding it onto continuation lines that
+// start with a space
+func (c *calendar) line(name, value string) {
+	text := name + ":" + value
+	for len(text) > 75 {
+		// Don't split a UTF-8 sequence across lines
+		cut := 75
+		for cut > 0 && text[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		c.buf.WriteString(text[:cut] + "\r\n")
+		text = " " + text[cut:]
+	}
+	c.buf.WriteString(text + "\r\n")
+}
+
+// icalText escapes a TEXT value
+var icalText = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// restaurantCalendar returns the opening hours of restaurants as an
+// iCalendar feed. Each weekly service is a recurring event whose weekly RRULE
+// skips the dates that have exceptions; each exception is a one-off event,
+// all day for a closure, and every time is in the restaurant's time zone.
+// Restaurants without a schedule are left out. The recurring events start
+// in the week of January 1 of now's year, which keeps them stable for a year
+// at a time.
+func restaurantCalendar(name string, restaurants []Restaurant, now time.Time) []byte {
+	var cal calendar
+	cal.line("BEGIN", "VCALENDAR")
+	cal.line("VERSION", "2.0")
+	cal.line("PRODID", "-//Bumped//Restaurant hours//EN")
+	cal.line("CALSCALE", "GREGORIAN")
+	cal.line("METHOD", "PUBLISH")
+	cal.line("X-WR-CALNAME", icalText.Replace(name))
+
+	zones := map[string]bool{}
+	for _, restaurant := range restaurants {
+		schedule := restaurant.Schedule
+		if !schedule.hasHours() {
+			continue
+		}
+		location, err := time.LoadLocation(schedule.TimeZone)
+		if err != nil {
+			continue
+		}
+		if !zones[schedule.TimeZone] {
+			zones[schedule.TimeZone] = true
+			writeTimeZone(&cal, location, now.Year())
+		}
+		writeScheduleEvents(&cal, restaurant, location, now)
+	}
+
+	cal.line("END", "VCALENDAR")
+	return cal.buf.Bytes()
+}
+
+// writeScheduleEvents writes the events of one restaurant's schedule
+func writeScheduleEvents(cal *calendar, restaurant Restaurant, location *time.Location, now time.Time) {
+	schedule := restaurant.Schedule
+	tzid := "TZID=" + schedule.TimeZone
+	stamp := now.UTC().Format(icalUTCTime)
+	event := func(uid, summary string) {
+		cal.line("BEGIN", "VEVENT")
+		cal.line("UID", fmt.Sprintf("restaurant-%d-%s@bumped", restaurant.ID, uid))
+		cal.line("DTSTAMP", stamp)
+		cal.line("SUMMARY", icalText.Replace(summary))
+		if restaurant.Address != "" {
+			cal.line("LOCATION", icalText.Replace(restaurant.Address))
+		}
+	}
+	title := func(name string) string {
+		if name == "" {
+			return restaurant.Name
+		}
+		return restaurant.Name + " " + name
+	}
+
+	start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, location)
+	for d, hours := range schedule.Weekly {
+		weekday := time.Weekday(slices.Index(weekdays, hours.Day))
+		first := start.AddDate(0, 0, (int(weekday)-int(start.Weekday())+7)%7)
+		for i, service := range hours.Services {
+			opens, closes := service.span(first)
+			event(fmt.Sprintf("weekly-%d-%d", d, i), title(service.Name))
+			cal.line("DTSTART;"+tzid, opens.Format(icalLocalTime))
+			cal.line("DTEND;"+tzid, closes.Format(icalLocalTime))
+			cal.line("RRULE", "FREQ=WEEKLY;BYDAY="+icalDays[weekday])
+			for _, exception := range schedule.Exceptions {
+				date, err := time.ParseInLocation(time.DateOnly, exception.Date, location)
+				if err != nil || date.Weekday() != weekday || date.Before(first) {
+					continue
+				}
+				skipped, _ := service.span(date)
+				cal.line("EXDATE;"+tzid, skipped.Format(icalLocalTime))
+			}
+			cal.line("END", "VEVENT")
+		}
+	}
+
+	for _, exception := range schedule.Exceptions {
+		date, err := time.ParseInLocation(time.DateOnly, exception.Date, location)
+		if err != nil {
+			continue
+		}
+		label := ""
+		if exception.Name != "" {
+			label = " (" + exception.Name + ")"
+		}
+		if len(exception.Services) == 0 {
+			event(exception.Date, restaurant.Name+" closed"+label)
+			cal.line("DTSTART;VALUE=DATE", date.Format(icalDate))
+			cal.line("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format(icalDate))
+			cal.line("TRANSP", "TRANSPARENT")
+			cal.line("END", "VEVENT")
+			continue
+		}
+		for i, service := range exception.Services {
+			opens, closes := service.span(date)
+			event(fmt.Sprintf("%s-%d", exception.Date, i), title(service.Name)+label)
+			cal.line("DTSTART;"+tzid, opens.Format(icalLocalTime))
+			cal.line("DTEND;"+tzid, closes.Format(icalLocalTime))
+			cal.line("END", "VEVENT")
+		}
+	}
+}
+
+// writeTimeZone writes the VTIMEZONE that the TZIDs of a zone refer to. The
+// offset changes of the given year become yearly rules, which holds for
+// zones whose daylight saving follows a fixed rule; a zone without changes
+// gets a single standard observance.
+func writeTimeZone(cal *calendar, location *time.Location, year int) {
+	type transition struct {
+		at         time.Time
+		from, to   int
+		name       string
+		isDaylight bool
+	}
+
+	// Walk the year an hour at a time looking for offset changes
+	var transitions []transition
+	t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	_, offset := t.In(location).Zone()
+	for end := t.AddDate(1, 0, 0); t.Before(end); t = t.Add(time.Hour) {
+		name, next := t.In(location).Zone()
+		if next != offset {
+			transitions = append(transitions, transition{t, offset, next, name, next > offset})
+			offset = next
+		}
+	}
+
+	cal.line("BEGIN", "VTIMEZONE")
+	cal.line("TZID", location.String())
+	if len(transitions) == 0 {
+		name, offset := t.In(location).Zone()
+		cal.line("BEGIN", "STANDARD")
+		cal.line("DTSTART", "19700101T000000")
+		cal.line("TZOFFSETFROM", icalOffset(offset))
+		cal.line("TZOFFSETTO", icalOffset(offset))
+		cal.line("TZNAME", name)
+		cal.line("END", "STANDARD")
+	}
+	for _, change := range transitions {
+		kind := "STANDARD"
+		if change.isDaylight {
+			kind = "DAYLIGHT"
+		}
+		// DTSTART is the wall clock time the change happens at, before it
+		local := change.at.Add(time.Duration(change.from) * time.Second).UTC()
+		ordinal := (local.Day()-1)/7 + 1
+		if local.AddDate(0, 0, 7).Month() != local.Month() {
+			ordinal = -1
+		}
+		cal.line("BEGIN", kind)
+		cal.line("DTSTART", local.Format(icalLocalTime))
+		cal.line("TZOFFSETFROM", icalOffset(change.from))
+		cal.line("TZOFFSETTO", icalOffset(change.to))
+		cal.line("TZNAME", change.name)
+		cal.line("RRULE", fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", local.Month(), ordinal, icalDays[local.Weekday()]))
+		cal.line("END", kind)
+	}
+	cal.line("END", "VTIMEZONE")
+}
+
+// icalOffset formats a UTC offset in seconds as +HHMM
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
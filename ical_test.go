@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestaurantCalendar(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	smyth := Restaurant{ID: 7, Name: "Smyth", Address: "177 N Ada St, Chicago", Schedule: smythSchedule()}
+	alinea := Restaurant{ID: 8, Name: "Alinea"}
+	document := string(restaurantCalendar("Smyth hours", []Restaurant{smyth, alinea}, now))
+
+	assert.True(t, strings.HasPrefix(document, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(document, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 1, strings.Count(document, "BEGIN:VTIMEZONE"))
+	assert.Equal(t, 7, strings.Count(document, "BEGIN:VEVENT"))
+	for _, line := range strings.Split(strings.TrimSuffix(document, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, line)
+	}
+
+	// Daylight saving in Chicago starts on the second Sunday of March and
+	// ends on the first Sunday of November
+	assert.Contains(t, document, "BEGIN:DAYLIGHT\r\nDTSTART:20240310T020000\r\nTZOFFSETFROM:-0600\r\nTZOFFSETTO:-0500\r\nTZNAME:CDT\r\n"+
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\n")
+	assert.Contains(t, document, "RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\n")
+
+	// Weekly services recur from the first week of the year and skip the
+	// dates with exceptions
+	assert.Contains(t, document, "UID:restaurant-7-weekly-0-0@bumped\r\n")
+	assert.Contains(t, document, "SUMMARY:Smyth dinner\r\nLOCATION:177 N Ada St\\, Chicago\r\n"+
+		"DTSTART;TZID=America/Chicago:20240102T170000\r\nDTEND;TZID=America/Chicago:20240102T220000\r\n"+
+		"RRULE:FREQ=WEEKLY;BYDAY=TU\r\nEXDATE;TZID=America/Chicago:20241224T170000\r\nEND:VEVENT\r\n")
+	assert.Contains(t, document, "DTSTART;TZID=America/Chicago:20240106T223000\r\nDTEND;TZID=America/Chicago:20240107T013000\r\n")
+	assert.Contains(t, document, "EXDATE;TZID=America/Chicago:20241225T113000\r\n")
+
+	// Exceptions are one-off events, all day for a closure
+	assert.Contains(t, document, "SUMMARY:Smyth closed (Christmas)\r\nLOCATION:177 N Ada St\\, Chicago\r\n"+
+		"DTSTART;VALUE=DATE:20241225\r\nDTEND;VALUE=DATE:20241226\r\nTRANSP:TRANSPARENT\r\n")
+	assert.Contains(t, document, "SUMMARY:Smyth dinner (Christmas Eve)\r\n")
+	assert.NotContains(t, document, "Alinea")
+}
+
+func TestCalendarFolding(t *testing.T) {
+	var cal calendar
+	cal.line("SUMMARY", strings.Repeat("é", 50))
+	lines := strings.Split(strings.TrimSuffix(cal.buf.String(), "\r\n"), "\r\n")
+	if assert.Len(t, lines, 2) {
+		assert.Len(t, lines[0], 74)
+		assert.True(t, strings.HasPrefix(lines[1], " é"))
+	}
+}
+
+func TestWriteTimeZoneWithoutDaylightSaving(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	var cal calendar
+	writeTimeZone(&cal, tokyo, 2024)
+	assert.Equal(t, "BEGIN:VTIMEZONE\r\nTZID:Asia/Tokyo\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\n"+
+		"TZOFFSETFROM:+0900\r\nTZOFFSETTO:+0900\r\nTZNAME:JST\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n", cal.buf.String())
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// ListOptions filters, sorts and pages the restaurants returned by
+// RestaurantStore.List. The zero value lists every restaurant by ID.
+type ListOptions struct {
+	// Limit is the page size. Zero or less returns every matching restaurant.
+	Limit  int
+	Offset int
+
+	// Sort is one of sortColumns, with a leading "-" for descending order
+	Sort string
+
+	// MinStars and MaxStars bound the star rating when they are non-nil
+	MinStars *int
+	MaxStars *int
+
+	// State matches the two letter state code exactly
+	State string
+
+	// Chef matches any restaurant whose chef contains it, ignoring case
+	Chef string
+
+	// OpenAt keeps the restaurants whose schedule has them open at that
+	// instant when it is non-nil
+	OpenAt *time.Time
+
+	// Dish and Diets keep the restaurants with a dish on a current menu
+	// whose name or description contains Dish, ignoring case, and that
+	// carries every one of Diets
+	Dish  string
+	Diets []string
+
+	// Deleted lists the restaurants in the trash instead of the others
+	Deleted bool
+}
+
+// sortColumns maps the sort keys clients can use to restaurants columns
+var sortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"stars": "stars",
+	"state": "state",
+
+	// Only meaningful for the trash, where it is the default, newest first
+	"deleted": "deleted_at",
+}
+
+// sortKey splits Sort into a sortColumns key and its direction
+func (opts ListOptions) sortKey() (key string, descending bool) {
+	key = strings.TrimPrefix(opts.Sort, "-")
+	if key == "" {
+		key = "id"
+	}
+	return key, strings.HasPrefix(opts.Sort, "-")
+}
+
+// matches reports whether a restaurant passes every filter
+func (opts ListOptions) matches(restaurant Restaurant) bool {
+	if opts.Deleted != (restaurant.DeletedAt != nil) {
+		return false
+	}
+	if opts.MinStars != nil && restaurant.Stars < *opts.MinStars {
+		return false
+	}
+	if opts.MaxStars != nil && restaurant.Stars > *opts.MaxStars {
+		return false
+	}
+	if opts.State != "" && !strings.EqualFold(restaurant.State, opts.State) {
+		return false
+	}
+	if opts.Chef != "" && !strings.Contains(strings.ToLower(restaurant.Chef), strings.ToLower(opts.Chef)) {
+		return false
+	}
+	if opts.OpenAt != nil && !restaurant.Schedule.OpenAt(*opts.OpenAt) {
+		return false
+	}
+	return true
+}
+
+// sortRestaurants orders restaurants the way the SQL store's ORDER BY does,
+// breaking ties by ID
+func (opts ListOptions) sortRestaurants(restaurants []Restaurant) {
+	key, descending := opts.sortKey()
+	compare := func(a, b Restaurant) int {
+		switch key {
+		case "name":
+			return strings.Compare(a.Name, b.Name)
+		case "stars":
+			return a.Stars - b.Stars
+		case "state":
+			return strings.Compare(a.State, b.State)
+		case "deleted":
+			return compareDeletedAt(a, b)
+		}
+		return 0
+	}
+	sort.SliceStable(restaurants, func(i, j int) bool {
+		order := compare(restaurants[i], restaurants[j])
+		if descending {
+			order = -order
+		}
+		if order == 0 {
+			return restaurants[i].ID < restaurants[j].ID
+		}
+		return order < 0
+	})
+}
+
+// compareDeletedAt orders restaurants by when they were moved to the trash,
+// with the ones outside it first, the way SQLite sorts NULLs
+func compareDeletedAt(a, b Restaurant) int {
+	switch {
+	case a.DeletedAt == nil && b.DeletedAt == nil:
+		return 0
+	case a.DeletedAt == nil:
+		return -1
+	case b.DeletedAt == nil:
+		return 1
+	}
+	return a.DeletedAt.Compare(*b.DeletedAt)
+}
+
+// page returns the slice of restaurants that Limit and Offset select
+func (opts ListOptions) page(restaurants []Restaurant) []Restaurant {
+	if opts.Offset >= len(restaurants) {
+		return []Restaurant{}
+	}
+	restaurants = restaurants[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(restaurants) {
+		restaurants = restaurants[:opts.Limit]
+	}
+	return restaurants
+}
+
+// parseListOptions reads list options from a query string. Star filters use
+// comparison operators, so ?stars>=2 and ?stars<=1 work alongside ?stars=3;
+// url.ParseQuery sees those as the keys "stars>" and "stars<". ?open_now=true
+// is the same as ?open_at= with the current time.
+func parseListOptions(query url.Values) (ListOptions, error) {
+	opts := ListOptions{
+		Limit: defaultPageSize,
+		Sort:  query.Get("sort"),
+		State: strings.ToUpper(query.Get("state")),
+		Chef:  query.Get("chef"),
+		Dish:  strings.TrimSpace(query.Get("dish")),
+	}
+
+	if key, _ := opts.sortKey(); sortColumns[key] == "" {
+		return opts, fmt.Errorf("sort must be one of id, name, stars, state or deleted")
+	}
+
+	for _, diet := range query["diet"] {
+		diet = strings.ToLower(strings.TrimSpace(diet))
+		if !slices.Contains(menuDiets, diet) {
+			return opts, fmt.Errorf("diet must be one of %s", strings.Join(menuDiets, ", "))
+		}
+		opts.Diets = append(opts.Diets, diet)
+	}
+
+	var err error
+	if value := query.Get("limit"); value != "" {
+		opts.Limit, err = strconv.Atoi(value)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxPageSize {
+			return opts, fmt.Errorf("limit must be a number from 1 to %d", maxPageSize)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		opts.Offset, err = strconv.Atoi(value)
+		if err != nil || opts.Offset < 0 {
+			return opts, fmt.Errorf("offset must be a number of at least 0")
+		}
+	}
+
+	if value := query.Get("open_now"); value != "" {
+		openNow, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("open_now must be true or false")
+		}
+		if openNow {
+			now := time.Now()
+			opts.OpenAt = &now
+		}
+	}
+	if value := query.Get("open_at"); value != "" {
+		if opts.OpenAt != nil {
+			return opts, fmt.Errorf("use either open_now or open_at")
+		}
+		openAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, fmt.Errorf("open_at must be a time such as 2024-06-01T19:30:00-05:00")
+		}
+		opts.OpenAt = &openAt
+	}
+
+	// ?stars=3 sets both bounds, so it can't be combined with either one
+	if query.Get("stars") != "" && (query.Get("stars>") != "" || query.Get("stars<") != "") {
+		return opts, fmt.Errorf("use either stars or stars>= and stars<=")
+	}
+	for _, filter := range []struct {
+		key    string
+		bounds []**int
+	}{
+		{"stars", []**int{&opts.MinStars, &opts.MaxStars}},
+		{"stars>", []**int{&opts.MinStars}},
+		{"stars<", []**int{&opts.MaxStars}},
+	} {
+		value := query.Get(filter.key)
+		if value == "" {
+			continue
+		}
+		stars, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be a number", filter.key)
+		}
+		for _, bound := range filter.bounds {
+			*bound = &stars
+		}
+	}
+	return opts, nil
+}
+
+// pageLinks returns the URLs of the previous and next pages of a list, or
+// empty strings when there is no such page. Every other query parameter of
+// the current URL is kept so filters and sorting carry over.
+func pageLinks(current *url.URL, opts ListOptions, total int) (previous, next string) {
+	link := func(offset int) string {
+		query := current.Query()
+		query.Set("limit", strconv.Itoa(opts.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return current.Path + "?" + query.Encode()
+	}
+
+	if opts.Offset > 0 {
+		previous = link(max(opts.Offset-opts.Limit, 0))
+	}
+	if opts.Offset+opts.Limit < total {
+		next = link(opts.Offset + opts.Limit)
+	}
+	return previous, next
+}
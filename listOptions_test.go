@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListOptions(t *testing.T) {
+	query, _ := url.ParseQuery("stars>=2&state=ca&chef=keller&sort=-stars&limit=10&offset=20")
+	opts, err := parseListOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *opts.MinStars)
+	assert.Nil(t, opts.MaxStars)
+	assert.Equal(t, "CA", opts.State)
+	assert.Equal(t, "keller", opts.Chef)
+	assert.Equal(t, "-stars", opts.Sort)
+	assert.Equal(t, 10, opts.Limit)
+	assert.Equal(t, 20, opts.Offset)
+
+	query, _ = url.ParseQuery("stars=3")
+	opts, err = parseListOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *opts.MinStars)
+	assert.Equal(t, 3, *opts.MaxStars)
+	assert.Equal(t, defaultPageSize, opts.Limit)
+
+	query, _ = url.ParseQuery("open_at=2024-06-04T19:00:00-05:00")
+	opts, err = parseListOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC), opts.OpenAt.UTC())
+
+	query, _ = url.ParseQuery("open_now=true")
+	opts, err = parseListOptions(query)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), *opts.OpenAt, time.Minute)
+
+	query, _ = url.ParseQuery("dish=+truffle+&diet=Vegan&diet=gluten-free")
+	opts, err = parseListOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, "truffle", opts.Dish)
+	assert.Equal(t, []string{"vegan", "gluten-free"}, opts.Diets)
+
+	for _, bad := range []string{"limit=0", "limit=1000", "offset=-1", "stars<=many", "sort=address",
+		"open_now=maybe", "open_at=tonight", "open_now=true&open_at=2024-06-04T19:00:00Z", "diet=paleo",
+		"stars=3&stars>=2", "stars<=1&stars=3"} {
+		query, _ = url.ParseQuery(bad)
+		_, err = parseListOptions(query)
+		assert.Error(t, err, bad)
+	}
+}
@@ -1,38 +1,54 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"time"
 
-	"github.com/gin-gonic/gin"
+	"github.com/jcardarelli/fancy-api/migrations"
 
 	// Importing a package with an underscore allows us to create the package
 	// level variables and also execute the init function
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Restaurant is a restaurant document. The binding tags are the rules that
+// validateRestaurant checks before a restaurant is written.
 type Restaurant struct {
-	ID      int      `json:"id"`
-	Name    string   `json:"name"`
-	Stars   int      `json:"stars"`
-	Address string   `json:"address"`
-	State   string   `json:"state"`
-	Hours   string   `json:"hours"`
-	Chef    string   `json:"chef"`
-	Staff   []string `json:"staff"`
-	Photos  []string `json:"photos"`
-	Website string   `json:"website"`
-	Info    string   `json:"info"`
-	Menus   []string `json:"menus"`
+	ID       int        `json:"id"`
+	Version  int        `json:"version"`
+	Name     string     `json:"name" binding:"required"`
+	Stars    int        `json:"stars" binding:"min=0,max=3"`
+	Address  string     `json:"address" binding:"required"`
+	State    string     `json:"state" binding:"omitempty,usstate"`
+	Hours    string     `json:"hours"`
+	Schedule *Schedule  `json:"schedule"`
+	Chef     string     `json:"chef"`
+	Chefs    []ChefLink `json:"chefs"`
+	Staff    []string   `json:"staff"`
+	Photos   []string   `json:"photos"`
+	Website  string     `json:"website" binding:"omitempty,http_url"`
+	Info     string     `json:"info"`
+	Menus    []string   `json:"menus"`
+
+	// AddressParts is the address split into its components. It is worked
+	// out from the address and state whenever a restaurant is written, and
+	// what a body sends for it is ignored.
+	AddressParts AddressParts `json:"address_parts"`
+
+	// Latitude and Longitude are where the restaurant is, in degrees, and
+	// are both nil when that isn't known
+	Latitude  *float64 `json:"latitude" binding:"omitempty,latitude"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,longitude"`
+
+	// DeletedAt is when the restaurant was moved to the trash, and is nil
+	// for every restaurant outside it
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-var db *sql.DB
-
 func main() {
-	var err error
 	// Fail if the DB env var is not set
 	dbEnvVarValue, dbEnvVarPresent := os.LookupEnv("DB")
 	if !dbEnvVarPresent {
@@ -43,249 +59,48 @@ func main() {
 		log.Fatalln("env var DB must not be empty")
 	}
 	// Fail if the DB env var doesn't resolve to an actual file?
-	db, err = sql.Open("sqlite3", os.Getenv("DB"))
+	db, err := sql.Open("sqlite3", os.Getenv("DB"))
 	if err != nil {
 		log.Fatal("Error opening database:", err)
 	}
 	defer db.Close()
 
-	// Create restaurants table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS restaurants (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			stars INTEGER NOT NULL,
-			address TEXT NOT NULL,
-			chef TEXT NOT NULL,
-			state TEXT NOT NULL,
-			website TEXT NOT NULL,
-			info TEXT NOT NULL
-		);
-	`)
-	if err != nil {
-		log.Fatal("Error creating table:", err)
-	}
-
-	// Load gin and HTML template support
-	router := gin.Default()
-	router.LoadHTMLGlob("templates/*.tmpl")
-
-	// Route to get all restaurants
-	router.GET("/api/v1/restaurants", GetRestaurantsHTML)
-
-	// Route to get a single restaurant page by ID
-	router.GET("/api/v1/restaurant/:id", GetRestaurantByIdHTML)
-
-	// Route to create a new restaurant
-	router.POST("/api/v1/restaurant/create", CreateRestaurantJSON)
-
-	// Route to update a restaurant by ID
-	router.PATCH("/api/v1/restaurant/update/:id", UpdateRestaurant)
-
-	// Route to delete a restaurant by ID
-	router.DELETE("/api/v1/restaurant/delete/:id", DeleteRestaurant)
-
-	// Run the Gin server and check for errors
-	if err := router.Run("0.0.0.0:8083"); err != nil {
-		log.Fatal("Error starting Gin server:", err)
-	}
-}
-
-// GetRestaurantsHTML returns a list of all restaurants
-func GetRestaurantsHTML(c *gin.Context) {
-	rows, err := db.Query("SELECT id, name, stars, address, chef FROM restaurants")
-	if err != nil {
-		log.Println("Error retrieving restaurants:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
-		return
-	}
-	defer rows.Close()
-
-	var restaurants []Restaurant
-	for rows.Next() {
-		var restaurant Restaurant
-		err := rows.Scan(
-			&restaurant.ID,
-			&restaurant.Name,
-			&restaurant.Stars,
-			&restaurant.Address,
-			&restaurant.Chef,
-		)
-		if err != nil {
-			log.Println("Error scanning row:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
-			return
+	// Run a maintenance command such as `bumped migrate down 1` instead of
+	// the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1:]); err != nil {
+			log.Fatal("Error running command: ", err)
 		}
-		restaurants = append(restaurants, restaurant)
-	}
-
-	// Render HTML using the built-in HTML rendering
-	c.HTML(http.StatusOK, "templates/restaurants.tmpl", gin.H{
-		"title":       "Restaurants List",
-		"restaurants": restaurants,
-	})
-}
-
-// GetRestaurantByIdHTML returns info about a single restaurant
-func GetRestaurantByIdHTML(c *gin.Context) {
-	var restaurant Restaurant
-
-	// Input parameters from URI
-	id := c.Param("id")
-
-	// Validate that the restaurant with this name exists in the database
-	sqlStatement := `SELECT id, name, stars, address, state, website, chef, info
-					 FROM restaurants
-					 WHERE id = $1`
-
-	row := db.QueryRow(sqlStatement, id)
-	switch err := row.Scan(
-		&restaurant.ID,
-		&restaurant.Name,
-		&restaurant.Stars,
-		&restaurant.Address,
-		&restaurant.State,
-		&restaurant.Website,
-		&restaurant.Chef,
-		&restaurant.Info,
-	); err {
-	case sql.ErrNoRows:
-		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
-	case nil:
-		// Render HTML using the built-in HTML rendering
-		c.HTML(http.StatusOK, "templates/restaurant.tmpl", gin.H{
-			"ID":      restaurant.ID,
-			"Name":    restaurant.Name,
-			"Stars":   restaurant.Stars,
-			"Address": restaurant.Address,
-			"State":   restaurant.State,
-			"Website": restaurant.Website,
-			"Chef":    restaurant.Chef,
-			"Info":    restaurant.Info,
-		})
-	default:
-		panic(err)
-	}
-}
-
-// CreateRestaurantJSON creates a new restaurant
-func CreateRestaurantJSON(c *gin.Context) {
-	name := c.PostForm("name")
-	stars := c.PostForm("stars")
-	address := c.PostForm("address")
-	chef := c.PostForm("chef")
-
-	result, readErr := db.Exec(
-		`INSERT INTO restaurants (name, stars, address, chef)
-	     VALUES (?, ?, ?, ?)`,
-		name,
-		stars,
-		address,
-		chef,
-	)
-	if readErr != nil {
-		log.Println("Error inserting into database:", readErr)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
 		return
 	}
 
-	newID, err := result.LastInsertId()
-	if err != nil {
-		log.Fatalln("failed to insert into database")
-	}
-	c.JSON(http.StatusCreated, int(newID))
-}
-
-// UpdateRestaurant updates an existing restaurant by ID
-func UpdateRestaurant(c *gin.Context) {
-	id := c.PostForm("updateId")
-	name := c.PostForm("updateName")
-	stars := c.PostForm("updateStars")
-	address := c.PostForm("updateAddress")
-	chef := c.PostForm("updateChef")
-	fmt.Println("fields:", name, stars, address, chef)
-
-	if name == "" {
-		log.Fatalln("name is blank")
-	}
-	if stars == "" {
-		log.Fatalln("stars are blank")
-	}
-	if address == "" {
-		log.Fatalln("address is blank")
+	// Bring the schema up to date. This refuses to serve from a database
+	// that a newer release has already migrated past this binary.
+	if err := migrations.Up(db); err != nil {
+		log.Fatal("Error migrating database: ", err)
 	}
-	if chef == "" {
-		log.Fatalln("chef is blank")
-	}
-
-	var updatedRestaurant Restaurant
 
-	// Check if the restaurant with the given ID exists
-	var existingRestaurant Restaurant
-	err := db.QueryRow("SELECT id, name, stars, address, chef, website, info FROM restaurants WHERE id = ?", id).
-		Scan(
-			&existingRestaurant.ID,
-			&existingRestaurant.Name,
-			&existingRestaurant.Stars,
-			&existingRestaurant.Address,
-			&existingRestaurant.Chef,
-			&existingRestaurant.Website,
-			&existingRestaurant.Info)
+	retention, err := trashRetention()
 	if err != nil {
-		log.Println("Error querying existing restaurant:", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
-		return
+		log.Fatal("Error reading TRASH_RETENTION: ", err)
 	}
 
-	// Update the existing restaurant with the new data
-	_, err = db.Exec(
-		"UPDATE restaurants SET name = ?, stars = ?, address = ?, chef = ? WHERE id = ?",
-		name,
-		stars,
-		address,
-		chef,
-		id,
-	)
+	photos, err := photoStorageFromEnv()
 	if err != nil {
-		log.Println("Error updating restaurant:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
-		return
+		log.Fatal("Error configuring photo storage: ", err)
 	}
 
-	// Return the updated restaurant
-	updatedRestaurant.ID = existingRestaurant.ID
-	c.JSON(http.StatusOK, updatedRestaurant)
-}
-
-// DeleteRestaurant deletes a restaurant by ID
-func DeleteRestaurant(c *gin.Context) {
-	id := c.Param("id")
-	log.Println("deleting id:", id)
-	if id == "" {
-		log.Fatalln("id provided to DeleteRestaurant() is nil")
-	}
-
-	statement, err := db.Prepare(`DELETE FROM restaurants WHERE id = ?`)
+	geocoder, err := geocoderFromEnv()
 	if err != nil {
-		log.Fatalln("failed to prepare delete statement", statement)
+		log.Fatal("Error loading GAZETTEER: ", err)
 	}
-	defer statement.Close()
 
-	result, err := statement.Exec(id)
-	if err != nil {
-		log.Println("Error deleting restaurant:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
-		return
-	}
+	store := newSQLiteStore(db)
+	go runPurger(context.Background(), store, photos, retention, purgeInterval)
+	router := setupRouter(store, photos, geocoder)
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Restaurant not found"})
-		return
+	// Run the Gin server and check for errors
+	if err := router.Run("0.0.0.0:8083"); err != nil {
+		log.Fatal("Error starting Gin server:", err)
 	}
-
-	deletedText := "Deleted"
-	c.HTML(http.StatusOK, "templates/deleted.tmpl", gin.H{
-		"deletedText": deletedText,
-	})
 }
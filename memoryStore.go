@@ -0,0 +1,756 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore is a RestaurantStore that keeps restaurants in a map. It backs
+// the handler tests and is handy for running the server without a database.
+type memoryStore struct {
+	mu          sync.Mutex
+	nextID      int
+	restaurants map[int]Restaurant
+	history     []HistoryEntry
+	ratings     map[int][]Rating
+
+	// Chefs are kept without their restaurants, and links only hold IDs;
+	// the names are filled in when a link is read
+	nextChefID int
+	chefs      map[int]Chef
+	links      []ChefLink
+
+	// staff holds every stint, in ID order
+	nextStaffID int
+	staff       []StaffMember
+
+	// menus holds every version of every menu, in ID order
+	nextMenuID int
+	menus      []Menu
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		nextID:      1,
+		restaurants: map[int]Restaurant{},
+		ratings:     map[int][]Rating{},
+		nextChefID:  1,
+		chefs:       map[int]Chef{},
+		nextStaffID: 1,
+		nextMenuID:  1,
+	}
+}
+
+// copyRestaurant returns a restaurant whose collections, schedule and
+// DeletedAt don't share memory with the original, so callers can't modify
+// the stored copy
+func copyRestaurant(restaurant Restaurant) Restaurant {
+	for _, collection := range restaurantCollections {
+		field := collection.field(&restaurant)
+		*field = append([]string{}, *field...)
+	}
+	restaurant.Staff = append([]string{}, restaurant.Staff...)
+	restaurant.Menus = append([]string{}, restaurant.Menus...)
+	restaurant.Chefs = append([]ChefLink{}, restaurant.Chefs...)
+	restaurant.Schedule = restaurant.Schedule.copy()
+	for _, coordinate := range []**float64{&restaurant.Latitude, &restaurant.Longitude} {
+		if *coordinate != nil {
+			value := **coordinate
+			*coordinate = &value
+		}
+	}
+	if restaurant.DeletedAt != nil {
+		deletedAt := *restaurant.DeletedAt
+		restaurant.DeletedAt = &deletedAt
+	}
+	return restaurant
+}
+
+func (s *memoryStore) List(ctx context.Context, opts ListOptions) ([]Restaurant, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurants := []Restaurant{}
+	for _, restaurant := range s.restaurants {
+		if opts.matches(restaurant) && opts.servesDish(s.restaurantMenus(restaurant.ID)) {
+			restaurants = append(restaurants, copyRestaurant(restaurant))
+		}
+	}
+	opts.sortRestaurants(restaurants)
+	return opts.page(restaurants), len(restaurants), nil
+}
+
+func (s *memoryStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	restaurants, _, err := s.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return searchRestaurants(restaurants, query, limit), nil
+}
+
+func (s *memoryStore) Nearby(ctx context.Context, opts NearbyOptions) ([]NearbyResult, error) {
+	restaurants, _, err := s.List(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return nearbyRestaurants(restaurants, opts), nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, id int) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurant, ok := s.restaurants[id]
+	if !ok || restaurant.DeletedAt != nil {
+		return Restaurant{}, ErrNotFound
+	}
+	return copyRestaurant(restaurant), nil
+}
+
+func (s *memoryStore) Create(ctx context.Context, restaurant Restaurant) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurant.ID = s.nextID
+	restaurant.Version = 1
+	restaurant.Chefs = nil
+	restaurant.DeletedAt = nil
+	restaurant.AddressParts = addressParts(restaurant.Address, restaurant.State)
+	s.nextID++
+	restaurant.Staff = s.saveStaff(restaurant.ID, restaurant.Staff, time.Now())
+	restaurant.Menus = s.saveMenus(restaurant.ID, restaurant.Menus, time.Now())
+	s.restaurants[restaurant.ID] = copyRestaurant(restaurant)
+	return copyRestaurant(restaurant), nil
+}
+
+func (s *memoryStore) CreateAll(ctx context.Context, restaurants []Restaurant) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, len(restaurants))
+	for i, restaurant := range restaurants {
+		restaurant.ID = s.nextID
+		restaurant.Version = 1
+		restaurant.Chefs = nil
+		restaurant.DeletedAt = nil
+		restaurant.AddressParts = addressParts(restaurant.Address, restaurant.State)
+		s.nextID++
+		restaurant.Staff = s.saveStaff(restaurant.ID, restaurant.Staff, time.Now())
+		restaurant.Menus = s.saveMenus(restaurant.ID, restaurant.Menus, time.Now())
+		s.restaurants[restaurant.ID] = copyRestaurant(restaurant)
+		ids[i] = restaurant.ID
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, restaurant Restaurant) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.restaurants[restaurant.ID]
+	if !ok || stored.DeletedAt != nil {
+		return Restaurant{}, ErrNotFound
+	}
+	if restaurant.Version != 0 && restaurant.Version != stored.Version {
+		return Restaurant{}, ErrStaleVersion
+	}
+	restaurant.Version = stored.Version + 1
+	restaurant.DeletedAt = nil
+	// Once a restaurant has ratings, its stars are the current one's
+	if current, ok := currentRating(s.ratings[restaurant.ID]); ok {
+		restaurant.Stars = current.Stars
+	}
+	restaurant.AddressParts = addressParts(restaurant.Address, restaurant.State)
+	restaurant.Staff = s.saveStaff(restaurant.ID, restaurant.Staff, time.Now())
+	restaurant.Menus = s.saveMenus(restaurant.ID, restaurant.Menus, time.Now())
+	s.restaurants[restaurant.ID] = copyRestaurant(restaurant)
+
+	// The links carry the restaurant's name, which may have changed
+	s.refreshChefs()
+	return copyRestaurant(s.restaurants[restaurant.ID]), nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, id, version int) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurant, ok := s.restaurants[id]
+	if !ok || restaurant.DeletedAt != nil {
+		return Restaurant{}, ErrNotFound
+	}
+	if version != 0 && version != restaurant.Version {
+		return Restaurant{}, ErrStaleVersion
+	}
+	now := time.Now().UTC()
+	restaurant.DeletedAt = &now
+	s.restaurants[id] = restaurant
+	return copyRestaurant(restaurant), nil
+}
+
+func (s *memoryStore) Restore(ctx context.Context, id int) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurant, ok := s.restaurants[id]
+	if !ok || restaurant.DeletedAt == nil {
+		return Restaurant{}, ErrNotFound
+	}
+	restaurant.DeletedAt = nil
+	s.restaurants[id] = restaurant
+	return copyRestaurant(restaurant), nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, before time.Time) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := []int{}
+	for id, restaurant := range s.restaurants {
+		if restaurant.DeletedAt != nil && restaurant.DeletedAt.Before(before) {
+			delete(s.restaurants, id)
+			delete(s.ratings, id)
+			purged = append(purged, id)
+		}
+	}
+	sort.Ints(purged)
+	s.links = s.keepLinks(func(link ChefLink) bool {
+		_, ok := s.restaurants[link.RestaurantID]
+		return ok
+	})
+	staff := []StaffMember{}
+	for _, member := range s.staff {
+		if _, ok := s.restaurants[member.RestaurantID]; ok {
+			staff = append(staff, member)
+		}
+	}
+	s.staff = staff
+	menus := []Menu{}
+	for _, menu := range s.menus {
+		if _, ok := s.restaurants[menu.RestaurantID]; ok {
+			menus = append(menus, menu)
+		}
+	}
+	s.menus = menus
+	return purged, nil
+}
+
+func (s *memoryStore) AddHistory(ctx context.Context, entry HistoryEntry) (HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Revision = len(s.history) + 1
+	entry.Restaurant = copyRestaurant(entry.Restaurant)
+	s.history = append(s.history, entry)
+	return entry, nil
+}
+
+func (s *memoryStore) History(ctx context.Context, restaurantID int) ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := []HistoryEntry{}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if entry := s.history[i]; entry.RestaurantID == restaurantID {
+			entry.Restaurant = copyRestaurant(entry.Restaurant)
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+func (s *memoryStore) AddRating(ctx context.Context, restaurantID int, rating Rating) (Restaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restaurant, ok := s.restaurants[restaurantID]
+	if !ok || restaurant.DeletedAt != nil {
+		return Restaurant{}, ErrNotFound
+	}
+
+	ratings := []Rating{rating}
+	for _, existing := range s.ratings[restaurantID] {
+		if existing.Year != rating.Year || existing.Source != rating.Source {
+			ratings = append(ratings, existing)
+		}
+	}
+	sortRatings(ratings)
+	s.ratings[restaurantID] = ratings
+
+	if current, _ := currentRating(ratings); current.Stars != restaurant.Stars {
+		restaurant.Stars = current.Stars
+		restaurant.Version++
+		s.restaurants[restaurantID] = restaurant
+	}
+	return copyRestaurant(restaurant), nil
+}
+
+func (s *memoryStore) Ratings(ctx context.Context, restaurantID int) ([]Rating, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Rating{}, s.ratings[restaurantID]...), nil
+}
+
+// namedLinks returns the links that keep accepts with the names of both
+// ends filled in, in the order the SQL store reads them
+func (s *memoryStore) namedLinks(keep func(ChefLink) bool) []ChefLink {
+	links := []ChefLink{}
+	for _, link := range s.links {
+		if keep(link) {
+			link.ChefName = s.chefs[link.ChefID].Name
+			link.RestaurantName = s.restaurants[link.RestaurantID].Name
+			links = append(links, link)
+		}
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		switch {
+		case a.Start != b.Start:
+			return a.Start < b.Start
+		case a.ChefName != b.ChefName:
+			return a.ChefName < b.ChefName
+		case a.RestaurantName != b.RestaurantName:
+			return a.RestaurantName < b.RestaurantName
+		}
+		return a.Role < b.Role
+	})
+	return links
+}
+
+// keepLinks returns the stored links that keep accepts
+func (s *memoryStore) keepLinks(keep func(ChefLink) bool) []ChefLink {
+	var links []ChefLink
+	for _, link := range s.links {
+		if keep(link) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// refreshChefs sets the Chefs of every stored restaurant from the links,
+// after a change to the links or to a name they show
+func (s *memoryStore) refreshChefs() {
+	for id, restaurant := range s.restaurants {
+		restaurant.Chefs = s.namedLinks(func(link ChefLink) bool { return link.RestaurantID == id })
+		s.restaurants[id] = restaurant
+	}
+}
+
+// chefsChanged bumps the version of every restaurant with a link that
+// matches, since the chefs it shows are about to change
+func (s *memoryStore) chefsChanged(match func(ChefLink) bool) {
+	bumped := map[int]bool{}
+	for _, link := range s.links {
+		if restaurant, ok := s.restaurants[link.RestaurantID]; ok && match(link) && !bumped[link.RestaurantID] {
+			restaurant.Version++
+			s.restaurants[link.RestaurantID] = restaurant
+			bumped[link.RestaurantID] = true
+		}
+	}
+}
+
+// withRestaurants returns a chef with the links to restaurants outside the
+// trash
+func (s *memoryStore) withRestaurants(chef Chef) Chef {
+	chef.Restaurants = s.namedLinks(func(link ChefLink) bool {
+		return link.ChefID == chef.ID && s.restaurants[link.RestaurantID].DeletedAt == nil
+	})
+	return chef
+}
+
+func (s *memoryStore) Chefs(ctx context.Context) ([]Chef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chefs := []Chef{}
+	for _, chef := range s.chefs {
+		chefs = append(chefs, s.withRestaurants(chef))
+	}
+	sort.Slice(chefs, func(i, j int) bool {
+		if chefs[i].Name != chefs[j].Name {
+			return chefs[i].Name < chefs[j].Name
+		}
+		return chefs[i].ID < chefs[j].ID
+	})
+	return chefs, nil
+}
+
+func (s *memoryStore) GetChef(ctx context.Context, id int) (Chef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chef, ok := s.chefs[id]
+	if !ok {
+		return Chef{}, ErrChefNotFound
+	}
+	return s.withRestaurants(chef), nil
+}
+
+func (s *memoryStore) CreateChef(ctx context.Context, chef Chef) (Chef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chef.ID = s.nextChefID
+	chef.Restaurants = nil
+	s.nextChefID++
+	s.chefs[chef.ID] = chef
+	return s.withRestaurants(chef), nil
+}
+
+func (s *memoryStore) UpdateChef(ctx context.Context, chef Chef) (Chef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.chefs[chef.ID]
+	if !ok {
+		return Chef{}, ErrChefNotFound
+	}
+	if stored.Name != chef.Name {
+		s.chefsChanged(func(link ChefLink) bool { return link.ChefID == chef.ID })
+	}
+	chef.Restaurants = nil
+	s.chefs[chef.ID] = chef
+	s.refreshChefs()
+	return s.withRestaurants(chef), nil
+}
+
+func (s *memoryStore) DeleteChef(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chefs[id]; !ok {
+		return ErrChefNotFound
+	}
+	s.chefsChanged(func(link ChefLink) bool { return link.ChefID == id })
+	delete(s.chefs, id)
+	s.links = s.keepLinks(func(link ChefLink) bool { return link.ChefID != id })
+	s.refreshChefs()
+	return nil
+}
+
+func (s *memoryStore) LinkChef(ctx context.Context, link ChefLink) (ChefLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chefs[link.ChefID]; !ok {
+		return ChefLink{}, ErrChefNotFound
+	}
+	if restaurant, ok := s.restaurants[link.RestaurantID]; !ok || restaurant.DeletedAt != nil {
+		return ChefLink{}, ErrNotFound
+	}
+
+	same := func(other ChefLink) bool {
+		return other.ChefID == link.ChefID && other.RestaurantID == link.RestaurantID && other.Role == link.Role
+	}
+	unchanged := slices.ContainsFunc(s.links, func(other ChefLink) bool {
+		return same(other) && other.Start == link.Start && other.End == link.End
+	})
+	if !unchanged {
+		restaurant := s.restaurants[link.RestaurantID]
+		restaurant.Version++
+		s.restaurants[link.RestaurantID] = restaurant
+	}
+	s.links = append(s.keepLinks(func(other ChefLink) bool { return !same(other) }), ChefLink{
+		ChefID:       link.ChefID,
+		RestaurantID: link.RestaurantID,
+		Role:         link.Role,
+		Start:        link.Start,
+		End:          link.End,
+	})
+	s.refreshChefs()
+	return s.namedLinks(same)[0], nil
+}
+
+func (s *memoryStore) UnlinkChef(ctx context.Context, chefID, restaurantID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	same := func(link ChefLink) bool {
+		return link.ChefID == chefID && link.RestaurantID == restaurantID && link.Role == role
+	}
+	links := s.keepLinks(func(link ChefLink) bool { return !same(link) })
+	if len(links) == len(s.links) {
+		return ErrChefLinkNotFound
+	}
+	s.chefsChanged(same)
+	s.links = links
+	s.refreshChefs()
+	return nil
+}
+
+// saveStaff retires the current staff of a restaurant whose names aren't in
+// the list as of today, adds the names that aren't current staff yet, and
+// returns the names of the current staff
+func (s *memoryStore) saveStaff(restaurantID int, names []string, now time.Time) []string {
+	listed := map[string]bool{}
+	for _, name := range names {
+		listed[name] = true
+	}
+	current := map[string]bool{}
+	for i, member := range s.staff {
+		if member.RestaurantID != restaurantID || !member.Current() {
+			continue
+		}
+		if listed[member.Name] {
+			current[member.Name] = true
+		} else {
+			s.staff[i].End = now.Format(time.DateOnly)
+		}
+	}
+	for _, name := range names {
+		if !current[name] {
+			s.staff = append(s.staff, StaffMember{ID: s.nextStaffID, RestaurantID: restaurantID, Name: name})
+			s.nextStaffID++
+			current[name] = true
+		}
+	}
+	return s.currentStaff(restaurantID)
+}
+
+// currentStaff returns the names of a restaurant's current staff, in the
+// order they joined
+func (s *memoryStore) currentStaff(restaurantID int) []string {
+	names := []string{}
+	for _, member := range s.staff {
+		if member.RestaurantID == restaurantID && member.Current() {
+			names = append(names, member.Name)
+		}
+	}
+	return names
+}
+
+// staffChanged refreshes the Staff of a restaurant after a change to its
+// stints and bumps its version
+func (s *memoryStore) staffChanged(restaurantID int) {
+	restaurant := s.restaurants[restaurantID]
+	restaurant.Staff = s.currentStaff(restaurantID)
+	restaurant.Version++
+	s.restaurants[restaurantID] = restaurant
+}
+
+func (s *memoryStore) Roster(ctx context.Context, restaurantID int) ([]StaffMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := []StaffMember{}
+	for _, member := range s.staff {
+		if member.RestaurantID == restaurantID {
+			members = append(members, member)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].Start < members[j].Start })
+	return members, nil
+}
+
+// addStaff stores a stint at a restaurant outside the trash
+func (s *memoryStore) addStaff(member StaffMember) (StaffMember, error) {
+	if restaurant, ok := s.restaurants[member.RestaurantID]; !ok || restaurant.DeletedAt != nil {
+		return StaffMember{}, ErrNotFound
+	}
+	member.ID = s.nextStaffID
+	s.nextStaffID++
+	s.staff = append(s.staff, member)
+	s.staffChanged(member.RestaurantID)
+	return member, nil
+}
+
+// currentStint returns the index of a current stint in staff
+func (s *memoryStore) currentStint(id int) (int, error) {
+	for i, member := range s.staff {
+		if member.ID == id && member.Current() {
+			return i, nil
+		}
+	}
+	return 0, ErrStaffNotFound
+}
+
+func (s *memoryStore) AddStaff(ctx context.Context, member StaffMember) (StaffMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addStaff(member)
+}
+
+func (s *memoryStore) MoveStaff(ctx context.Context, id int, move StaffMove) (StaffMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.currentStint(id)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	next := s.staff[i]
+	next.Start, next.End = move.Date, ""
+	if move.RestaurantID != 0 {
+		next.RestaurantID = move.RestaurantID
+	}
+	if move.Role != "" {
+		next.Role = move.Role
+	}
+	if restaurant, ok := s.restaurants[next.RestaurantID]; !ok || restaurant.DeletedAt != nil {
+		return StaffMember{}, ErrNotFound
+	}
+
+	s.staff[i].End = move.Date
+	s.staffChanged(s.staff[i].RestaurantID)
+	return s.addStaff(next)
+}
+
+func (s *memoryStore) RetireStaff(ctx context.Context, id int, date string) (StaffMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.currentStint(id)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	s.staff[i].End = date
+	s.staffChanged(s.staff[i].RestaurantID)
+	return s.staff[i], nil
+}
+
+// saveMenus archives the current menus of a restaurant whose names aren't in
+// the list as of today, adds the names that aren't current menus yet, and
+// returns the names of the current menus
+func (s *memoryStore) saveMenus(restaurantID int, names []string, now time.Time) []string {
+	listed := map[string]bool{}
+	for _, name := range names {
+		listed[name] = true
+	}
+	current := map[string]bool{}
+	for i, menu := range s.menus {
+		if menu.RestaurantID != restaurantID || !menu.Current() {
+			continue
+		}
+		if listed[menu.Name] {
+			current[menu.Name] = true
+		} else {
+			s.menus[i].End = now.Format(time.DateOnly)
+		}
+	}
+	for _, name := range names {
+		if !current[name] {
+			s.menus = append(s.menus, Menu{ID: s.nextMenuID, RestaurantID: restaurantID, Name: name, Courses: []Course{}})
+			s.nextMenuID++
+			current[name] = true
+		}
+	}
+	return s.currentMenuNames(restaurantID)
+}
+
+// currentMenuNames returns the names of a restaurant's current menus, in
+// the order they were added
+func (s *memoryStore) currentMenuNames(restaurantID int) []string {
+	names := []string{}
+	for _, menu := range s.menus {
+		if menu.RestaurantID == restaurantID && menu.Current() {
+			names = append(names, menu.Name)
+		}
+	}
+	return names
+}
+
+// restaurantMenus returns copies of every menu of a restaurant, by start
+// date
+func (s *memoryStore) restaurantMenus(restaurantID int) []Menu {
+	menus := []Menu{}
+	for _, menu := range s.menus {
+		if menu.RestaurantID == restaurantID {
+			menus = append(menus, copyMenu(menu))
+		}
+	}
+	sort.SliceStable(menus, func(i, j int) bool { return menus[i].Start < menus[j].Start })
+	return menus
+}
+
+// menuChanged refreshes the Menus of a restaurant after a change to its
+// menus and bumps its version
+func (s *memoryStore) menuChanged(restaurantID int) {
+	restaurant := s.restaurants[restaurantID]
+	restaurant.Menus = s.currentMenuNames(restaurantID)
+	restaurant.Version++
+	s.restaurants[restaurantID] = restaurant
+}
+
+// menuIndex returns the index of a menu in menus
+func (s *memoryStore) menuIndex(id int) (int, error) {
+	for i, menu := range s.menus {
+		if menu.ID == id {
+			return i, nil
+		}
+	}
+	return 0, ErrMenuNotFound
+}
+
+func (s *memoryStore) Menus(ctx context.Context, restaurantID int) ([]Menu, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.restaurantMenus(restaurantID), nil
+}
+
+func (s *memoryStore) AddMenu(ctx context.Context, menu Menu) (Menu, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if restaurant, ok := s.restaurants[menu.RestaurantID]; !ok || restaurant.DeletedAt != nil {
+		return Menu{}, ErrNotFound
+	}
+	if menu.Current() {
+		for i, previous := range s.menus {
+			if previous.RestaurantID == menu.RestaurantID && previous.Current() && strings.EqualFold(previous.Name, menu.Name) {
+				s.menus[i].End = menuArchiveDate(menu)
+			}
+		}
+	}
+	menu.ID = s.nextMenuID
+	s.nextMenuID++
+	s.menus = append(s.menus, copyMenu(menu))
+	s.menuChanged(menu.RestaurantID)
+	return menu, nil
+}
+
+func (s *memoryStore) UpdateMenu(ctx context.Context, menu Menu) (Menu, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.menuIndex(menu.ID)
+	if err != nil || s.menus[i].RestaurantID != menu.RestaurantID {
+		return Menu{}, ErrMenuNotFound
+	}
+	s.menus[i] = copyMenu(menu)
+	s.menuChanged(menu.RestaurantID)
+	return menu, nil
+}
+
+func (s *memoryStore) ArchiveMenu(ctx context.Context, id int, date string) (Menu, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.menuIndex(id)
+	if err != nil || !s.menus[i].Current() {
+		return Menu{}, ErrMenuNotFound
+	}
+	s.menus[i].End = date
+	s.menuChanged(s.menus[i].RestaurantID)
+	return copyMenu(s.menus[i]), nil
+}
+
+func (s *memoryStore) DeleteMenu(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.menuIndex(id)
+	if err != nil {
+		return err
+	}
+	restaurantID := s.menus[i].RestaurantID
+	s.menus = append(s.menus[:i], s.menus[i+1:]...)
+	s.menuChanged(restaurantID)
+	return nil
+}
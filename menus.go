@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// actionMenus is the history action of a change to a restaurant's menus
+// through the menu routes
+const actionMenus = "menus"
+
+// menuDiets are the dietary tags a dish can carry
+var menuDiets = []string{"vegetarian", "vegan", "pescatarian", "gluten-free", "dairy-free", "nut-free", "halal", "kosher"}
+
+// menuAllergens are the allergens a dish can be marked as containing, the
+// major food allergens of US labeling law
+var menuAllergens = []string{"milk", "eggs", "fish", "shellfish", "tree-nuts", "peanuts", "wheat", "soy", "sesame"}
+
+// pricePattern matches an amount of money, such as 28 or 28.50
+var pricePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,3})?$`)
+
+// Menu is one version of a restaurant's menu, such as the fall tasting menu.
+// A new version of a menu archives the current one with the same name on
+// the day it starts, so a restaurant's menus together are its current menus
+// and their archive. Either date is empty when it isn't known, and End is
+// empty while the menu is current. Price is what the whole menu costs, for
+// tasting menus; dishes can have prices of their own. Courses can only be
+// sent as JSON.
+type Menu struct {
+	ID           int      `json:"id" form:"-"`
+	RestaurantID int      `json:"restaurant_id" form:"-"`
+	Name         string   `json:"name" form:"name" binding:"required"`
+	Kind         string   `json:"kind" form:"kind" binding:"omitempty,oneof=tasting 'a la carte'"`
+	Season       string   `json:"season" form:"season"`
+	Currency     string   `json:"currency" form:"currency" binding:"omitempty,iso4217"`
+	Price        string   `json:"price" form:"price" binding:"omitempty,price"`
+	Start        string   `json:"start" form:"start" binding:"omitempty,datetime=2006-01-02"`
+	End          string   `json:"end" form:"end" binding:"omitempty,datetime=2006-01-02"`
+	Courses      []Course `json:"courses" form:"-" binding:"dive"`
+}
+
+// Course is one course of a menu, or a section of an à la carte menu
+type Course struct {
+	Name   string `json:"name"`
+	Dishes []Dish `json:"dishes" binding:"dive"`
+}
+
+// Dish is one dish of a course with its dietary tags and allergens
+type Dish struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Price       string   `json:"price" binding:"omitempty,price"`
+	Diets       []string `json:"diets" binding:"dive,diet"`
+	Allergens   []string `json:"allergens" binding:"dive,allergen"`
+}
+
+// MenuArchival is the date a menu stopped being served
+type MenuArchival struct {
+	Date string `json:"date" form:"date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// Current reports whether the menu is still served
+func (menu Menu) Current() bool {
+	return menu.End == ""
+}
+
+// currentMenus returns the menus that are still served, keeping their order
+func currentMenus(menus []Menu) []Menu {
+	current := []Menu{}
+	for _, menu := range menus {
+		if menu.Current() {
+			current = append(current, menu)
+		}
+	}
+	return current
+}
+
+// archivedMenus returns the menus that are no longer served, most recently
+// archived first
+func archivedMenus(menus []Menu) []Menu {
+	archive := []Menu{}
+	for _, menu := range menus {
+		if !menu.Current() {
+			archive = append(archive, menu)
+		}
+	}
+	slices.SortStableFunc(archive, func(a, b Menu) int { return strings.Compare(b.End, a.End) })
+	return archive
+}
+
+// copyMenu returns a menu whose courses don't share memory with the
+// original
+func copyMenu(menu Menu) Menu {
+	courses := make([]Course, len(menu.Courses))
+	for i, course := range menu.Courses {
+		dishes := make([]Dish, len(course.Dishes))
+		for j, dish := range course.Dishes {
+			dish.Diets = append([]string{}, dish.Diets...)
+			dish.Allergens = append([]string{}, dish.Allergens...)
+			dishes[j] = dish
+		}
+		course.Dishes = dishes
+		courses[i] = course
+	}
+	menu.Courses = courses
+	return menu
+}
+
+// normalizeMenu trims the text of a menu and its dishes, lower-cases the
+// kind and tags and upper-cases the currency. Missing courses and tags
+// become empty ones.
+func normalizeMenu(menu *Menu) {
+	menu.Name = strings.Join(strings.Fields(menu.Name), " ")
+	menu.Kind = strings.ToLower(strings.Join(strings.Fields(menu.Kind), " "))
+	menu.Season = strings.Join(strings.Fields(menu.Season), " ")
+	menu.Currency = strings.ToUpper(strings.TrimSpace(menu.Currency))
+	menu.Price = strings.TrimSpace(menu.Price)
+	menu.Start = strings.TrimSpace(menu.Start)
+	menu.End = strings.TrimSpace(menu.End)
+	if menu.Courses == nil {
+		menu.Courses = []Course{}
+	}
+	for i := range menu.Courses {
+		course := &menu.Courses[i]
+		course.Name = strings.TrimSpace(course.Name)
+		if course.Dishes == nil {
+			course.Dishes = []Dish{}
+		}
+		for j := range course.Dishes {
+			dish := &course.Dishes[j]
+			dish.Name = strings.TrimSpace(dish.Name)
+			dish.Description = strings.TrimSpace(dish.Description)
+			dish.Price = strings.TrimSpace(dish.Price)
+			dish.Diets = normalizeTags(dish.Diets)
+			dish.Allergens = normalizeTags(dish.Allergens)
+		}
+	}
+}
+
+// normalizeTags lower-cases tags and drops blank and repeated ones
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// validateMenu checks what the binding rules can't: that the name and the
+// dish names aren't blank, that prices come with a currency, and that the
+// menu wasn't archived before it started
+func validateMenu(menu Menu) []FieldError {
+	var errs []FieldError
+	if menu.Name == "" {
+		errs = append(errs, FieldError{"name", "is required"})
+	}
+	if menu.Start != "" && menu.End != "" && menu.End < menu.Start {
+		errs = append(errs, FieldError{"end", "must not be before start"})
+	}
+	priced := menu.Price != ""
+	for i, course := range menu.Courses {
+		for j, dish := range course.Dishes {
+			if dish.Name == "" {
+				errs = append(errs, FieldError{fmt.Sprintf("courses[%d].dishes[%d].name", i, j), "is required"})
+			}
+			priced = priced || dish.Price != ""
+		}
+	}
+	if priced && menu.Currency == "" {
+		errs = append(errs, FieldError{"currency", "is required with prices"})
+	}
+	return errs
+}
+
+// menuVersionStart is the day a new current menu starts, today unless it
+// says otherwise. It archives the current menu with the same name, which
+// can't have started later.
+func menuVersionStart(menu Menu, menus []Menu, now time.Time) (string, []FieldError) {
+	start := menu.Start
+	if start == "" {
+		start = now.Format(time.DateOnly)
+	}
+	for _, previous := range menus {
+		if previous.Current() && strings.EqualFold(previous.Name, menu.Name) && start < previous.Start {
+			return "", []FieldError{{"start", "must not be before " + previous.Start + ", when the current " + previous.Name + " started"}}
+		}
+	}
+	return start, nil
+}
+
+// menuArchiveDate is the day a new version of a menu archives the current
+// one: the day it starts, or today when that isn't known
+func menuArchiveDate(menu Menu) string {
+	if menu.Start == "" {
+		return time.Now().Format(time.DateOnly)
+	}
+	return menu.Start
+}
+
+// servesDish reports whether any dish on the current menus passes the dish
+// and diet filters, or whether there are no such filters
+func (opts ListOptions) servesDish(menus []Menu) bool {
+	if opts.Dish == "" && len(opts.Diets) == 0 {
+		return true
+	}
+	dish := strings.ToLower(opts.Dish)
+	for _, menu := range currentMenus(menus) {
+		for _, course := range menu.Courses {
+			for _, served := range course.Dishes {
+				if !strings.Contains(strings.ToLower(served.Name), dish) &&
+					!strings.Contains(strings.ToLower(served.Description), dish) {
+					continue
+				}
+				if !containsAll(served.Diets, opts.Diets) {
+					continue
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsAll reports whether every one of want is in tags
+func containsAll(tags, want []string) bool {
+	for _, tag := range want {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// coursesColumn reads and writes the courses column of menus, which holds
+// the courses as a JSON array
+type coursesColumn struct {
+	courses *[]Course
+}
+
+func (c coursesColumn) Value() (driver.Value, error) {
+	courses := *c.courses
+	if courses == nil {
+		courses = []Course{}
+	}
+	document, err := json.Marshal(courses)
+	return string(document), err
+}
+
+func (c coursesColumn) Scan(src any) error {
+	var document []byte
+	switch src := src.(type) {
+	case string:
+		document = []byte(src)
+	case []byte:
+		document = src
+	default:
+		return fmt.Errorf("can't scan %T into courses", src)
+	}
+	*c.courses = []Course{}
+	return json.Unmarshal(document, c.courses)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMenu(t *testing.T) {
+	menu := Menu{
+		Name:     "  Fall   Tasting Menu ",
+		Kind:     " Tasting",
+		Currency: "usd ",
+		Courses:  []Course{{Name: " First ", Dishes: []Dish{{Name: " Hot Potato ", Diets: []string{"Vegetarian", " vegetarian", ""}}}}},
+	}
+	normalizeMenu(&menu)
+	assert.Equal(t, "Fall Tasting Menu", menu.Name)
+	assert.Equal(t, "tasting", menu.Kind)
+	assert.Equal(t, "USD", menu.Currency)
+	assert.Equal(t, Course{Name: "First", Dishes: []Dish{{Name: "Hot Potato", Diets: []string{"vegetarian"}, Allergens: []string{}}}}, menu.Courses[0])
+
+	empty := Menu{}
+	normalizeMenu(&empty)
+	assert.Equal(t, []Course{}, empty.Courses)
+}
+
+func TestValidateMenu(t *testing.T) {
+	assert.Empty(t, validateMenu(Menu{Name: "Tasting", Price: "295", Currency: "USD"}))
+	assert.Equal(t, []FieldError{
+		{"name", "is required"},
+		{"end", "must not be before start"},
+		{"courses[0].dishes[1].name", "is required"},
+		{"currency", "is required with prices"},
+	}, validateMenu(Menu{
+		Start:   "2024-09-01",
+		End:     "2024-08-01",
+		Courses: []Course{{Dishes: []Dish{{Name: "Black Truffle Explosion", Price: "30"}, {}}}},
+	}))
+}
+
+func TestMenuVersionStart(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	menus := []Menu{
+		{Name: "Tasting", Start: "2024-06-01", End: "2024-09-01"},
+		{Name: "Tasting", Start: "2024-09-01"},
+	}
+
+	start, errs := menuVersionStart(Menu{Name: "tasting"}, menus, now)
+	assert.Empty(t, errs)
+	assert.Equal(t, "2024-10-01", start)
+	start, errs = menuVersionStart(Menu{Name: "Tasting", Start: "2024-09-15"}, menus, now)
+	assert.Empty(t, errs)
+	assert.Equal(t, "2024-09-15", start)
+
+	// A new version can't start before the current one did, though archived
+	// versions don't count
+	_, errs = menuVersionStart(Menu{Name: "Tasting", Start: "2024-07-01"}, menus, now)
+	assert.Len(t, errs, 1)
+	_, errs = menuVersionStart(Menu{Name: "Bar", Start: "2024-07-01"}, menus, now)
+	assert.Empty(t, errs)
+}
+
+func TestServesDish(t *testing.T) {
+	menus := []Menu{
+		{Name: "Tasting", Courses: []Course{{Dishes: []Dish{
+			{Name: "Black Truffle Explosion", Diets: []string{}},
+			{Name: "Garden", Description: "Hearts of palm, morels", Diets: []string{"vegetarian", "gluten-free"}},
+		}}}},
+		{Name: "Summer", End: "2024-09-01", Courses: []Course{{Dishes: []Dish{{Name: "Tomato", Diets: []string{"vegan"}}}}}},
+	}
+
+	assert.True(t, ListOptions{}.servesDish(nil))
+	assert.True(t, ListOptions{Dish: "truffle"}.servesDish(menus))
+	assert.True(t, ListOptions{Dish: "MOREL"}.servesDish(menus))
+	assert.True(t, ListOptions{Diets: []string{"vegetarian", "gluten-free"}}.servesDish(menus))
+	assert.False(t, ListOptions{Dish: "truffle", Diets: []string{"vegetarian"}}.servesDish(menus))
+
+	// Archived menus aren't served any more
+	assert.False(t, ListOptions{Dish: "tomato"}.servesDish(menus))
+	assert.False(t, ListOptions{Diets: []string{"vegan"}}.servesDish(menus))
+}
@@ -0,0 +1,165 @@
+// Package migrations keeps the restaurants database schema in step with the
+// binary. Every change to the schema is an ordered Migration with the SQL to
+// apply it and the SQL to take it back out, and the schema_migrations table
+// records which versions a database has already applied.
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Migration is a single versioned change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+
+	// UpFunc runs in place of Up when it is set, for changes that depend on
+	// what the database supports, such as optional SQLite modules
+	UpFunc func(tx *sql.Tx) error
+}
+
+// up returns the step that applies the migration
+func (m Migration) up() func(tx *sql.Tx) error {
+	if m.UpFunc != nil {
+		return m.UpFunc
+	}
+	return execSQL(m.Up)
+}
+
+// execSQL returns a step that runs the given statements
+func execSQL(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// ErrDatabaseAhead is returned when the database has applied migrations that
+// this binary doesn't know about, which means it was written by a newer
+// release and serving from it could corrupt data
+var ErrDatabaseAhead = errors.New("database schema is newer than this binary")
+
+// Latest returns the version of the newest migration the binary knows about
+func Latest() int {
+	return all[len(all)-1].Version
+}
+
+// Version returns the newest migration version applied to the database, or
+// zero for a database that has never been migrated
+func Version(db *sql.DB) (int, error) {
+	if err := createVersionTable(db); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Check returns ErrDatabaseAhead if the database has a schema version newer
+// than the latest migration of this binary
+func Check(db *sql.DB) error {
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+	if version > Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d",
+			ErrDatabaseAhead, version, Latest())
+	}
+	return nil
+}
+
+// Up applies every migration that the database hasn't applied yet, in order.
+// Each migration runs in its own transaction, so a failure leaves the
+// database at the last version that applied cleanly.
+func Up(db *sql.DB) error {
+	if err := Check(db); err != nil {
+		return err
+	}
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range all {
+		if migration.Version <= version {
+			continue
+		}
+		err := apply(db, migration.up(),
+			`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+			migration.Version, migration.Name)
+		if err != nil {
+			return fmt.Errorf("applying migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts applied migrations, newest first, until the database is at the
+// target version. A target of zero reverts every migration.
+func Down(db *sql.DB, target int) error {
+	if err := Check(db); err != nil {
+		return err
+	}
+	version, err := Version(db)
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > version {
+		return fmt.Errorf("cannot migrate down from version %d to %d", version, target)
+	}
+
+	for i := len(all) - 1; i >= 0; i-- {
+		migration := all[i]
+		if migration.Version > version || migration.Version <= target {
+			continue
+		}
+		err := apply(db, execSQL(migration.Down),
+			`DELETE FROM schema_migrations WHERE version = ?`,
+			migration.Version)
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs one direction of a migration and the statement that records it
+// in schema_migrations inside a single transaction
+func apply(db *sql.DB, step func(tx *sql.Tx) error, record string, args ...any) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := step(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpAppliesEveryMigration(t *testing.T) {
+	db := openTestDB(t)
+
+	assert.NoError(t, Up(db))
+	version, err := Version(db)
+	assert.NoError(t, err)
+	assert.Equal(t, Latest(), version)
+
+	// Running again is a no-op
+	assert.NoError(t, Up(db))
+}
+
+func TestSearchIndexMigration(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+
+	// The index only exists where SQLite has FTS5, and search scans the
+	// table elsewhere
+	var fts5 bool
+	assert.NoError(t, db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5))
+	objects := func() int {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'restaurants_fts%'`).Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+	if fts5 {
+		assert.Positive(t, objects())
+	} else {
+		assert.Zero(t, objects())
+	}
+
+	// Reverting the migration drops the index and its triggers, and
+	// applying it again indexes the rows already there
+	assert.NoError(t, Down(db, 2))
+	assert.Zero(t, objects())
+	_, err := db.Exec(`
+		INSERT INTO restaurants (name, stars, address, chef, state, website, info)
+		VALUES ('Alinea', 3, '1723 N Halsted St', 'Grant Achatz', 'IL', '', '')
+	`)
+	assert.NoError(t, err)
+	assert.NoError(t, Up(db))
+	if fts5 {
+		var name string
+		err := db.QueryRow(`SELECT name FROM restaurants_fts WHERE restaurants_fts MATCH 'achatz'`).Scan(&name)
+		assert.NoError(t, err)
+		assert.Equal(t, "Alinea", name)
+	}
+}
+
+func TestUpAdoptsUnversionedDatabase(t *testing.T) {
+	db := openTestDB(t)
+
+	// The schema that main() used to create inline
+	_, err := db.Exec(`
+		CREATE TABLE restaurants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			stars INTEGER NOT NULL,
+			address TEXT NOT NULL,
+			chef TEXT NOT NULL,
+			state TEXT NOT NULL,
+			website TEXT NOT NULL,
+			info TEXT NOT NULL
+		);
+		INSERT INTO restaurants (name, stars, address, chef, state, website, info)
+		VALUES ('Alinea', 3, '1723 N Halsted St', 'Grant Achatz', 'IL', 'https://www.alinearestaurant.com', '');
+	`)
+	assert.NoError(t, err)
+
+	assert.NoError(t, Up(db))
+	var hours string
+	err = db.QueryRow(`SELECT hours FROM restaurants WHERE name = 'Alinea'`).Scan(&hours)
+	assert.NoError(t, err)
+	assert.Equal(t, "", hours)
+}
+
+func TestDownRevertsToTarget(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+
+	assert.NoError(t, Down(db, 1))
+	version, err := Version(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	_, err = db.Exec(`SELECT * FROM restaurant_staff`)
+	assert.Error(t, err)
+
+	assert.NoError(t, Down(db, 0))
+	_, err = db.Exec(`SELECT * FROM restaurants`)
+	assert.Error(t, err)
+
+	assert.Error(t, Down(db, 1))
+}
+
+func TestCheckRefusesNewerDatabase(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+
+	_, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')`, Latest()+1)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, Check(db), ErrDatabaseAhead)
+	assert.ErrorIs(t, Up(db), ErrDatabaseAhead)
+}
+
+func TestUpDeduplicatesChefs(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+	assert.NoError(t, Down(db, 8))
+
+	_, err := db.Exec(`
+		INSERT INTO restaurants (name, stars, address, chef, state, website, info) VALUES
+			('Alinea', 3, '', 'Grant Achatz', 'IL', '', ''),
+			('Next', 0, '', 'grant  achatz.', 'IL', '', ''),
+			('Roister', 1, '', 'Grant Achatz', 'IL', '', ''),
+			('Smyth', 2, '', 'John Shields', 'IL', '', ''),
+			('Lost', 0, '', ' ', 'IL', '', '');
+	`)
+	assert.NoError(t, err)
+	assert.NoError(t, Up(db))
+
+	rows, err := db.Query(`
+		SELECT restaurants.name, restaurants.chef, restaurants.version, chefs.name, restaurant_chefs.role
+		FROM restaurants
+		JOIN restaurant_chefs ON restaurant_chefs.restaurant_id = restaurants.id
+		JOIN chefs ON chefs.id = restaurant_chefs.chef_id
+		ORDER BY restaurants.id`)
+	assert.NoError(t, err)
+	defer rows.Close()
+	var links []string
+	for rows.Next() {
+		var restaurant, chef, linked, role string
+		var version int
+		assert.NoError(t, rows.Scan(&restaurant, &chef, &version, &linked, &role))
+		links = append(links, fmt.Sprintf("%s %s %d %s %s", restaurant, chef, version, linked, role))
+	}
+	assert.Equal(t, []string{
+		"Alinea Grant Achatz 1 Grant Achatz head chef",
+		"Next Grant Achatz 2 Grant Achatz head chef",
+		"Roister Grant Achatz 1 Grant Achatz head chef",
+		"Smyth John Shields 1 John Shields head chef",
+	}, links)
+
+	var chefs int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM chefs`).Scan(&chefs))
+	assert.Equal(t, 2, chefs)
+}
+
+func TestStaffRosterKeepsStaff(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+	assert.NoError(t, Down(db, 9))
+
+	_, err := db.Exec(`
+		INSERT INTO restaurants (name, stars, address, chef, state, website, info) VALUES ('Alinea', 3, '', '', 'IL', '', '');
+		INSERT INTO restaurant_staff (restaurant_id, position, name) VALUES (1, 1, 'Simon Davies'), (1, 0, 'Nick Kokonas');
+	`)
+	assert.NoError(t, err)
+	assert.NoError(t, Up(db))
+
+	names := func(query string) []string {
+		rows, err := db.Query(query)
+		assert.NoError(t, err)
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			assert.NoError(t, rows.Scan(&name))
+			names = append(names, name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"Nick Kokonas", "Simon Davies"},
+		names(`SELECT name FROM staff_members WHERE role = '' AND end_date = '' ORDER BY id`))
+
+	// Only the current staff go back onto the list
+	_, err = db.Exec(`UPDATE staff_members SET end_date = '2019-05-01' WHERE name = 'Simon Davies'`)
+	assert.NoError(t, err)
+	assert.NoError(t, Down(db, 9))
+	assert.Equal(t, []string{"Nick Kokonas"}, names(`SELECT name FROM restaurant_staff ORDER BY position`))
+}
+
+func TestMenusKeepMenuNames(t *testing.T) {
+	db := openTestDB(t)
+	assert.NoError(t, Up(db))
+	assert.NoError(t, Down(db, 10))
+
+	_, err := db.Exec(`
+		INSERT INTO restaurants (name, stars, address, chef, state, website, info) VALUES ('Alinea', 3, '', '', 'IL', '', '');
+		INSERT INTO restaurant_menus (restaurant_id, position, name) VALUES (1, 1, 'Kitchen Table'), (1, 0, 'Gallery');
+	`)
+	assert.NoError(t, err)
+	assert.NoError(t, Up(db))
+
+	names := func(query string) []string {
+		rows, err := db.Query(query)
+		assert.NoError(t, err)
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			assert.NoError(t, rows.Scan(&name))
+			names = append(names, name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"Gallery", "Kitchen Table"},
+		names(`SELECT name FROM menus WHERE end_date = '' AND courses = '[]' ORDER BY id`))
+
+	// Only the current menus go back onto the list
+	_, err = db.Exec(`UPDATE menus SET end_date = '2024-01-01' WHERE name = 'Gallery'`)
+	assert.NoError(t, err)
+	assert.NoError(t, Down(db, 10))
+	assert.Equal(t, []string{"Kitchen Table"}, names(`SELECT name FROM restaurant_menus ORDER BY position`))
+}
@@ -0,0 +1,424 @@
+package migrations
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// all lists every migration in the order it is applied. Append new
+// migrations to the end with the next version number; never edit or reorder
+// one that has already shipped.
+var all = []Migration{
+	{
+		Version: 1,
+		Name:    "create restaurants",
+		// IF NOT EXISTS adopts databases created before migrations existed,
+		// which already have this table
+		Up: `
+			CREATE TABLE IF NOT EXISTS restaurants (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				stars INTEGER NOT NULL,
+				address TEXT NOT NULL,
+				chef TEXT NOT NULL,
+				state TEXT NOT NULL,
+				website TEXT NOT NULL,
+				info TEXT NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE restaurants;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "restaurant hours, staff, photos and menus",
+		Up: `
+			ALTER TABLE restaurants ADD COLUMN hours TEXT NOT NULL DEFAULT '';
+			CREATE TABLE restaurant_staff (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				PRIMARY KEY (restaurant_id, position)
+			);
+			CREATE TABLE restaurant_photos (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				url TEXT NOT NULL,
+				PRIMARY KEY (restaurant_id, position)
+			);
+			CREATE TABLE restaurant_menus (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				PRIMARY KEY (restaurant_id, position)
+			);
+		`,
+		Down: `
+			DROP TABLE restaurant_menus;
+			DROP TABLE restaurant_photos;
+			DROP TABLE restaurant_staff;
+			ALTER TABLE restaurants DROP COLUMN hours;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "restaurant full-text search",
+		UpFunc:  createSearchIndex,
+		Down: `
+			DROP TRIGGER IF EXISTS restaurants_fts_update;
+			DROP TRIGGER IF EXISTS restaurants_fts_delete;
+			DROP TRIGGER IF EXISTS restaurants_fts_insert;
+			DROP TABLE IF EXISTS restaurants_fts;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "restaurant versions",
+		// Every existing row starts at version 1, the same as a new one
+		Up: `
+			ALTER TABLE restaurants ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+		`,
+		Down: `
+			ALTER TABLE restaurants DROP COLUMN version;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "restaurant trash",
+		Up: `
+			ALTER TABLE restaurants ADD COLUMN deleted_at TIMESTAMP;
+			CREATE INDEX restaurants_deleted_at ON restaurants (deleted_at);
+		`,
+		Down: `
+			DROP INDEX restaurants_deleted_at;
+			ALTER TABLE restaurants DROP COLUMN deleted_at;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "restaurant history",
+		// History outlives the restaurant it belongs to, so there is no
+		// foreign key; restaurant IDs are never reused
+		Up: `
+			CREATE TABLE restaurant_history (
+				revision INTEGER PRIMARY KEY AUTOINCREMENT,
+				restaurant_id INTEGER NOT NULL,
+				action TEXT NOT NULL,
+				actor TEXT NOT NULL,
+				request_id TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				changes TEXT NOT NULL,
+				restaurant TEXT NOT NULL
+			);
+			CREATE INDEX restaurant_history_restaurant ON restaurant_history (restaurant_id, revision);
+		`,
+		Down: `
+			DROP TABLE restaurant_history;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "restaurant star ratings",
+		// stars on restaurants stays as the current rating, which the store
+		// rederives from this table whenever a rating is recorded
+		Up: `
+			CREATE TABLE restaurant_ratings (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				year INTEGER NOT NULL,
+				source TEXT NOT NULL,
+				stars INTEGER NOT NULL,
+				PRIMARY KEY (restaurant_id, year, source)
+			);
+		`,
+		Down: `
+			DROP TABLE restaurant_ratings;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "restaurant schedules",
+		// SQLite has no time zone data, so whether a restaurant is open is
+		// worked out in Go and the schedule is kept as one JSON document
+		Up: `
+			ALTER TABLE restaurants ADD COLUMN schedule TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE restaurants DROP COLUMN schedule;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "chefs",
+		UpFunc:  createChefs,
+		// The chef names that the migration made consistent stay that way
+		Down: `
+			DROP TABLE restaurant_chefs;
+			DROP TABLE chefs;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "staff roster",
+		// Everyone on the old staff lists stays on as current staff, with
+		// no role or dates since none were recorded
+		Up: `
+			CREATE TABLE staff_members (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				role TEXT NOT NULL DEFAULT '',
+				start_date TEXT NOT NULL DEFAULT '',
+				end_date TEXT NOT NULL DEFAULT ''
+			);
+			CREATE INDEX staff_members_restaurant ON staff_members (restaurant_id, end_date);
+			INSERT INTO staff_members (restaurant_id, name)
+				SELECT restaurant_id, name FROM restaurant_staff ORDER BY restaurant_id, position;
+			DROP TABLE restaurant_staff;
+		`,
+		// Going back keeps only the current staff, in the order they joined
+		Down: `
+			CREATE TABLE restaurant_staff (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				PRIMARY KEY (restaurant_id, position)
+			);
+			INSERT INTO restaurant_staff (restaurant_id, position, name)
+				SELECT restaurant_id, ROW_NUMBER() OVER (PARTITION BY restaurant_id ORDER BY id) - 1, name
+				FROM staff_members WHERE end_date = '';
+			DROP TABLE staff_members;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "menus",
+		// Every menu on the old lists stays on as a current menu, with no
+		// courses or dates since none were recorded. Courses are a JSON
+		// array of courses and their dishes.
+		Up: `
+			CREATE TABLE menus (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				kind TEXT NOT NULL DEFAULT '',
+				season TEXT NOT NULL DEFAULT '',
+				currency TEXT NOT NULL DEFAULT '',
+				price TEXT NOT NULL DEFAULT '',
+				start_date TEXT NOT NULL DEFAULT '',
+				end_date TEXT NOT NULL DEFAULT '',
+				courses TEXT NOT NULL DEFAULT '[]'
+			);
+			CREATE INDEX menus_restaurant ON menus (restaurant_id, end_date);
+			INSERT INTO menus (restaurant_id, name)
+				SELECT restaurant_id, name FROM restaurant_menus ORDER BY restaurant_id, position;
+			DROP TABLE restaurant_menus;
+		`,
+		// Going back keeps only the names of the current menus
+		Down: `
+			CREATE TABLE restaurant_menus (
+				restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				PRIMARY KEY (restaurant_id, position)
+			);
+			INSERT INTO restaurant_menus (restaurant_id, position, name)
+				SELECT restaurant_id, ROW_NUMBER() OVER (PARTITION BY restaurant_id ORDER BY id) - 1, name
+				FROM menus WHERE end_date = '';
+			DROP TABLE menus;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "restaurant locations",
+		Up: `
+			ALTER TABLE restaurants ADD COLUMN latitude REAL;
+			ALTER TABLE restaurants ADD COLUMN longitude REAL;
+		` + locationIndex,
+		Down: `
+			DROP TRIGGER restaurant_locations_delete;
+			DROP TRIGGER restaurant_locations_update;
+			DROP TRIGGER restaurant_locations_insert;
+			DROP TABLE restaurant_locations;
+			ALTER TABLE restaurants DROP COLUMN longitude;
+			ALTER TABLE restaurants DROP COLUMN latitude;
+		`,
+	},
+}
+
+// locationIndex is the R*Tree index over the coordinates of restaurants,
+// with a box of one point for each restaurant that has both. The triggers
+// keep it in step with every insert, update and delete.
+const locationIndex = `
+	CREATE VIRTUAL TABLE restaurant_locations USING rtree(
+		id,
+		min_latitude, max_latitude,
+		min_longitude, max_longitude
+	);
+	CREATE TRIGGER restaurant_locations_insert AFTER INSERT ON restaurants
+	WHEN new.latitude IS NOT NULL AND new.longitude IS NOT NULL BEGIN
+		INSERT INTO restaurant_locations VALUES (new.id, new.latitude, new.latitude, new.longitude, new.longitude);
+	END;
+	CREATE TRIGGER restaurant_locations_update AFTER UPDATE OF latitude, longitude ON restaurants BEGIN
+		DELETE FROM restaurant_locations WHERE id = old.id;
+		INSERT INTO restaurant_locations
+		SELECT new.id, new.latitude, new.latitude, new.longitude, new.longitude
+		WHERE new.latitude IS NOT NULL AND new.longitude IS NOT NULL;
+	END;
+	CREATE TRIGGER restaurant_locations_delete AFTER DELETE ON restaurants BEGIN
+		DELETE FROM restaurant_locations WHERE id = old.id;
+	END;
+`
+
+// searchIndex is the FTS5 index over the text columns of restaurants. It
+// reads its content from restaurants, and the triggers keep it in step with
+// every insert, update and delete.
+const searchIndex = `
+	CREATE VIRTUAL TABLE restaurants_fts USING fts5(
+		name, chef, address, info,
+		content = 'restaurants',
+		content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	CREATE TRIGGER restaurants_fts_insert AFTER INSERT ON restaurants BEGIN
+		INSERT INTO restaurants_fts (rowid, name, chef, address, info)
+		VALUES (new.id, new.name, new.chef, new.address, new.info);
+	END;
+	CREATE TRIGGER restaurants_fts_delete AFTER DELETE ON restaurants BEGIN
+		INSERT INTO restaurants_fts (restaurants_fts, rowid, name, chef, address, info)
+		VALUES ('delete', old.id, old.name, old.chef, old.address, old.info);
+	END;
+	CREATE TRIGGER restaurants_fts_update AFTER UPDATE ON restaurants BEGIN
+		INSERT INTO restaurants_fts (restaurants_fts, rowid, name, chef, address, info)
+		VALUES ('delete', old.id, old.name, old.chef, old.address, old.info);
+		INSERT INTO restaurants_fts (rowid, name, chef, address, info)
+		VALUES (new.id, new.name, new.chef, new.address, new.info);
+	END;
+	INSERT INTO restaurants_fts (restaurants_fts) VALUES ('rebuild');
+`
+
+// createSearchIndex creates the search index when SQLite was compiled with
+// FTS5, which go-sqlite3 only does under the sqlite_fts5 build tag. Without
+// it the migration records itself and search falls back to scanning every
+// restaurant, so build with the tag before the first migration.
+func createSearchIndex(tx *sql.Tx) error {
+	var fts5 bool
+	err := tx.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	if err != nil || !fts5 {
+		return err
+	}
+	_, err = tx.Exec(searchIndex)
+	return err
+}
+
+// chefTables are the chefs and their links to restaurants. A chef can work at
+// several restaurants, in more than one role, and start and end are dates
+// that are empty when they aren't known or the chef is still there.
+const chefTables = `
+	CREATE TABLE chefs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		bio TEXT NOT NULL DEFAULT '',
+		photo TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE restaurant_chefs (
+		restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+		chef_id INTEGER NOT NULL REFERENCES chefs(id) ON DELETE CASCADE,
+		role TEXT NOT NULL,
+		start_date TEXT NOT NULL DEFAULT '',
+		end_date TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (restaurant_id, chef_id, role)
+	);
+	CREATE INDEX restaurant_chefs_chef ON restaurant_chefs (chef_id);
+`
+
+// createChefs creates the chef tables and turns the chef names already on
+// restaurants into chefs. Names that differ only in case, spacing or
+// punctuation are the same chef, who gets the spelling most restaurants
+// use, and every restaurant is changed to that spelling and linked to the
+// chef as head chef.
+func createChefs(tx *sql.Tx) error {
+	if _, err := tx.Exec(chefTables); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, chef FROM restaurants WHERE TRIM(chef) != '' ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type chef struct {
+		restaurants []int
+		spellings   map[string]int
+		first       []string
+	}
+	chefs := map[string]*chef{}
+	var keys []string
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		name = strings.Join(strings.Fields(name), " ")
+		key := chefKey(name)
+		if chefs[key] == nil {
+			chefs[key] = &chef{spellings: map[string]int{}}
+			keys = append(keys, key)
+		}
+		c := chefs[key]
+		c.restaurants = append(c.restaurants, id)
+		if c.spellings[name] == 0 {
+			c.first = append(c.first, name)
+		}
+		c.spellings[name]++
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		c := chefs[key]
+		// The most common spelling wins, and the earliest on a tie
+		name := c.first[0]
+		for _, spelling := range c.first {
+			if c.spellings[spelling] > c.spellings[name] {
+				name = spelling
+			}
+		}
+
+		result, err := tx.Exec(`INSERT INTO chefs (name) VALUES (?)`, name)
+		if err != nil {
+			return err
+		}
+		chefID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, restaurantID := range c.restaurants {
+			_, err := tx.Exec(
+				`INSERT INTO restaurant_chefs (restaurant_id, chef_id, role) VALUES (?, ?, 'head chef')`,
+				restaurantID, chefID,
+			)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				`UPDATE restaurants SET chef = ?, version = version + 1 WHERE id = ? AND chef != ?`,
+				name, restaurantID, name,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// chefKey is what two spellings of the same chef's name have in common
+func chefKey(name string) string {
+	name = strings.NewReplacer(".", "", ",", "").Replace(strings.ToLower(name))
+	return strings.Join(strings.Fields(name), " ")
+}
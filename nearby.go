@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	// earthRadius is the mean radius of the Earth in meters
+	earthRadius = 6_371_008.8
+
+	// defaultNearbyRadius and maxNearbyRadius bound the radius of a nearby
+	// search, in meters
+	defaultNearbyRadius = 5_000
+	maxNearbyRadius     = 500_000
+)
+
+// NearbyOptions is a search for the restaurants within Radius meters of a
+// point, nearest first
+type NearbyOptions struct {
+	Latitude  float64
+	Longitude float64
+	Radius    float64
+	Limit     int
+}
+
+// NearbyResult is one restaurant found by a nearby search and its distance
+// from the point searched around, in meters
+type NearbyResult struct {
+	Restaurant Restaurant `json:"restaurant"`
+	Distance   float64    `json:"distance"`
+}
+
+// parseNearbyOptions reads a nearby search from the query string: lat and
+// lng are required, radius defaults to defaultNearbyRadius and limit to
+// defaultSearchLimit
+func parseNearbyOptions(query url.Values) (NearbyOptions, error) {
+	opts := NearbyOptions{Radius: defaultNearbyRadius, Limit: defaultSearchLimit}
+
+	coordinate := func(name string, limit float64) (float64, error) {
+		value, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || math.IsNaN(value) || value < -limit || value > limit {
+			return 0, fmt.Errorf("%s must be a number from %g to %g", name, -limit, limit)
+		}
+		return value, nil
+	}
+	var err error
+	if opts.Latitude, err = coordinate("lat", 90); err != nil {
+		return opts, err
+	}
+	if opts.Longitude, err = coordinate("lng", 180); err != nil {
+		return opts, err
+	}
+
+	if value := query.Get("radius"); value != "" {
+		opts.Radius, err = strconv.ParseFloat(value, 64)
+		if err != nil || !(opts.Radius > 0 && opts.Radius <= maxNearbyRadius) {
+			return opts, fmt.Errorf("radius must be a number of meters above 0 and at most %d", maxNearbyRadius)
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		opts.Limit, err = strconv.Atoi(value)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxPageSize {
+			return opts, fmt.Errorf("limit must be a number from 1 to %d", maxPageSize)
+		}
+	}
+	return opts, nil
+}
+
+// greatCircleDistance is the distance in meters between two points along
+// the surface of the Earth, taken as a sphere
+func greatCircleDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	// The haversine formula, which stays accurate for short distances
+	lat1, lat2 = radians(lat1), radians(lat2)
+	dLat, dLng := lat2-lat1, radians(lng2-lng1)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// radians converts an angle in degrees to radians
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// geoBox is a range of latitudes and longitudes, in degrees
+type geoBox struct {
+	MinLatitude, MaxLatitude   float64
+	MinLongitude, MaxLongitude float64
+}
+
+// boundingBoxes returns the boxes that hold every point within the radius of
+// a nearby search, for the store's index to narrow the search down before
+// distances are measured. A circle that crosses the antimeridian takes two
+// boxes, one either side of it, and one that reaches a pole takes every
+// longitude.
+func (opts NearbyOptions) boundingBoxes() []geoBox {
+	// The radius as an angle at the center of the Earth, in radians
+	angle := opts.Radius / earthRadius
+	degrees := angle * 180 / math.Pi
+	box := geoBox{
+		MinLatitude:  opts.Latitude - degrees,
+		MaxLatitude:  opts.Latitude + degrees,
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+	if box.MinLatitude <= -90 || box.MaxLatitude >= 90 {
+		box.MinLatitude, box.MaxLatitude = math.Max(box.MinLatitude, -90), math.Min(box.MaxLatitude, 90)
+		return []geoBox{box}
+	}
+
+	// The widest the circle gets, which is north or south of its center
+	// since meridians meet toward the poles
+	width := math.Asin(math.Sin(angle)/math.Cos(radians(opts.Latitude))) * 180 / math.Pi
+	box.MinLongitude, box.MaxLongitude = opts.Longitude-width, opts.Longitude+width
+	switch {
+	case box.MinLongitude < -180:
+		east := box
+		east.MinLongitude, east.MaxLongitude = box.MinLongitude+360, 180
+		box.MinLongitude = -180
+		return []geoBox{box, east}
+	case box.MaxLongitude > 180:
+		west := box
+		west.MinLongitude, west.MaxLongitude = -180, box.MaxLongitude-360
+		box.MaxLongitude = 180
+		return []geoBox{box, west}
+	}
+	return []geoBox{box}
+}
+
+// nearbyRestaurants measures the distance to each restaurant that has
+// coordinates and returns up to the limit of those within the radius,
+// nearest first. Distances are rounded to the meter.
+func nearbyRestaurants(restaurants []Restaurant, opts NearbyOptions) []NearbyResult {
+	results := []NearbyResult{}
+	for _, restaurant := range restaurants {
+		if restaurant.Latitude == nil || restaurant.Longitude == nil {
+			continue
+		}
+		distance := greatCircleDistance(opts.Latitude, opts.Longitude, *restaurant.Latitude, *restaurant.Longitude)
+		if distance <= opts.Radius {
+			results = append(results, NearbyResult{Restaurant: restaurant, Distance: math.Round(distance)})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Restaurant.ID < results[j].Restaurant.ID
+	})
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// coordinates returns a latitude and longitude as the pointers a restaurant
+// keeps them in
+func coordinates(latitude, longitude float64) (*float64, *float64) {
+	return &latitude, &longitude
+}
+
+func TestGreatCircleDistance(t *testing.T) {
+	// Alinea to Smyth, across Chicago
+	assert.InDelta(t, 3_264, greatCircleDistance(41.9134, -87.6482, 41.8842, -87.6522), 5)
+	// New York to London
+	assert.InDelta(t, 5_570_000, greatCircleDistance(40.7128, -74.0060, 51.5074, -0.1278), 10_000)
+	// Either side of the antimeridian
+	assert.InDelta(t, 22_240, greatCircleDistance(0, 179.9, 0, -179.9), 10)
+	assert.Zero(t, greatCircleDistance(41.9, -87.6, 41.9, -87.6))
+}
+
+func TestBoundingBoxes(t *testing.T) {
+	boxes := NearbyOptions{Latitude: 41.9, Longitude: -87.6, Radius: 5_000}.boundingBoxes()
+	if assert.Len(t, boxes, 1) {
+		assert.InDelta(t, 41.855, boxes[0].MinLatitude, 0.001)
+		assert.InDelta(t, 41.945, boxes[0].MaxLatitude, 0.001)
+		// Degrees of longitude are shorter away from the equator
+		assert.InDelta(t, -87.660, boxes[0].MinLongitude, 0.001)
+		assert.InDelta(t, -87.540, boxes[0].MaxLongitude, 0.001)
+	}
+
+	boxes = NearbyOptions{Latitude: -17.7, Longitude: 179.9, Radius: 50_000}.boundingBoxes()
+	if assert.Len(t, boxes, 2) {
+		assert.Equal(t, 180.0, boxes[0].MaxLongitude)
+		assert.Equal(t, -180.0, boxes[1].MinLongitude)
+		assert.InDelta(t, -179.63, boxes[1].MaxLongitude, 0.01)
+	}
+
+	boxes = NearbyOptions{Latitude: 89.99, Longitude: 10, Radius: 5_000}.boundingBoxes()
+	assert.Equal(t, []geoBox{{boxes[0].MinLatitude, 90, -180, 180}}, boxes)
+}
+
+func TestParseNearbyOptions(t *testing.T) {
+	query, _ := url.ParseQuery("lat=41.9&lng=-87.6")
+	opts, err := parseNearbyOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, NearbyOptions{41.9, -87.6, defaultNearbyRadius, defaultSearchLimit}, opts)
+
+	query, _ = url.ParseQuery("lat=0&lng=180&radius=250.5&limit=3")
+	opts, err = parseNearbyOptions(query)
+	assert.NoError(t, err)
+	assert.Equal(t, NearbyOptions{0, 180, 250.5, 3}, opts)
+
+	for _, bad := range []string{"lng=-87.6", "lat=41.9", "lat=91&lng=0", "lat=0&lng=-180.5", "lat=NaN&lng=0",
+		"lat=0&lng=0&radius=0", "lat=0&lng=0&radius=far", "lat=0&lng=0&radius=500001", "lat=0&lng=0&limit=0"} {
+		query, _ = url.ParseQuery(bad)
+		_, err = parseNearbyOptions(query)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestNearbyRestaurants(t *testing.T) {
+	alinea := Restaurant{ID: 1, Name: "Alinea"}
+	alinea.Latitude, alinea.Longitude = coordinates(41.9134, -87.6482)
+	smyth := Restaurant{ID: 2, Name: "Smyth"}
+	smyth.Latitude, smyth.Longitude = coordinates(41.8842, -87.6522)
+	unknown := Restaurant{ID: 3, Name: "Somewhere"}
+
+	results := nearbyRestaurants([]Restaurant{alinea, smyth, unknown}, NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000})
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "Smyth", results[0].Restaurant.Name)
+		assert.Equal(t, 20.0, results[0].Distance)
+		assert.Equal(t, "Alinea", results[1].Restaurant.Name)
+	}
+
+	results = nearbyRestaurants([]Restaurant{alinea, smyth}, NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000, Limit: 1})
+	assert.Len(t, results, 1)
+	assert.Empty(t, nearbyRestaurants([]Restaurant{alinea, smyth}, NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 10}))
+}
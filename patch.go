@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the two PATCH document formats
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// errPatchTestFailed is returned when a test operation of a JSON Patch
+// doesn't hold, which means the restaurant changed since the client read it
+var errPatchTestFailed = errors.New("patch test failed")
+
+// patchError is a patch that is well formed JSON but can't be applied to the
+// restaurant, such as a path that doesn't exist
+type patchError struct {
+	op      int
+	message string
+}
+
+func (e *patchError) Error() string {
+	return fmt.Sprintf("patch operation %d: %s", e.op, e.message)
+}
+
+// patchRestaurant applies a JSON Merge Patch (RFC 7396) or a JSON Patch
+// (RFC 6902) to the JSON document of restaurant. Fields the patch doesn't
+// touch keep their values and fields it removes are cleared.
+func patchRestaurant(restaurant *Restaurant, body io.Reader, mediaType string, strict bool) ([]FieldError, error) {
+	document, err := json.Marshal(restaurant)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := decodeJSONValue(bytes.NewReader(document), &doc); err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case mimeMergePatch:
+		var patch any
+		if err := decodeJSONValue(body, &patch); err != nil {
+			return nil, fmt.Errorf("reading merge patch: %w", err)
+		}
+		doc = mergePatch(doc, patch)
+	case mimeJSONPatch:
+		var ops []patchOperation
+		if err := decodeJSONValue(body, &ops); err != nil {
+			return nil, fmt.Errorf("reading JSON patch: %w", err)
+		}
+		if doc, err = applyJSONPatch(doc, ops); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported patch media type %q", mediaType)
+	}
+
+	// Decode the patched document into a fresh restaurant, so removed
+	// fields end up empty rather than keeping their old values
+	document, err = json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	patched := Restaurant{}
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&patched); err != nil {
+		return []FieldError{jsonFieldError(err)}, nil
+	}
+	*restaurant = patched
+	return nil, nil
+}
+
+// decodeJSONValue decodes a single JSON value, keeping numbers exact
+func decodeJSONValue(r io.Reader, v any) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// mergePatch applies an RFC 7396 merge patch to a decoded JSON document.
+// Objects in the patch are merged member by member, a null member removes
+// that member, and any other value replaces the target outright.
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// patchOperation is one operation of an RFC 6902 JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch runs the operations of a JSON Patch against a decoded JSON
+// document in order. Either every operation applies or an error is returned.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		fail := func(format string, args ...any) error {
+			return &patchError{op: i, message: fmt.Sprintf(format, args...)}
+		}
+
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		var value any
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return nil, fail("%s needs a value", op.Op)
+			}
+			if err := decodeJSONValue(bytes.NewReader(op.Value), &value); err != nil {
+				return nil, fail("value is not valid JSON")
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			if doc, _, err = pointerRemove(doc, path); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "move", "copy":
+			from, fromErr := parsePointer(op.From)
+			if fromErr != nil {
+				return nil, fail("%v", fromErr)
+			}
+			if op.Op == "move" && isPointerPrefix(from, path) && len(from) < len(path) {
+				return nil, fail("cannot move %q into itself", op.From)
+			}
+			var moved any
+			if op.Op == "move" {
+				doc, moved, err = pointerRemove(doc, from)
+			} else {
+				moved, err = pointerGet(doc, from)
+				moved = deepCopyJSON(moved)
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, path, moved)
+			}
+		case "test":
+			var current any
+			if current, err = pointerGet(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("%w: %s is not %s", errPatchTestFailed, op.Path, op.Value)
+			}
+		default:
+			return nil, fail("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token. "-" means the end of the array and
+// is only allowed when adding.
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if token == "-" && adding {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+	limit := length - 1
+	if adding {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("index %d is out of range", index)
+	}
+	return index, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%q does not exist", token)
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds value at path and returns the new document. Adding to an
+// object member replaces it, adding into an array inserts before the index.
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		index, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:index], append([]any{value}, node[index:]...)...)
+		return pointerReplaceParent(doc, path[:len(path)-1], node)
+	}
+	return nil, fmt.Errorf("cannot add %q to a %T", last, parent)
+}
+
+// pointerRemove removes the value at path and returns the new document and
+// the value that was removed
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("%q does not exist", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []any:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = pointerReplaceParent(doc, path[:len(path)-1], node)
+		return doc, value, err
+	}
+	return nil, nil, fmt.Errorf("%q does not exist", last)
+}
+
+// pointerReplaceParent stores a resized array back at path, since growing or
+// shrinking a slice can't be done in place
+func pointerReplaceParent(doc any, path []string, array []any) (any, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = array
+	case []any:
+		index, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = array
+	}
+	return doc, nil
+}
+
+// deepCopyJSON copies a decoded JSON value so a copy operation doesn't leave
+// two paths sharing one object or array
+func deepCopyJSON(value any) any {
+	switch node := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(node))
+		for name, member := range node {
+			copied[name] = deepCopyJSON(member)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(node))
+		for i, element := range node {
+			copied[i] = deepCopyJSON(element)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	restaurant := Restaurant{
+		ID:      1,
+		Name:    "Alinea",
+		Stars:   3,
+		Address: "1723 N Halsted St",
+		Chef:    "Grant Achatz",
+		Staff:   []string{"Nick Kokonas"},
+	}
+	errs, err := patchRestaurant(&restaurant, strings.NewReader(`{"id":5,"stars":2,"chef":null,"staff":["Simon Davies"]}`), mimeMergePatch, false)
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, Restaurant{
+		ID:      5,
+		Name:    "Alinea",
+		Stars:   2,
+		Address: "1723 N Halsted St",
+		Staff:   []string{"Simon Davies"},
+	}, restaurant)
+
+	errs, err = patchRestaurant(&restaurant, strings.NewReader(`{"stars":"two"}`), mimeMergePatch, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldError{{"stars", "must be a number"}}, errs)
+
+	errs, err = patchRestaurant(&restaurant, strings.NewReader(`{"michelin":true}`), mimeMergePatch, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []FieldError{{"michelin", "is not a restaurant field"}}, errs)
+}
+
+func TestJSONPatch(t *testing.T) {
+	restaurant := Restaurant{
+		Name:   "Alinea",
+		Stars:  3,
+		Chef:   "Grant Achatz",
+		Staff:  []string{"Nick Kokonas", "Simon Davies"},
+		Photos: []string{},
+	}
+	patch := `[
+		{"op":"test","path":"/stars","value":3},
+		{"op":"replace","path":"/name","value":"Alinea Group"},
+		{"op":"add","path":"/staff/0","value":"Mike Bagale"},
+		{"op":"remove","path":"/staff/2"},
+		{"op":"add","path":"/staff/-","value":"Dave Beran"},
+		{"op":"copy","from":"/chef","path":"/info"},
+		{"op":"move","from":"/staff/0","path":"/photos/-"}
+	]`
+	errs, err := patchRestaurant(&restaurant, strings.NewReader(patch), mimeJSONPatch, false)
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, Restaurant{
+		Name:   "Alinea Group",
+		Stars:  3,
+		Chef:   "Grant Achatz",
+		Info:   "Grant Achatz",
+		Staff:  []string{"Nick Kokonas", "Dave Beran"},
+		Photos: []string{"Mike Bagale"},
+	}, restaurant)
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	for patch, want := range map[string]string{
+		`[{"op":"remove","path":"/website/x"}]`:       `patch operation 0: "x" does not exist`,
+		`[{"op":"add","path":"/staff/9","value":""}]`: "patch operation 0: index 9 is out of range",
+		`[{"op":"replace","path":"name","value":""}]`: `patch operation 0: path "name" must start with /`,
+		`[{"op":"frobnicate","path":"/name"}]`:        `patch operation 0: unknown op "frobnicate"`,
+		`[{"op":"add","path":"/name"}]`:               "patch operation 0: add needs a value",
+	} {
+		restaurant := Restaurant{Name: "Alinea", Staff: []string{}}
+		_, err := patchRestaurant(&restaurant, strings.NewReader(patch), mimeJSONPatch, false)
+		var patchErr *patchError
+		assert.ErrorAs(t, err, &patchErr, patch)
+		assert.EqualError(t, err, want)
+		assert.Equal(t, "Alinea", restaurant.Name)
+	}
+
+	restaurant := Restaurant{Stars: 2}
+	_, err := patchRestaurant(&restaurant, strings.NewReader(`[{"op":"test","path":"/stars","value":3}]`), mimeJSONPatch, false)
+	assert.ErrorIs(t, err, errPatchTestFailed)
+}
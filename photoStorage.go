@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrPhotoNotFound is returned when no photo is stored under a key
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// PhotoStorage keeps the files of uploaded photos and their variants. Keys
+// are slash separated paths such as restaurants/1/0123456789abcdef.jpg.
+type PhotoStorage interface {
+	// Put stores data under key, replacing what was there
+	Put(ctx context.Context, key, contentType string, data []byte) error
+
+	// Get opens the file stored under key and returns its size
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+
+	// DeleteAll removes every file stored under the directory dir, such as
+	// restaurants/1. There being none is not an error.
+	DeleteAll(ctx context.Context, dir string) error
+}
+
+// defaultPhotoDir is where the local backend keeps photos when PHOTO_DIR
+// isn't set
+const defaultPhotoDir = "photos"
+
+// photoStorageFromEnv builds the backend that PHOTO_STORAGE names: local, the
+// default, keeps files under PHOTO_DIR, and s3 keeps them in S3_BUCKET on
+// S3_ENDPOINT, which can be AWS or an S3-compatible server such as MinIO.
+func photoStorageFromEnv() (PhotoStorage, error) {
+	switch backend := os.Getenv("PHOTO_STORAGE"); backend {
+	case "", "local":
+		dir := os.Getenv("PHOTO_DIR")
+		if dir == "" {
+			dir = defaultPhotoDir
+		}
+		return newLocalPhotoStorage(dir), nil
+	case "s3":
+		storage := &s3PhotoStorage{
+			endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			bucket:    os.Getenv("S3_BUCKET"),
+			region:    os.Getenv("S3_REGION"),
+			accessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			client:    http.DefaultClient,
+		}
+		if storage.region == "" {
+			storage.region = "us-east-1"
+		}
+		if storage.endpoint == "" || storage.bucket == "" || storage.accessKey == "" || storage.secretKey == "" {
+			return nil, errors.New("s3 photo storage needs S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown photo storage %q, want local or s3", backend)
+	}
+}
+
+// localPhotoStorage keeps photos as files under a directory, with the key as
+// the path
+type localPhotoStorage struct {
+	dir string
+}
+
+func newLocalPhotoStorage(dir string) *localPhotoStorage {
+	return &localPhotoStorage{dir: dir}
+}
+
+// path returns the file a key is stored in. Keys that would reach outside
+// the directory have no file.
+func (s *localPhotoStorage) path(key string) (string, bool) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", false
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), true
+}
+
+func (s *localPhotoStorage) Put(ctx context.Context, key, contentType string, data []byte) error {
+	path, ok := s.path(key)
+	if !ok {
+		return fmt.Errorf("invalid photo key %q", key)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place, so a photo being
+	// served is never half written
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *localPhotoStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	path, ok := s.path(key)
+	if !ok {
+		return nil, 0, ErrPhotoNotFound
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrPhotoNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func (s *localPhotoStorage) DeleteAll(ctx context.Context, dir string) error {
+	path, ok := s.path(dir)
+	if !ok {
+		return fmt.Errorf("invalid photo directory %q", dir)
+	}
+	return os.RemoveAll(path)
+}
+
+// s3PhotoStorage keeps photos as objects in an S3 bucket. Requests use path
+// style addressing, which MinIO and other S3-compatible servers expect, and
+// are signed with AWS Signature Version 4.
+type s3PhotoStorage struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+
+	// now is the clock requests are signed with, which tests replace
+	now func() time.Time
+}
+
+// url returns the URL of the object stored under a key
+func (s *s3PhotoStorage) url(key string) string {
+	return s.endpoint + "/" + s.bucket + "/" + key
+}
+
+func (s *s3PhotoStorage) Put(ctx context.Context, key, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3PhotoStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url(key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, ErrPhotoNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, 0, s3Error(resp)
+	}
+}
+
+// s3ListResult is the part of a ListObjectsV2 response that DeleteAll reads
+type s3ListResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *s3PhotoStorage) DeleteAll(ctx context.Context, dir string) error {
+	// S3 has no directories, so every object with the prefix is listed, a
+	// page at a time, and deleted one by one
+	query := url.Values{"list-type": {"2"}, "prefix": {dir + "/"}}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"/"+s.bucket+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(req, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return s3Error(resp)
+		}
+		var list s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3 listing %s: %w", dir, err)
+		}
+
+		for _, object := range list.Contents {
+			if err := s.delete(ctx, object.Key); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+}
+
+// delete removes the object stored under a key
+func (s *s3PhotoStorage) delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.url(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// do signs a request with the given payload and sends it
+func (s *s3PhotoStorage) do(req *http.Request, payload []byte) (*http.Response, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	signS3Request(req, payload, s.region, s.accessKey, s.secretKey, now())
+	return s.client.Do(req)
+}
+
+// s3Error reads the error document of a failed S3 request
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, bytes.TrimSpace(body))
+}
+
+// signS3Request adds the x-amz-date, x-amz-content-sha256 and Authorization
+// headers that sign a request to S3 with Signature Version 4. Every header
+// already on the request is signed along with the host.
+func signS3Request(req *http.Request, payload []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	// Register the GIF decoder with image.Decode
+	_ "image/gif"
+)
+
+// actionPhotos is the history action of photos uploaded to a restaurant
+const actionPhotos = "photos"
+
+const (
+	// maxPhotoUploadBytes caps the size of one upload request, which can
+	// carry several photos
+	maxPhotoUploadBytes = 32 << 20
+
+	// maxPhotoPixels caps the size of an image once decoded, so a small file
+	// can't claim a huge canvas
+	maxPhotoPixels = 25_000_000
+
+	// photoURLPrefix is where uploaded photos are served from
+	photoURLPrefix = "/api/v1/photos/"
+)
+
+// photoTypes are the image types photos can be uploaded as, with the
+// extension the original is stored under
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// photoContentTypes are the media types photos are served as, by extension
+var photoContentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// photoVariants are the resized copies made of every photo, each fitted
+// within a square of the given side. Photos smaller than that keep their
+// size.
+var photoVariants = []struct {
+	suffix string
+	size   int
+}{
+	{"-thumb", 320},
+	{"-large", 1280},
+}
+
+// photoKeyPattern matches the keys of stored photos and their variants. The
+// name is the start of the SHA-256 of the original, so a key never changes
+// what it holds.
+var photoKeyPattern = regexp.MustCompile(`^restaurants/[0-9]+/[0-9a-f]{16}(-thumb|-large)?\.(jpg|png|gif|webp)$`)
+
+var (
+	errPhotoType    = errors.New("photos must be JPEG, PNG or GIF images")
+	errPhotoCorrupt = errors.New("is not a readable image")
+	errPhotoPixels  = fmt.Errorf("must be at most %d pixels", maxPhotoPixels)
+)
+
+// photoUpload is a decoded photo on its way to storage
+type photoUpload struct {
+	data      []byte
+	extension string
+	image     image.Image
+}
+
+// decodePhoto checks that data is an image of one of the photoTypes, judging
+// by its content rather than what the client says it is, and decodes it
+func decodePhoto(data []byte) (photoUpload, error) {
+	extension, ok := photoTypes[http.DetectContentType(data)]
+	if !ok {
+		return photoUpload{}, errPhotoType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return photoUpload{}, errPhotoCorrupt
+	}
+	if config.Width*config.Height > maxPhotoPixels {
+		return photoUpload{}, errPhotoPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return photoUpload{}, errPhotoCorrupt
+	}
+	return photoUpload{data: data, extension: extension, image: img}, nil
+}
+
+// restaurantPhotoDir is the directory of the photo storage that the photos
+// of a restaurant are stored under
+func restaurantPhotoDir(restaurantID int) string {
+	return fmt.Sprintf("restaurants/%d", restaurantID)
+}
+
+// storePhoto stores a photo of a restaurant with its variants and returns
+// the URL of the original. Each variant is stored as JPEG for JPEG photos and
+// PNG for the others, which may be transparent, and again as WebP.
+func storePhoto(ctx context.Context, storage PhotoStorage, restaurantID int, photo photoUpload) (string, error) {
+	sum := sha256.Sum256(photo.data)
+	base := restaurantPhotoDir(restaurantID) + "/" + hex.EncodeToString(sum[:8])
+
+	original := base + photo.extension
+	if err := storage.Put(ctx, original, photoContentTypes[photo.extension], photo.data); err != nil {
+		return "", err
+	}
+
+	extension := variantExtension(photo.extension)
+	for _, variant := range photoVariants {
+		resized := resizePhoto(photo.image, variant.size)
+
+		var buf bytes.Buffer
+		var err error
+		if extension == ".jpg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := storage.Put(ctx, base+variant.suffix+extension, photoContentTypes[extension], buf.Bytes()); err != nil {
+			return "", err
+		}
+
+		buf.Reset()
+		if err := encodeWebP(&buf, resized); err != nil {
+			return "", err
+		}
+		if err := storage.Put(ctx, base+variant.suffix+".webp", photoContentTypes[".webp"], buf.Bytes()); err != nil {
+			return "", err
+		}
+	}
+	return photoURLPrefix + original, nil
+}
+
+// variantExtension is the extension of the resized variants of a photo
+func variantExtension(extension string) string {
+	if extension == ".jpg" {
+		return extension
+	}
+	return ".png"
+}
+
+// resizePhoto scales an image down to fit within a square of the given side,
+// keeping its aspect ratio. Each pixel of the result is the average of the
+// pixels it covers, which is slow next to a proper filter but keeps fine
+// detail from turning into noise.
+func resizePhoto(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	newWidth, newHeight := width, height
+	switch {
+	case width <= size && height <= size:
+	case width >= height:
+		newWidth, newHeight = size, max(1, height*size/width)
+	default:
+		newWidth, newHeight = max(1, width*size/height), size
+	}
+
+	// Average premultiplied colors, so transparent pixels don't darken the
+	// edges of what they surround
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	if newWidth == width && newHeight == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := y * height / newHeight
+		y1 := max((y+1)*height/newHeight, y0+1)
+		for x := 0; x < newWidth; x++ {
+			x0 := x * width / newWidth
+			x1 := max((x+1)*width/newWidth, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Photo is one photo of a restaurant's gallery. Photos that were uploaded
+// here come with the URLs of their thumbnail and large variants, in their
+// own format and as WebP; for any other photo URL these are empty.
+type Photo struct {
+	URL           string `json:"url"`
+	Thumbnail     string `json:"thumbnail,omitempty"`
+	ThumbnailWebP string `json:"thumbnail_webp,omitempty"`
+	Large         string `json:"large,omitempty"`
+	LargeWebP     string `json:"large_webp,omitempty"`
+}
+
+// photoGallery returns the gallery of a restaurant's photo URLs
+func photoGallery(urls []string) []Photo {
+	gallery := make([]Photo, 0, len(urls))
+	for _, url := range urls {
+		photo := Photo{URL: url}
+		if key, ok := strings.CutPrefix(url, photoURLPrefix); ok && photoKeyPattern.MatchString(key) {
+			extension := path.Ext(url)
+			base := strings.TrimSuffix(url, extension)
+			variant := variantExtension(extension)
+			photo.Thumbnail = base + "-thumb" + variant
+			photo.ThumbnailWebP = base + "-thumb.webp"
+			photo.Large = base + "-large" + variant
+			photo.LargeWebP = base + "-large.webp"
+		}
+		gallery = append(gallery, photo)
+	}
+	return gallery
+}
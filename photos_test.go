@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+// testImage returns a gradient of the given size
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+// testPNG returns a gradient of the given size as a PNG file
+func testPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(width, height)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodePhoto(t *testing.T) {
+	upload, err := decodePhoto(testPNG(t, 40, 30))
+	assert.NoError(t, err)
+	assert.Equal(t, ".png", upload.extension)
+	assert.Equal(t, image.Rect(0, 0, 40, 30), upload.image.Bounds())
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, testImage(8, 8), nil))
+	upload, err = decodePhoto(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, ".jpg", upload.extension)
+
+	// The content decides the type, not the name or the client's say so
+	_, err = decodePhoto([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.ErrorIs(t, err, errPhotoType)
+	_, err = decodePhoto(testPNG(t, 4, 4)[:40])
+	assert.ErrorIs(t, err, errPhotoCorrupt)
+
+	// A PNG header claiming a huge canvas is turned away before decoding
+	huge := testPNG(t, 4, 4)
+	binary.BigEndian.PutUint32(huge[16:], 100_000)
+	binary.BigEndian.PutUint32(huge[20:], 100_000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	_, err = decodePhoto(huge)
+	assert.ErrorIs(t, err, errPhotoPixels)
+}
+
+func TestResizePhoto(t *testing.T) {
+	assert.Equal(t, image.Rect(0, 0, 320, 160), resizePhoto(testImage(1000, 500), 320).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 100, 320), resizePhoto(testImage(500, 1600), 320).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 1, 320), resizePhoto(testImage(1, 2000), 320).Bounds())
+
+	// Small photos keep their size
+	small := testImage(50, 20)
+	resized := resizePhoto(small, 320)
+	assert.Equal(t, small.Bounds(), resized.Bounds())
+	assert.Equal(t, color.RGBA{10, 5, 15, 255}, resized.RGBAAt(10, 5))
+
+	// Each pixel averages the ones it covers
+	checker := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		if (i%4+i/4)%2 == 0 {
+			checker.SetNRGBA(i%4, i/4, color.NRGBA{255, 255, 255, 255})
+		} else {
+			checker.SetNRGBA(i%4, i/4, color.NRGBA{0, 0, 0, 255})
+		}
+	}
+	assert.Equal(t, color.RGBA{128, 128, 128, 255}, resizePhoto(checker, 2).RGBAAt(1, 1))
+}
+
+func TestEncodeWebP(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, encodeWebP(&buf, testImage(300, 200)))
+	data := buf.Bytes()
+	if assert.Greater(t, len(data), 25) {
+		assert.Equal(t, "RIFF", string(data[0:4]))
+		assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:]))
+		assert.Equal(t, "WEBPVP8L", string(data[8:16]))
+		assert.Equal(t, byte(vp8lSignature), data[20])
+
+		// The VP8L header packs the width and height less one into 14 bits
+		// each, followed by whether any pixel is transparent
+		header := binary.LittleEndian.Uint32(data[21:])
+		assert.Equal(t, uint32(299), header&0x3fff)
+		assert.Equal(t, uint32(199), header>>14&0x3fff)
+		assert.Equal(t, uint32(0), header>>28&1)
+	}
+
+	var again bytes.Buffer
+	assert.NoError(t, encodeWebP(&again, testImage(300, 200)))
+	assert.Equal(t, data, again.Bytes())
+
+	assert.ErrorIs(t, encodeWebP(io.Discard, image.NewNRGBA(image.Rect(0, 0, 0, 5))), errWebPSize)
+	assert.ErrorIs(t, encodeWebP(io.Discard, image.NewNRGBA(image.Rect(0, 0, 1<<14+1, 1))), errWebPSize)
+}
+
+func TestEncodeWebPDecodes(t *testing.T) {
+	// Noise defeats the predictors, and translucent pixels need the alpha
+	// channel to survive as well
+	noise := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	seed := uint32(1)
+	for i := range noise.Pix {
+		seed = seed*1664525 + 1013904223
+		noise.Pix[i] = uint8(seed >> 24)
+	}
+	translucent := testImage(37, 23)
+	for i := 3; i < len(translucent.Pix); i += 4 {
+		translucent.Pix[i] = uint8(i * 7)
+	}
+
+	for name, img := range map[string]*image.NRGBA{
+		"gradient":    testImage(300, 200),
+		"one pixel":   testImage(1, 1),
+		"odd size":    testImage(17, 3),
+		"noise":       noise,
+		"translucent": translucent,
+	} {
+		var buf bytes.Buffer
+		assert.NoError(t, encodeWebP(&buf, img), name)
+		decoded, err := webp.Decode(&buf)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		assert.Equal(t, img.Bounds(), decoded.Bounds(), name)
+		mismatches := 0
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				if color.NRGBAModel.Convert(decoded.At(x, y)) != img.NRGBAAt(x, y) {
+					mismatches++
+				}
+			}
+		}
+		assert.Zero(t, mismatches, name)
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	// Counts that double each time make a tree as deep as there are symbols,
+	// which has to be flattened to fit the limit
+	histogram := make([]int, 30)
+	for i := range histogram {
+		histogram[i] = 1 << i
+	}
+	lengths := huffmanLengths(histogram, 15)
+	kraft := 0.0
+	for _, length := range lengths {
+		assert.LessOrEqual(t, length, 15)
+		assert.Greater(t, length, 0)
+		kraft += 1 / float64(int(1)<<length)
+	}
+	assert.Equal(t, 1.0, kraft)
+
+	code := canonicalCode([]int{2, 1, 3, 3, 0})
+	assert.Equal(t, []uint32{0b10, 0b0, 0b110, 0b111, 0}, code.codes)
+}
+
+func TestStorePhoto(t *testing.T) {
+	storage := newLocalPhotoStorage(t.TempDir())
+	upload, err := decodePhoto(testPNG(t, 2000, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := storePhoto(context.Background(), storage, 7, upload)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^/api/v1/photos/restaurants/7/[0-9a-f]{16}\.png$`, url)
+
+	gallery := photoGallery([]string{url, "https://example.com/alinea.jpg"})
+	if assert.Len(t, gallery, 2) {
+		assert.Equal(t, Photo{URL: "https://example.com/alinea.jpg"}, gallery[1])
+		photo := gallery[0]
+		assert.Equal(t, url[:len(url)-4]+"-thumb.png", photo.Thumbnail)
+		for _, variant := range []struct {
+			url    string
+			bounds image.Rectangle
+		}{
+			{photo.Thumbnail, image.Rect(0, 0, 320, 160)},
+			{photo.Large, image.Rect(0, 0, 1280, 640)},
+		} {
+			body, _, err := storage.Get(context.Background(), variant.url[len(photoURLPrefix):])
+			if assert.NoError(t, err) {
+				config, format, err := image.DecodeConfig(body)
+				body.Close()
+				assert.NoError(t, err)
+				assert.Equal(t, "png", format)
+				assert.Equal(t, variant.bounds, image.Rect(0, 0, config.Width, config.Height))
+			}
+		}
+		for _, key := range []string{photo.ThumbnailWebP, photo.LargeWebP} {
+			body, _, err := storage.Get(context.Background(), key[len(photoURLPrefix):])
+			if assert.NoError(t, err) {
+				header := make([]byte, 16)
+				io.ReadFull(body, header)
+				body.Close()
+				assert.Equal(t, "WEBPVP8L", string(header[8:]))
+			}
+		}
+	}
+}
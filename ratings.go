@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// defaultRatingSource is the guide a rating comes from when none is given,
+// and the one whose rating counts when guides disagree within a year
+const defaultRatingSource = "Michelin"
+
+// actionRate is recorded in the history when a rating changes a restaurant
+const actionRate = "rate"
+
+// Rating is the stars a guide awarded a restaurant in the edition for one
+// year
+type Rating struct {
+	Year   int    `json:"year" form:"year" binding:"required,min=1900"`
+	Source string `json:"source" form:"source"`
+	Stars  int    `json:"stars" form:"stars" binding:"min=0,max=3"`
+}
+
+// TimelineEntry is a rating alongside the stars the same guide gave the
+// restaurant in its previous edition, which is nil for the first one
+type TimelineEntry struct {
+	Rating
+	Previous *int `json:"previous"`
+	Change   int  `json:"change"`
+}
+
+// sortRatings orders ratings by year and then by source
+func sortRatings(ratings []Rating) {
+	sort.Slice(ratings, func(i, j int) bool {
+		if ratings[i].Year != ratings[j].Year {
+			return ratings[i].Year < ratings[j].Year
+		}
+		return ratings[i].Source < ratings[j].Source
+	})
+}
+
+// currentRating picks the rating that Restaurant.Stars reports: the one from
+// the latest year, preferring the default source and otherwise the first
+// source by name. It returns false when there are no ratings.
+func currentRating(ratings []Rating) (Rating, bool) {
+	var current Rating
+	found := false
+	for _, rating := range ratings {
+		switch {
+		case !found, rating.Year > current.Year:
+		case rating.Year < current.Year:
+			continue
+		case current.Source == defaultRatingSource:
+			continue
+		case rating.Source != defaultRatingSource && rating.Source > current.Source:
+			continue
+		}
+		current, found = rating, true
+	}
+	return current, found
+}
+
+// ratingTimeline follows each guide's ratings of a restaurant from year to
+// year, so gains and losses show up as the change from the year before.
+// Ratings have to be sorted already.
+func ratingTimeline(ratings []Rating) []TimelineEntry {
+	timeline := make([]TimelineEntry, len(ratings))
+	previous := map[string]int{}
+	for i, rating := range ratings {
+		timeline[i].Rating = rating
+		if stars, ok := previous[rating.Source]; ok {
+			timeline[i].Previous = &stars
+			timeline[i].Change = rating.Stars - stars
+		}
+		previous[rating.Source] = rating.Stars
+	}
+	return timeline
+}
+
+// normalizeRating trims the source and fills in the default one, spelled the
+// same way whatever case it was given in
+func normalizeRating(rating *Rating) {
+	rating.Source = strings.TrimSpace(rating.Source)
+	if rating.Source == "" || strings.EqualFold(rating.Source, defaultRatingSource) {
+		rating.Source = defaultRatingSource
+	}
+}
+
+// validateRating checks a rating against the binding rules on its fields,
+// and that its year isn't past next year's edition
+func validateRating(rating Rating, now time.Time) []FieldError {
+	errs := fieldErrors("rating", binding.Validator.ValidateStruct(rating))
+	if rating.Year > now.Year()+1 {
+		errs = append(errs, FieldError{"year", "must not be after next year"})
+	}
+	return errs
+}
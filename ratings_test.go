@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrentRating(t *testing.T) {
+	_, ok := currentRating(nil)
+	assert.False(t, ok)
+
+	current, ok := currentRating([]Rating{
+		{2023, "Michelin", 2},
+		{2024, "Gault&Millau", 3},
+		{2024, "Michelin", 3},
+		{2024, "Zagat", 1},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, Rating{2024, "Michelin", 3}, current)
+
+	// Without the default guide the first guide by name wins
+	current, _ = currentRating([]Rating{{2024, "Zagat", 1}, {2024, "Gault&Millau", 2}})
+	assert.Equal(t, Rating{2024, "Gault&Millau", 2}, current)
+}
+
+func TestRatingTimeline(t *testing.T) {
+	timeline := ratingTimeline([]Rating{
+		{2022, "Michelin", 2},
+		{2023, "Michelin", 3},
+		{2023, "Zagat", 1},
+		{2024, "Michelin", 2},
+		{2024, "Zagat", 1},
+	})
+
+	changes := []int{}
+	for _, entry := range timeline {
+		changes = append(changes, entry.Change)
+	}
+	assert.Equal(t, []int{0, 1, 0, -1, 0}, changes)
+	assert.Nil(t, timeline[0].Previous)
+	assert.Nil(t, timeline[2].Previous)
+	if assert.NotNil(t, timeline[3].Previous) {
+		assert.Equal(t, 3, *timeline[3].Previous)
+	}
+}
+
+func TestValidateRating(t *testing.T) {
+	now := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	rating := Rating{Year: 2025, Source: " michelin ", Stars: 2}
+	normalizeRating(&rating)
+	assert.Equal(t, "Michelin", rating.Source)
+	assert.Empty(t, validateRating(rating, now))
+
+	assert.Equal(t, []FieldError{
+		{"year", "must be at least 1900"},
+		{"stars", "must be at most 3"},
+	}, validateRating(Rating{Year: 1850, Stars: 4}, now))
+	assert.Equal(t, []FieldError{{"year", "must not be after next year"}}, validateRating(Rating{Year: 2026}, now))
+}
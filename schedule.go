@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// The runtime image has no zoneinfo, so the time zone database is built
+	// into the binary
+	_ "time/tzdata"
+)
+
+// Schedule is when a restaurant is open: its services on each day of the
+// week, and the dates when it keeps other hours or closes, such as holidays.
+// Times are wall clock times in TimeZone, an IANA zone like America/Chicago.
+type Schedule struct {
+	TimeZone   string      `json:"time_zone" binding:"omitempty,timezone"`
+	Weekly     []DayHours  `json:"weekly" binding:"dive"`
+	Exceptions []DateHours `json:"exceptions" binding:"dive"`
+}
+
+// DayHours is the services of one day of the week
+type DayHours struct {
+	Day      string    `json:"day" binding:"oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	Services []Service `json:"services" binding:"dive"`
+}
+
+// DateHours replaces the weekly services on one date. No services means the
+// restaurant is closed all day.
+type DateHours struct {
+	Date     string    `json:"date" binding:"datetime=2006-01-02"`
+	Name     string    `json:"name"`
+	Services []Service `json:"services" binding:"dive"`
+}
+
+// Service is one sitting, such as lunch or dinner. A service that closes at
+// or before the time it opens runs past midnight into the next day.
+type Service struct {
+	Name   string `json:"name"`
+	Opens  string `json:"opens" binding:"clock"`
+	Closes string `json:"closes" binding:"clock"`
+}
+
+// clockPattern matches a 24 hour wall clock time such as 17:30
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// weekdays are the day names of DayHours, indexed by time.Weekday
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// isZero reports whether no hours have been given
+func (s *Schedule) isZero() bool {
+	return s == nil || s.TimeZone == "" && len(s.Weekly) == 0 && len(s.Exceptions) == 0
+}
+
+// hasHours reports whether the schedule says anything about when the
+// restaurant is open
+func (s *Schedule) hasHours() bool {
+	return s != nil && (len(s.Weekly) > 0 || len(s.Exceptions) > 0)
+}
+
+// copy returns a schedule that shares no memory with the original
+func (s *Schedule) copy() *Schedule {
+	if s == nil {
+		return nil
+	}
+	schedule := *s
+	schedule.Weekly = slices.Clone(s.Weekly)
+	for i := range schedule.Weekly {
+		schedule.Weekly[i].Services = slices.Clone(s.Weekly[i].Services)
+	}
+	schedule.Exceptions = slices.Clone(s.Exceptions)
+	for i := range schedule.Exceptions {
+		schedule.Exceptions[i].Services = slices.Clone(s.Exceptions[i].Services)
+	}
+	return &schedule
+}
+
+// normalize trims the input, lower-cases the day names, turns missing lists
+// into empty ones and sorts the week from Monday and the exceptions by date
+func (s *Schedule) normalize() {
+	s.TimeZone = strings.TrimSpace(s.TimeZone)
+	if s.Weekly == nil {
+		s.Weekly = []DayHours{}
+	}
+	if s.Exceptions == nil {
+		s.Exceptions = []DateHours{}
+	}
+	normalizeServices := func(services []Service) []Service {
+		if services == nil {
+			return []Service{}
+		}
+		for i := range services {
+			services[i].Name = strings.TrimSpace(services[i].Name)
+			services[i].Opens = strings.TrimSpace(services[i].Opens)
+			services[i].Closes = strings.TrimSpace(services[i].Closes)
+		}
+		sort.SliceStable(services, func(i, j int) bool { return services[i].Opens < services[j].Opens })
+		return services
+	}
+	for i := range s.Weekly {
+		s.Weekly[i].Day = strings.ToLower(strings.TrimSpace(s.Weekly[i].Day))
+		s.Weekly[i].Services = normalizeServices(s.Weekly[i].Services)
+	}
+	for i := range s.Exceptions {
+		s.Exceptions[i].Date = strings.TrimSpace(s.Exceptions[i].Date)
+		s.Exceptions[i].Name = strings.TrimSpace(s.Exceptions[i].Name)
+		s.Exceptions[i].Services = normalizeServices(s.Exceptions[i].Services)
+	}
+
+	// Monday first, the way the week is printed on a menu
+	dayOrder := func(day string) int {
+		return (slices.Index(weekdays, day) + 6) % 7
+	}
+	sort.SliceStable(s.Weekly, func(i, j int) bool { return dayOrder(s.Weekly[i].Day) < dayOrder(s.Weekly[j].Day) })
+	sort.SliceStable(s.Exceptions, func(i, j int) bool { return s.Exceptions[i].Date < s.Exceptions[j].Date })
+}
+
+// servicesOn returns the services on a date: the exception's when the date
+// has one, and otherwise those of its day of the week
+func (s *Schedule) servicesOn(date time.Time) []Service {
+	day := date.Format(time.DateOnly)
+	for _, exception := range s.Exceptions {
+		if exception.Date == day {
+			return exception.Services
+		}
+	}
+	var services []Service
+	for _, hours := range s.Weekly {
+		if hours.Day == weekdays[date.Weekday()] {
+			services = append(services, hours.Services...)
+		}
+	}
+	return services
+}
+
+// upcoming returns the exceptions from today on, today being the date in the
+// restaurant's time zone
+func (s *Schedule) upcoming(now time.Time) []DateHours {
+	if s == nil {
+		return nil
+	}
+	if location, err := time.LoadLocation(s.TimeZone); err == nil {
+		now = now.In(location)
+	}
+	today := now.Format(time.DateOnly)
+	var upcoming []DateHours
+	for _, exception := range s.Exceptions {
+		if exception.Date >= today {
+			upcoming = append(upcoming, exception)
+		}
+	}
+	return upcoming
+}
+
+// OpenAt reports whether the restaurant is serving at an instant, judged by
+// the wall clock in its own time zone. A restaurant without a schedule, or
+// whose schedule has no valid time zone, is never open.
+func (s *Schedule) OpenAt(t time.Time) bool {
+	if s == nil || s.TimeZone == "" {
+		return false
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return false
+	}
+
+	// A service that runs past midnight is still open early the next day,
+	// so yesterday's services count too
+	local := t.In(location)
+	for _, offset := range []int{0, -1} {
+		date := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, location)
+		for _, service := range s.servicesOn(date) {
+			opens, closes := service.span(date)
+			if !t.Before(opens) && t.Before(closes) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// span returns when a service that starts on date opens and closes. The
+// date's location decides the offset, so services straddling a daylight
+// saving change last as long as the wall clock says.
+func (service Service) span(date time.Time) (opens, closes time.Time) {
+	at := func(clock string, days int) time.Time {
+		hour, minute, _ := strings.Cut(clock, ":")
+		h, _ := strconv.Atoi(hour)
+		m, _ := strconv.Atoi(minute)
+		return time.Date(date.Year(), date.Month(), date.Day()+days, h, m, 0, 0, date.Location())
+	}
+	opens, closes = at(service.Opens, 0), at(service.Closes, 0)
+	if !closes.After(opens) {
+		closes = at(service.Closes, 1)
+	}
+	return opens, closes
+}
+
+// scheduleColumn reads and writes the schedule column of restaurants, which
+// holds the schedule as a JSON document, or an empty string for a restaurant
+// without one
+type scheduleColumn struct {
+	schedule **Schedule
+}
+
+func (c scheduleColumn) Value() (driver.Value, error) {
+	if (*c.schedule).isZero() {
+		return "", nil
+	}
+	document, err := json.Marshal(*c.schedule)
+	return string(document), err
+}
+
+func (c scheduleColumn) Scan(src any) error {
+	*c.schedule = nil
+	var document []byte
+	switch src := src.(type) {
+	case nil:
+	case string:
+		document = []byte(src)
+	case []byte:
+		document = src
+	default:
+		return fmt.Errorf("can't scan %T into a schedule", src)
+	}
+	if len(document) == 0 {
+		return nil
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(document, &schedule); err != nil {
+		return err
+	}
+	*c.schedule = &schedule
+	return nil
+}
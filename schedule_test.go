@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smythSchedule is dinner from Tuesday to Saturday in Chicago, a late
+// service on Saturday night and closed on Christmas Day
+func smythSchedule() *Schedule {
+	return &Schedule{
+		TimeZone: "America/Chicago",
+		Weekly: []DayHours{
+			{Day: "tuesday", Services: []Service{{"dinner", "17:00", "22:00"}}},
+			{Day: "saturday", Services: []Service{{"late", "22:30", "01:30"}, {"dinner", "17:00", "21:30"}}},
+			{Day: "wednesday", Services: []Service{{"lunch", "11:30", "14:00"}, {"dinner", "17:00", "22:00"}}},
+		},
+		Exceptions: []DateHours{
+			{Date: "2024-12-24", Name: "Christmas Eve", Services: []Service{{"dinner", "16:00", "20:00"}}},
+			{Date: "2024-12-25", Name: "Christmas"},
+		},
+	}
+}
+
+func TestScheduleOpenAt(t *testing.T) {
+	chicago, _ := time.LoadLocation("America/Chicago")
+	schedule := smythSchedule()
+
+	for _, tc := range []struct {
+		at   time.Time
+		open bool
+	}{
+		// Tuesday 19:00 in Chicago, given in UTC and in Tokyo
+		{time.Date(2024, 6, 4, 19, 0, 0, 0, chicago), true},
+		{time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 6, 5, 9, 0, 0, 0, time.FixedZone("JST", 9*60*60)), true},
+		{time.Date(2024, 6, 4, 22, 0, 0, 0, chicago), false},
+		{time.Date(2024, 6, 5, 12, 0, 0, 0, chicago), true},
+		{time.Date(2024, 6, 5, 15, 0, 0, 0, chicago), false},
+		{time.Date(2024, 6, 3, 19, 0, 0, 0, chicago), false},
+
+		// The late Saturday service runs into Sunday morning
+		{time.Date(2024, 6, 9, 1, 0, 0, 0, chicago), true},
+		{time.Date(2024, 6, 9, 1, 30, 0, 0, chicago), false},
+
+		// Christmas falls on a Wednesday, the day before on a Tuesday
+		{time.Date(2024, 12, 25, 12, 0, 0, 0, chicago), false},
+		{time.Date(2024, 12, 24, 16, 30, 0, 0, chicago), true},
+		{time.Date(2024, 12, 24, 21, 0, 0, 0, chicago), false},
+	} {
+		assert.Equal(t, tc.open, schedule.OpenAt(tc.at), tc.at.Format(time.RFC3339))
+	}
+
+	var none *Schedule
+	assert.False(t, none.OpenAt(time.Now()))
+	assert.False(t, (&Schedule{Weekly: schedule.Weekly}).OpenAt(time.Date(2024, 6, 4, 19, 0, 0, 0, chicago)))
+}
+
+func TestScheduleNormalize(t *testing.T) {
+	schedule := Schedule{
+		TimeZone: " America/Chicago ",
+		Weekly: []DayHours{
+			{Day: "Sunday", Services: []Service{{" brunch ", "10:00", "14:00"}}},
+			{Day: "MONDAY"},
+		},
+	}
+	schedule.normalize()
+	assert.Equal(t, Schedule{
+		TimeZone: "America/Chicago",
+		Weekly: []DayHours{
+			{Day: "monday", Services: []Service{}},
+			{Day: "sunday", Services: []Service{{"brunch", "10:00", "14:00"}}},
+		},
+		Exceptions: []DateHours{},
+	}, schedule)
+
+	upcoming := smythSchedule().upcoming(time.Date(2024, 12, 25, 3, 0, 0, 0, time.UTC))
+	if assert.Len(t, upcoming, 2) {
+		assert.Equal(t, "Christmas Eve", upcoming[0].Name)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+
+	// highlightStart and highlightEnd wrap matched words in search results
+	// until markHighlights turns them into <mark> tags. Control characters
+	// can't collide with restaurant text, so the text can be escaped first.
+	highlightStart = "\x02"
+	highlightEnd   = "\x03"
+
+	// snippetWords is how many words of the info text a snippet keeps
+	snippetWords = 12
+)
+
+// SearchResult is one restaurant that matched a search query. Highlights
+// maps each field that matched to an HTML fragment of its text with the
+// matching words wrapped in <mark> tags.
+type SearchResult struct {
+	Restaurant Restaurant               `json:"restaurant"`
+	Rank       float64                  `json:"rank"`
+	Highlights map[string]template.HTML `json:"highlights"`
+}
+
+// searchFields are the text fields a search looks at, with the weight a match
+// in each one adds to the rank
+var searchFields = []struct {
+	name   string
+	weight float64
+	value  func(r Restaurant) string
+}{
+	{"name", 10, func(r Restaurant) string { return r.Name }},
+	{"chef", 5, func(r Restaurant) string { return r.Chef }},
+	{"address", 2, func(r Restaurant) string { return r.Address }},
+	{"info", 1, func(r Restaurant) string { return r.Info }},
+}
+
+// searchTokens splits a query into lowercase words
+func searchTokens(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsQuery turns a query into an FTS5 MATCH expression where every word is a
+// prefix, so a fragment like "laun" finds "Laundry". Quoting each word keeps
+// FTS5 operators in the input from being interpreted.
+func ftsQuery(tokens []string) string {
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = `"` + token + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// markHighlights escapes text for HTML and turns the highlight markers into
+// <mark> tags
+func markHighlights(text string) template.HTML {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	text = strings.ReplaceAll(text, highlightEnd, "</mark>")
+	return template.HTML(text)
+}
+
+// wordSpans returns the byte offsets of every word in text
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// highlightText wraps every word of text that starts with one of the tokens
+// in highlight markers. When limit is above zero the text is cut down to that
+// many words around the first match. It returns false if nothing matched.
+func highlightText(text string, tokens []string, limit int) (string, bool) {
+	spans := wordSpans(text)
+	matched := make([]bool, len(spans))
+	first := -1
+	for i, span := range spans {
+		word := strings.ToLower(text[span[0]:span[1]])
+		for _, token := range tokens {
+			if strings.HasPrefix(word, token) {
+				matched[i] = true
+				break
+			}
+		}
+		if matched[i] && first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	from, to := 0, len(spans)
+	if limit > 0 && len(spans) > limit {
+		from = max(first-limit/3, 0)
+		to = min(from+limit, len(spans))
+	}
+
+	var out strings.Builder
+	start := 0
+	if from > 0 {
+		out.WriteString("…")
+		start = spans[from][0]
+	}
+	for i := from; i < to; i++ {
+		out.WriteString(text[start:spans[i][0]])
+		word := text[spans[i][0]:spans[i][1]]
+		if matched[i] {
+			word = highlightStart + word + highlightEnd
+		}
+		out.WriteString(word)
+		start = spans[i][1]
+	}
+	if to < len(spans) {
+		out.WriteString("…")
+	} else {
+		out.WriteString(text[start:])
+	}
+	return out.String(), true
+}
+
+// searchRestaurants ranks restaurants against a query without a search
+// index. Every word of the query has to prefix a word in one of the search
+// fields, and each field that matches adds its weight to the rank. The
+// memory store uses it, as does the SQLite store when FTS5 isn't available.
+func searchRestaurants(restaurants []Restaurant, query string, limit int) []SearchResult {
+	tokens := searchTokens(query)
+	results := []SearchResult{}
+	if len(tokens) == 0 {
+		return results
+	}
+
+	for _, restaurant := range restaurants {
+		result := SearchResult{
+			Restaurant: restaurant,
+			Highlights: map[string]template.HTML{},
+		}
+		found := map[string]bool{}
+		for _, field := range searchFields {
+			text := field.value(restaurant)
+			words := map[string]bool{}
+			for _, span := range wordSpans(text) {
+				words[strings.ToLower(text[span[0]:span[1]])] = true
+			}
+
+			fieldMatched := false
+			for _, token := range tokens {
+				for word := range words {
+					if strings.HasPrefix(word, token) {
+						found[token] = true
+						fieldMatched = true
+					}
+				}
+			}
+			if !fieldMatched {
+				continue
+			}
+
+			limit := 0
+			if field.name == "info" {
+				limit = snippetWords
+			}
+			highlighted, _ := highlightText(text, tokens, limit)
+			result.Highlights[field.name] = markHighlights(highlighted)
+			result.Rank += field.weight
+		}
+		if len(found) == len(tokens) {
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Restaurant.ID < results[j].Restaurant.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
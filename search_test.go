@@ -0,0 +1,29 @@
+package main
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFTSQuery(t *testing.T) {
+	tokens := searchTokens(`French "Laun" OR NEAR(x)`)
+	assert.Equal(t, []string{"french", "laun", "or", "near", "x"}, tokens)
+	assert.Equal(t, `"french"* "laun"* "or"* "near"* "x"*`, ftsQuery(tokens))
+}
+
+func TestHighlightText(t *testing.T) {
+	text, ok := highlightText("The French Laundry", []string{"laun"}, 0)
+	assert.True(t, ok)
+	assert.Equal(t, template.HTML("The French <mark>Laundry</mark>"), markHighlights(text))
+
+	_, ok = highlightText("Per Se", []string{"laun"}, 0)
+	assert.False(t, ok)
+
+	text, _ = highlightText("one two three four five six seven eight nine ten", []string{"six"}, 4)
+	assert.Equal(t, template.HTML("…five <mark>six</mark> seven eight…"), markHighlights(text))
+
+	text, _ = highlightText("<b>Bold</b> & brash", []string{"bold"}, 0)
+	assert.Equal(t, template.HTML("&lt;b&gt;<mark>Bold</mark>&lt;/b&gt; &amp; brash"), markHighlights(text))
+}
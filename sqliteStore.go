@@ -0,0 +1,1347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// sqliteStore is the RestaurantStore backed by the SQLite database that the
+// migrations package manages
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(db *sql.DB) *sqliteStore {
+	return &sqliteStore{db: db}
+}
+
+const restaurantColumns = `id, name, stars, address, state, hours, schedule, website, chef, info, latitude, longitude, version, deleted_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRestaurant scans the restaurantColumns of a row, followed by any extra
+// columns the query selected. The parts of the address aren't stored, since
+// they follow from the address and state.
+func scanRestaurant(row scanner, extra ...any) (Restaurant, error) {
+	var restaurant Restaurant
+	err := row.Scan(append([]any{
+		&restaurant.ID,
+		&restaurant.Name,
+		&restaurant.Stars,
+		&restaurant.Address,
+		&restaurant.State,
+		&restaurant.Hours,
+		scheduleColumn{&restaurant.Schedule},
+		&restaurant.Website,
+		&restaurant.Chef,
+		&restaurant.Info,
+		&restaurant.Latitude,
+		&restaurant.Longitude,
+		&restaurant.Version,
+		&restaurant.DeletedAt,
+	}, extra...)...)
+	restaurant.AddressParts = addressParts(restaurant.Address, restaurant.State)
+	return restaurant, err
+}
+
+// listWhere builds the WHERE clause and its arguments for the filters in opts
+func listWhere(opts ListOptions) (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	if opts.Deleted {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	var args []any
+	if opts.MinStars != nil {
+		conditions = append(conditions, "stars >= ?")
+		args = append(args, *opts.MinStars)
+	}
+	if opts.MaxStars != nil {
+		conditions = append(conditions, "stars <= ?")
+		args = append(args, *opts.MaxStars)
+	}
+	if opts.State != "" {
+		conditions = append(conditions, "state = ? COLLATE NOCASE")
+		args = append(args, opts.State)
+	}
+	if opts.Chef != "" {
+		conditions = append(conditions, `chef LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(opts.Chef)+"%")
+	}
+	if opts.Dish != "" || len(opts.Diets) > 0 {
+		// Dishes live in the JSON courses of the current menus
+		dish := []string{
+			`(json_extract(dish.value, '$.name') LIKE ? ESCAPE '\' OR json_extract(dish.value, '$.description') LIKE ? ESCAPE '\')`,
+		}
+		pattern := "%" + likeEscaper.Replace(opts.Dish) + "%"
+		args = append(args, pattern, pattern)
+		for _, diet := range opts.Diets {
+			dish = append(dish, `EXISTS (SELECT 1 FROM json_each(dish.value, '$.diets') WHERE value = ?)`)
+			args = append(args, diet)
+		}
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM menus, json_each(menus.courses) AS course, json_each(course.value, '$.dishes') AS dish
+			WHERE menus.restaurant_id = restaurants.id AND menus.end_date = '' AND `+strings.Join(dish, " AND ")+`)`)
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *sqliteStore) List(ctx context.Context, opts ListOptions) ([]Restaurant, int, error) {
+	where, args := listWhere(opts)
+	if opts.OpenAt != nil {
+		open, err := s.openRestaurants(ctx, where, args, *opts.OpenAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		where += " AND id IN (SELECT value FROM json_each(?))"
+		args = append(args, open)
+	}
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM restaurants`+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key, descending := opts.sortKey()
+	orderBy := sortColumns[key]
+	if descending {
+		orderBy += " DESC"
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+restaurantColumns+` FROM restaurants`+where+
+			` ORDER BY `+orderBy+`, id LIMIT ? OFFSET ?`,
+		append(args, limit, opts.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	restaurants := []Restaurant{}
+	for rows.Next() {
+		restaurant, err := scanRestaurant(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	if err := loadCollections(ctx, s.db, restaurants); err != nil {
+		return nil, 0, err
+	}
+	return restaurants, total, nil
+}
+
+// openRestaurants returns the IDs of the restaurants matching a WHERE clause
+// that are open at an instant, as a JSON array. Opening hours depend on each
+// restaurant's time zone, which SQLite can't evaluate, so every schedule is
+// checked here.
+func (s *sqliteStore) openRestaurants(ctx context.Context, where string, args []any, at time.Time) (string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, schedule FROM restaurants`+where+` AND schedule != ''`, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	open := []int{}
+	for rows.Next() {
+		var id int
+		var schedule *Schedule
+		if err := rows.Scan(&id, scheduleColumn{&schedule}); err != nil {
+			return "", err
+		}
+		if schedule.OpenAt(at) {
+			open = append(open, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	ids, err := json.Marshal(open)
+	return string(ids), err
+}
+
+// hasSearchIndex reports whether the restaurants_fts table exists. Migrating
+// only creates it when SQLite was built with FTS5.
+func (s *sqliteStore) hasSearchIndex(ctx context.Context) (bool, error) {
+	var indexed bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'restaurants_fts')`,
+	).Scan(&indexed)
+	return indexed, err
+}
+
+func (s *sqliteStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	tokens := searchTokens(query)
+	if len(tokens) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	indexed, err := s.hasSearchIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		restaurants, _, err := s.List(ctx, ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return searchRestaurants(restaurants, query, limit), nil
+	}
+
+	// The index columns are in the same order as searchFields, which
+	// supplies the bm25 weights. Long info text gets a snippet rather than
+	// the whole highlighted column.
+	weights := make([]string, len(searchFields))
+	highlights := make([]string, len(searchFields))
+	for i, field := range searchFields {
+		weights[i] = fmt.Sprint(field.weight)
+		if field.name == "info" {
+			highlights[i] = fmt.Sprintf("snippet(restaurants_fts, %d, ?, ?, '…', %d) AS %s_highlight", i, snippetWords, field.name)
+		} else {
+			highlights[i] = fmt.Sprintf("highlight(restaurants_fts, %d, ?, ?) AS %s_highlight", i, field.name)
+		}
+	}
+
+	args := []any{}
+	for range searchFields {
+		args = append(args, highlightStart, highlightEnd)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, ftsQuery(tokens), limit)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+restaurantColumns+`, matches.*
+		FROM restaurants
+		JOIN (
+			SELECT rowid AS match_id,
+				bm25(restaurants_fts, `+strings.Join(weights, ", ")+`) AS score,
+				`+strings.Join(highlights, ", ")+`
+			FROM restaurants_fts
+			WHERE restaurants_fts MATCH ?
+		) AS matches ON matches.match_id = restaurants.id
+		WHERE restaurants.deleted_at IS NULL
+		ORDER BY matches.score, restaurants.id
+		LIMIT ?`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	restaurants := []Restaurant{}
+	for rows.Next() {
+		var matchID int
+		var score float64
+		texts := make([]string, len(searchFields))
+		dest := []any{&matchID, &score}
+		for i := range texts {
+			dest = append(dest, &texts[i])
+		}
+		restaurant, err := scanRestaurant(rows, dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		result := SearchResult{Rank: -score, Highlights: map[string]template.HTML{}}
+		for i, field := range searchFields {
+			if strings.Contains(texts[i], highlightStart) {
+				result.Highlights[field.name] = markHighlights(texts[i])
+			}
+		}
+		results = append(results, result)
+		restaurants = append(restaurants, restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadCollections(ctx, s.db, restaurants); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Restaurant = restaurants[i]
+	}
+	return results, nil
+}
+
+func (s *sqliteStore) Nearby(ctx context.Context, opts NearbyOptions) ([]NearbyResult, error) {
+	// The location index finds the restaurants inside the bounding boxes of
+	// the circle, and only those have their distance measured
+	var boxes []string
+	var args []any
+	for _, box := range opts.boundingBoxes() {
+		boxes = append(boxes, `(max_latitude >= ? AND min_latitude <= ? AND max_longitude >= ? AND min_longitude <= ?)`)
+		args = append(args, box.MinLatitude, box.MaxLatitude, box.MinLongitude, box.MaxLongitude)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+restaurantColumns+` FROM restaurants
+		 WHERE deleted_at IS NULL AND id IN (SELECT id FROM restaurant_locations WHERE `+strings.Join(boxes, " OR ")+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []Restaurant
+	for rows.Next() {
+		restaurant, err := scanRestaurant(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, restaurant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	results := nearbyRestaurants(candidates, opts)
+	restaurants := make([]Restaurant, len(results))
+	for i, result := range results {
+		restaurants[i] = result.Restaurant
+	}
+	if err := loadCollections(ctx, s.db, restaurants); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Restaurant = restaurants[i]
+	}
+	return results, nil
+}
+
+func (s *sqliteStore) Get(ctx context.Context, id int) (Restaurant, error) {
+	restaurant, err := scanRestaurant(s.db.QueryRowContext(ctx,
+		`SELECT `+restaurantColumns+` FROM restaurants WHERE id = ? AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Restaurant{}, ErrNotFound
+	}
+	if err != nil {
+		return Restaurant{}, err
+	}
+
+	restaurants := []Restaurant{restaurant}
+	if err := loadCollections(ctx, s.db, restaurants); err != nil {
+		return Restaurant{}, err
+	}
+	return restaurants[0], nil
+}
+
+// insertRestaurant inserts a restaurant and its collections as part of a
+// transaction and returns the new ID
+func insertRestaurant(ctx context.Context, tx *sql.Tx, restaurant Restaurant) (int, error) {
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO restaurants (name, stars, address, state, hours, schedule, website, chef, info, latitude, longitude)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		restaurant.Name,
+		restaurant.Stars,
+		restaurant.Address,
+		restaurant.State,
+		restaurant.Hours,
+		scheduleColumn{&restaurant.Schedule},
+		restaurant.Website,
+		restaurant.Chef,
+		restaurant.Info,
+		restaurant.Latitude,
+		restaurant.Longitude,
+	)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := saveCollections(ctx, tx, int(newID), restaurant); err != nil {
+		return 0, err
+	}
+	return int(newID), nil
+}
+
+func (s *sqliteStore) Create(ctx context.Context, restaurant Restaurant) (Restaurant, error) {
+	// Insert the restaurant and its collections together so a failure
+	// doesn't leave a restaurant with only part of its staff or photos
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	defer tx.Rollback()
+
+	newID, err := insertRestaurant(ctx, tx, restaurant)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Restaurant{}, err
+	}
+	return s.Get(ctx, newID)
+}
+
+func (s *sqliteStore) CreateAll(ctx context.Context, restaurants []Restaurant) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int, len(restaurants))
+	for i, restaurant := range restaurants {
+		ids[i], err = insertRestaurant(ctx, tx, restaurant)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+func (s *sqliteStore) Update(ctx context.Context, restaurant Restaurant) (Restaurant, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	defer tx.Rollback()
+
+	// Once a restaurant has ratings, its stars are the current one's
+	ratings, err := queryRatings(ctx, tx, restaurant.ID)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if current, ok := currentRating(ratings); ok {
+		restaurant.Stars = current.Stars
+	}
+
+	// Checking the version in the same statement as the write means two
+	// updates from the same version can't both succeed
+	result, err := tx.ExecContext(ctx,
+		`UPDATE restaurants
+		 SET name = ?, stars = ?, address = ?, state = ?, hours = ?, schedule = ?, website = ?, chef = ?, info = ?,
+		     latitude = ?, longitude = ?, version = version + 1
+		 WHERE id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)`,
+		restaurant.Name,
+		restaurant.Stars,
+		restaurant.Address,
+		restaurant.State,
+		restaurant.Hours,
+		scheduleColumn{&restaurant.Schedule},
+		restaurant.Website,
+		restaurant.Chef,
+		restaurant.Info,
+		restaurant.Latitude,
+		restaurant.Longitude,
+		restaurant.ID,
+		restaurant.Version,
+		restaurant.Version,
+	)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM restaurants WHERE id = ? AND deleted_at IS NULL)`, restaurant.ID).Scan(&exists)
+		switch {
+		case err != nil:
+			return Restaurant{}, err
+		case exists:
+			return Restaurant{}, ErrStaleVersion
+		}
+		return Restaurant{}, ErrNotFound
+	}
+
+	if err := saveCollections(ctx, tx, restaurant.ID, restaurant); err != nil {
+		return Restaurant{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Restaurant{}, err
+	}
+	return s.Get(ctx, restaurant.ID)
+}
+
+func (s *sqliteStore) Delete(ctx context.Context, id, version int) (Restaurant, error) {
+	now := time.Now().UTC()
+	return s.setDeletedAt(ctx, id, version, &now)
+}
+
+func (s *sqliteStore) Restore(ctx context.Context, id int) (Restaurant, error) {
+	return s.setDeletedAt(ctx, id, 0, nil)
+}
+
+// setDeletedAt moves a restaurant into the trash when deletedAt is set, or
+// out of it when deletedAt is nil, and returns the restaurant as it is
+// afterwards. Unless the version is 0, it has to be the stored version.
+func (s *sqliteStore) setDeletedAt(ctx context.Context, id, version int, deletedAt *time.Time) (Restaurant, error) {
+	condition := "deleted_at IS NULL"
+	if deletedAt == nil {
+		condition = "deleted_at IS NOT NULL"
+	}
+	// As in Update, the version is checked in the same statement as the
+	// write, so a change that lands after the caller read the restaurant
+	// isn't trashed along with it
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE restaurants SET deleted_at = ? WHERE id = ? AND (? = 0 OR version = ?) AND `+condition,
+		deletedAt, id, version, version,
+	)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var exists bool
+		err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM restaurants WHERE id = ? AND `+condition+`)`, id).Scan(&exists)
+		switch {
+		case err != nil:
+			return Restaurant{}, err
+		case exists:
+			return Restaurant{}, ErrStaleVersion
+		}
+		return Restaurant{}, ErrNotFound
+	}
+
+	restaurant, err := scanRestaurant(s.db.QueryRowContext(ctx,
+		`SELECT `+restaurantColumns+` FROM restaurants WHERE id = ?`, id))
+	if err != nil {
+		return Restaurant{}, err
+	}
+	restaurants := []Restaurant{restaurant}
+	if err := loadCollections(ctx, s.db, restaurants); err != nil {
+		return Restaurant{}, err
+	}
+	return restaurants[0], nil
+}
+
+func (s *sqliteStore) Purge(ctx context.Context, before time.Time) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Remove the photos, staff, menus, ratings and chef links along with the
+	// restaurants
+	expired := `SELECT id FROM restaurants WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	rows, err := tx.QueryContext(ctx, expired+` ORDER BY id`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	purged := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		purged = append(purged, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, collection := range restaurantCollections {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE restaurant_id IN (%s)`, collection.table, expired),
+			before.UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, table := range []string{"staff_members", "menus", "restaurant_ratings", "restaurant_chefs"} {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE restaurant_id IN (%s)`, table, expired),
+			before.UTC(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM restaurants WHERE deleted_at IS NOT NULL AND deleted_at < ?`,
+		before.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return purged, tx.Commit()
+}
+
+func (s *sqliteStore) AddHistory(ctx context.Context, entry HistoryEntry) (HistoryEntry, error) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	restaurant, err := json.Marshal(entry.Restaurant)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO restaurant_history (restaurant_id, action, actor, request_id, created_at, changes, restaurant)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.RestaurantID,
+		entry.Action,
+		entry.Actor,
+		entry.RequestID,
+		entry.Time.UTC(),
+		string(changes),
+		string(restaurant),
+	)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	revision, err := result.LastInsertId()
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	entry.Revision = int(revision)
+	return entry, nil
+}
+
+func (s *sqliteStore) History(ctx context.Context, restaurantID int) ([]HistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT revision, restaurant_id, action, actor, request_id, created_at, changes, restaurant
+		 FROM restaurant_history
+		 WHERE restaurant_id = ?
+		 ORDER BY revision DESC`,
+		restaurantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var changes, restaurant string
+		err := rows.Scan(
+			&entry.Revision,
+			&entry.RestaurantID,
+			&entry.Action,
+			&entry.Actor,
+			&entry.RequestID,
+			&entry.Time,
+			&changes,
+			&restaurant,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(restaurant), &entry.Restaurant); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+func (s *sqliteStore) AddRating(ctx context.Context, restaurantID int, rating Rating) (Restaurant, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM restaurants WHERE id = ? AND deleted_at IS NULL)`, restaurantID).Scan(&exists)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if !exists {
+		return Restaurant{}, ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO restaurant_ratings (restaurant_id, year, source, stars) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (restaurant_id, year, source) DO UPDATE SET stars = excluded.stars`,
+		restaurantID,
+		rating.Year,
+		rating.Source,
+		rating.Stars,
+	)
+	if err != nil {
+		return Restaurant{}, err
+	}
+
+	ratings, err := queryRatings(ctx, tx, restaurantID)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	current, _ := currentRating(ratings)
+	_, err = tx.ExecContext(ctx,
+		`UPDATE restaurants SET stars = ?, version = version + 1 WHERE id = ? AND stars != ?`,
+		current.Stars,
+		restaurantID,
+		current.Stars,
+	)
+	if err != nil {
+		return Restaurant{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Restaurant{}, err
+	}
+	return s.Get(ctx, restaurantID)
+}
+
+func (s *sqliteStore) Ratings(ctx context.Context, restaurantID int) ([]Rating, error) {
+	return queryRatings(ctx, s.db, restaurantID)
+}
+
+// queryRatings reads the ratings of a restaurant, in or out of a transaction
+func queryRatings(ctx context.Context, q queryer, restaurantID int) ([]Rating, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT year, source, stars FROM restaurant_ratings WHERE restaurant_id = ? ORDER BY year, source`,
+		restaurantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var rating Rating
+		if err := rows.Scan(&rating.Year, &rating.Source, &rating.Stars); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, rating)
+	}
+	return ratings, rows.Err()
+}
+
+// queryChefLinks reads the chef links matching a WHERE clause over
+// restaurant_chefs, with the names of both ends, in or out of a transaction.
+// Links are ordered by start date, then chef and restaurant name, so each
+// restaurant's and each chef's links read as a timeline.
+func queryChefLinks(ctx context.Context, q queryer, where string, args ...any) ([]ChefLink, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT restaurant_chefs.chef_id, chefs.name, restaurant_chefs.restaurant_id, restaurants.name,
+		        restaurant_chefs.role, restaurant_chefs.start_date, restaurant_chefs.end_date
+		 FROM restaurant_chefs
+		 JOIN chefs ON chefs.id = restaurant_chefs.chef_id
+		 JOIN restaurants ON restaurants.id = restaurant_chefs.restaurant_id
+		 WHERE `+where+`
+		 ORDER BY restaurant_chefs.start_date, chefs.name, restaurants.name, restaurant_chefs.role`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ChefLink{}
+	for rows.Next() {
+		var link ChefLink
+		err := rows.Scan(
+			&link.ChefID,
+			&link.ChefName,
+			&link.RestaurantID,
+			&link.RestaurantName,
+			&link.Role,
+			&link.Start,
+			&link.End,
+		)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// loadChefRestaurants fills the Restaurants of every chef in the slice,
+// leaving out the restaurants in the trash
+func loadChefRestaurants(ctx context.Context, q queryer, chefs []Chef) error {
+	if len(chefs) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Chef, len(chefs))
+	placeholders := make([]string, len(chefs))
+	ids := make([]any, len(chefs))
+	for i := range chefs {
+		byID[chefs[i].ID] = &chefs[i]
+		placeholders[i] = "?"
+		ids[i] = chefs[i].ID
+		chefs[i].Restaurants = []ChefLink{}
+	}
+
+	links, err := queryChefLinks(ctx, q,
+		fmt.Sprintf(`restaurant_chefs.chef_id IN (%s) AND restaurants.deleted_at IS NULL`, strings.Join(placeholders, ", ")),
+		ids...)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		chef := byID[link.ChefID]
+		chef.Restaurants = append(chef.Restaurants, link)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Chefs(ctx context.Context) ([]Chef, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, bio, photo FROM chefs ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+
+	chefs := []Chef{}
+	for rows.Next() {
+		var chef Chef
+		if err := rows.Scan(&chef.ID, &chef.Name, &chef.Bio, &chef.Photo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		chefs = append(chefs, chef)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadChefRestaurants(ctx, s.db, chefs); err != nil {
+		return nil, err
+	}
+	return chefs, nil
+}
+
+func (s *sqliteStore) GetChef(ctx context.Context, id int) (Chef, error) {
+	var chef Chef
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, bio, photo FROM chefs WHERE id = ?`, id).
+		Scan(&chef.ID, &chef.Name, &chef.Bio, &chef.Photo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chef{}, ErrChefNotFound
+	}
+	if err != nil {
+		return Chef{}, err
+	}
+
+	chefs := []Chef{chef}
+	if err := loadChefRestaurants(ctx, s.db, chefs); err != nil {
+		return Chef{}, err
+	}
+	return chefs[0], nil
+}
+
+func (s *sqliteStore) CreateChef(ctx context.Context, chef Chef) (Chef, error) {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO chefs (name, bio, photo) VALUES (?, ?, ?)`,
+		chef.Name,
+		chef.Bio,
+		chef.Photo,
+	)
+	if err != nil {
+		return Chef{}, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return Chef{}, err
+	}
+	return s.GetChef(ctx, int(newID))
+}
+
+// chefsChanged bumps the version of the restaurants that a chef is linked
+// to as part of a transaction, since the chefs they show are about to
+// change
+func chefsChanged(ctx context.Context, tx *sql.Tx, chefID int) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE restaurants SET version = version + 1
+		 WHERE id IN (SELECT restaurant_id FROM restaurant_chefs WHERE chef_id = ?)`,
+		chefID,
+	)
+	return err
+}
+
+func (s *sqliteStore) UpdateChef(ctx context.Context, chef Chef) (Chef, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Chef{}, err
+	}
+	defer tx.Rollback()
+
+	// The links show the chef's name, so only a new name changes the
+	// restaurants
+	var name string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM chefs WHERE id = ?`, chef.ID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chef{}, ErrChefNotFound
+	}
+	if err != nil {
+		return Chef{}, err
+	}
+	if name != chef.Name {
+		if err := chefsChanged(ctx, tx, chef.ID); err != nil {
+			return Chef{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE chefs SET name = ?, bio = ?, photo = ? WHERE id = ?`,
+		chef.Name,
+		chef.Bio,
+		chef.Photo,
+		chef.ID,
+	)
+	if err != nil {
+		return Chef{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Chef{}, err
+	}
+	return s.GetChef(ctx, chef.ID)
+}
+
+func (s *sqliteStore) DeleteChef(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := chefsChanged(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM restaurant_chefs WHERE chef_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM chefs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrChefNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LinkChef(ctx context.Context, link ChefLink) (ChefLink, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ChefLink{}, err
+	}
+	defer tx.Rollback()
+
+	var chefExists, restaurantExists bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM chefs WHERE id = ?),
+		        EXISTS (SELECT 1 FROM restaurants WHERE id = ? AND deleted_at IS NULL)`,
+		link.ChefID,
+		link.RestaurantID,
+	).Scan(&chefExists, &restaurantExists)
+	switch {
+	case err != nil:
+		return ChefLink{}, err
+	case !chefExists:
+		return ChefLink{}, ErrChefNotFound
+	case !restaurantExists:
+		return ChefLink{}, ErrNotFound
+	}
+
+	// Linking a role again with the same dates changes nothing, and leaves
+	// the restaurant's version alone
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO restaurant_chefs (restaurant_id, chef_id, role, start_date, end_date) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (restaurant_id, chef_id, role) DO UPDATE SET start_date = excluded.start_date, end_date = excluded.end_date
+		 WHERE start_date != excluded.start_date OR end_date != excluded.end_date`,
+		link.RestaurantID,
+		link.ChefID,
+		link.Role,
+		link.Start,
+		link.End,
+	)
+	if err != nil {
+		return ChefLink{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE restaurants SET version = version + 1 WHERE id = ?`, link.RestaurantID)
+		if err != nil {
+			return ChefLink{}, err
+		}
+	}
+
+	links, err := queryChefLinks(ctx, tx,
+		`restaurant_chefs.restaurant_id = ? AND restaurant_chefs.chef_id = ? AND restaurant_chefs.role = ?`,
+		link.RestaurantID, link.ChefID, link.Role)
+	if err != nil {
+		return ChefLink{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ChefLink{}, err
+	}
+	return links[0], nil
+}
+
+func (s *sqliteStore) UnlinkChef(ctx context.Context, chefID, restaurantID int, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM restaurant_chefs WHERE chef_id = ? AND restaurant_id = ? AND role = ?`,
+		chefID,
+		restaurantID,
+		role,
+	)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrChefLinkNotFound
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE restaurants SET version = version + 1 WHERE id = ?`, restaurantID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// staffColumns are the columns of staff_members in StaffMember field order
+const staffColumns = `id, restaurant_id, name, role, start_date, end_date`
+
+// scanStaffMember reads one row of staffColumns
+func scanStaffMember(row interface{ Scan(...any) error }) (StaffMember, error) {
+	var member StaffMember
+	err := row.Scan(&member.ID, &member.RestaurantID, &member.Name, &member.Role, &member.Start, &member.End)
+	return member, err
+}
+
+func (s *sqliteStore) Roster(ctx context.Context, restaurantID int) ([]StaffMember, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+staffColumns+` FROM staff_members WHERE restaurant_id = ? ORDER BY start_date, id`,
+		restaurantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []StaffMember{}
+	for rows.Next() {
+		member, err := scanStaffMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// insertStaffMember adds a stint at a restaurant outside the trash as part
+// of a transaction, and bumps the restaurant's version since its Staff may
+// have changed
+func insertStaffMember(ctx context.Context, tx *sql.Tx, member StaffMember) (StaffMember, error) {
+	result, err := tx.ExecContext(ctx,
+		`UPDATE restaurants SET version = version + 1 WHERE id = ? AND deleted_at IS NULL`,
+		member.RestaurantID,
+	)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return StaffMember{}, ErrNotFound
+	}
+
+	result, err = tx.ExecContext(ctx,
+		`INSERT INTO staff_members (restaurant_id, name, role, start_date, end_date) VALUES (?, ?, ?, ?, ?)`,
+		member.RestaurantID,
+		member.Name,
+		member.Role,
+		member.Start,
+		member.End,
+	)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return StaffMember{}, err
+	}
+	member.ID = int(newID)
+	return member, nil
+}
+
+// endStaffMember ends a current stint on a date as part of a transaction,
+// bumps its restaurant's version and returns the stint as it was before
+func endStaffMember(ctx context.Context, tx *sql.Tx, id int, date string) (StaffMember, error) {
+	member, err := scanStaffMember(tx.QueryRowContext(ctx,
+		`SELECT `+staffColumns+` FROM staff_members WHERE id = ? AND end_date = ''`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return StaffMember{}, ErrStaffNotFound
+	}
+	if err != nil {
+		return StaffMember{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE staff_members SET end_date = ? WHERE id = ?`, date, id); err != nil {
+		return StaffMember{}, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE restaurants SET version = version + 1 WHERE id = ?`, member.RestaurantID)
+	return member, err
+}
+
+func (s *sqliteStore) AddStaff(ctx context.Context, member StaffMember) (StaffMember, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	defer tx.Rollback()
+
+	member, err = insertStaffMember(ctx, tx, member)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	return member, tx.Commit()
+}
+
+func (s *sqliteStore) MoveStaff(ctx context.Context, id int, move StaffMove) (StaffMember, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	defer tx.Rollback()
+
+	member, err := endStaffMember(ctx, tx, id, move.Date)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	member.ID, member.Start, member.End = 0, move.Date, ""
+	if move.RestaurantID != 0 {
+		member.RestaurantID = move.RestaurantID
+	}
+	if move.Role != "" {
+		member.Role = move.Role
+	}
+	member, err = insertStaffMember(ctx, tx, member)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	return member, tx.Commit()
+}
+
+func (s *sqliteStore) RetireStaff(ctx context.Context, id int, date string) (StaffMember, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	defer tx.Rollback()
+
+	member, err := endStaffMember(ctx, tx, id, date)
+	if err != nil {
+		return StaffMember{}, err
+	}
+	member.End = date
+	return member, tx.Commit()
+}
+
+// menuColumns are the columns of menus in Menu field order
+const menuColumns = `id, restaurant_id, name, kind, season, currency, price, start_date, end_date, courses`
+
+// scanMenu reads one row of menuColumns
+func scanMenu(row interface{ Scan(...any) error }) (Menu, error) {
+	var menu Menu
+	err := row.Scan(&menu.ID, &menu.RestaurantID, &menu.Name, &menu.Kind, &menu.Season, &menu.Currency,
+		&menu.Price, &menu.Start, &menu.End, coursesColumn{&menu.Courses})
+	return menu, err
+}
+
+func (s *sqliteStore) Menus(ctx context.Context, restaurantID int) ([]Menu, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+menuColumns+` FROM menus WHERE restaurant_id = ? ORDER BY start_date, id`,
+		restaurantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menus := []Menu{}
+	for rows.Next() {
+		menu, err := scanMenu(rows)
+		if err != nil {
+			return nil, err
+		}
+		menus = append(menus, menu)
+	}
+	return menus, rows.Err()
+}
+
+// menuChanged bumps the version of a restaurant outside the trash as part of
+// a transaction, since its Menus may have changed and its page has, or
+// returns ErrNotFound
+func menuChanged(ctx context.Context, tx *sql.Tx, restaurantID int) error {
+	result, err := tx.ExecContext(ctx,
+		`UPDATE restaurants SET version = version + 1 WHERE id = ? AND deleted_at IS NULL`,
+		restaurantID,
+	)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// storedMenu reads a menu by ID as part of a transaction, or returns
+// ErrMenuNotFound
+func storedMenu(ctx context.Context, tx *sql.Tx, id int) (Menu, error) {
+	menu, err := scanMenu(tx.QueryRowContext(ctx, `SELECT `+menuColumns+` FROM menus WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Menu{}, ErrMenuNotFound
+	}
+	return menu, err
+}
+
+func (s *sqliteStore) AddMenu(ctx context.Context, menu Menu) (Menu, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Menu{}, err
+	}
+	defer tx.Rollback()
+
+	if err := menuChanged(ctx, tx, menu.RestaurantID); err != nil {
+		return Menu{}, err
+	}
+	if menu.Current() {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE menus SET end_date = ? WHERE restaurant_id = ? AND name = ? COLLATE NOCASE AND end_date = ''`,
+			menuArchiveDate(menu), menu.RestaurantID, menu.Name,
+		)
+		if err != nil {
+			return Menu{}, err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO menus (restaurant_id, name, kind, season, currency, price, start_date, end_date, courses)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		menu.RestaurantID,
+		menu.Name,
+		menu.Kind,
+		menu.Season,
+		menu.Currency,
+		menu.Price,
+		menu.Start,
+		menu.End,
+		coursesColumn{&menu.Courses},
+	)
+	if err != nil {
+		return Menu{}, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return Menu{}, err
+	}
+	menu.ID = int(newID)
+	return menu, tx.Commit()
+}
+
+func (s *sqliteStore) UpdateMenu(ctx context.Context, menu Menu) (Menu, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Menu{}, err
+	}
+	defer tx.Rollback()
+
+	stored, err := storedMenu(ctx, tx, menu.ID)
+	if err != nil {
+		return Menu{}, err
+	}
+	if stored.RestaurantID != menu.RestaurantID {
+		return Menu{}, ErrMenuNotFound
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE menus
+		 SET name = ?, kind = ?, season = ?, currency = ?, price = ?, start_date = ?, end_date = ?, courses = ?
+		 WHERE id = ?`,
+		menu.Name,
+		menu.Kind,
+		menu.Season,
+		menu.Currency,
+		menu.Price,
+		menu.Start,
+		menu.End,
+		coursesColumn{&menu.Courses},
+		menu.ID,
+	)
+	if err != nil {
+		return Menu{}, err
+	}
+	if err := menuChanged(ctx, tx, menu.RestaurantID); err != nil {
+		return Menu{}, err
+	}
+	return menu, tx.Commit()
+}
+
+func (s *sqliteStore) ArchiveMenu(ctx context.Context, id int, date string) (Menu, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Menu{}, err
+	}
+	defer tx.Rollback()
+
+	menu, err := storedMenu(ctx, tx, id)
+	if err != nil {
+		return Menu{}, err
+	}
+	if !menu.Current() {
+		return Menu{}, ErrMenuNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE menus SET end_date = ? WHERE id = ?`, date, id); err != nil {
+		return Menu{}, err
+	}
+	if err := menuChanged(ctx, tx, menu.RestaurantID); err != nil {
+		return Menu{}, err
+	}
+	menu.End = date
+	return menu, tx.Commit()
+}
+
+func (s *sqliteStore) DeleteMenu(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	menu, err := storedMenu(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM menus WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := menuChanged(ctx, tx, menu.RestaurantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// actionStaff is the history action of a change to a restaurant's staff
+// through the roster
+const actionStaff = "staff"
+
+// StaffMember is one stint of a person at a restaurant: the role they held
+// and the dates they started and left. Either date is empty when it isn't
+// known, and End is empty while they are still there. Moving to another
+// role or restaurant ends one stint and starts the next, so a person's
+// stints together are their tenure history.
+type StaffMember struct {
+	ID           int    `json:"id" form:"-"`
+	RestaurantID int    `json:"restaurant_id" form:"-"`
+	Name         string `json:"name" form:"name" binding:"required"`
+	Role         string `json:"role" form:"role"`
+	Start        string `json:"start" form:"start" binding:"omitempty,datetime=2006-01-02"`
+	End          string `json:"end" form:"end" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// Current reports whether the person still holds the role
+func (member StaffMember) Current() bool {
+	return member.End == ""
+}
+
+// StaffMove is where a staff member moves to and on which date. A zero
+// RestaurantID keeps them at the same restaurant and an empty Role keeps
+// their role, so a promotion only needs the role.
+type StaffMove struct {
+	RestaurantID int    `json:"restaurant_id" form:"restaurant_id"`
+	Role         string `json:"role" form:"role"`
+	Date         string `json:"date" form:"date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// StaffRetirement is the date a staff member left
+type StaffRetirement struct {
+	Date string `json:"date" form:"date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// RosterRole is everyone who has held one role at a restaurant: the current
+// holders by when they started, and past ones most recent first
+type RosterRole struct {
+	Role    string        `json:"role"`
+	Current []StaffMember `json:"current"`
+	Past    []StaffMember `json:"past"`
+}
+
+// staffRoster groups the stints at a restaurant by role, in role order with
+// the staff who have no role last
+func staffRoster(members []StaffMember) []RosterRole {
+	roster := []RosterRole{}
+	index := map[string]int{}
+	for _, member := range members {
+		i, ok := index[member.Role]
+		if !ok {
+			i = len(roster)
+			index[member.Role] = i
+			roster = append(roster, RosterRole{Role: member.Role, Current: []StaffMember{}, Past: []StaffMember{}})
+		}
+		if member.Current() {
+			roster[i].Current = append(roster[i].Current, member)
+		} else {
+			roster[i].Past = append(roster[i].Past, member)
+		}
+	}
+
+	sort.Slice(roster, func(i, j int) bool {
+		if (roster[i].Role == "") != (roster[j].Role == "") {
+			return roster[j].Role == ""
+		}
+		return roster[i].Role < roster[j].Role
+	})
+	for _, role := range roster {
+		sort.SliceStable(role.Current, func(i, j int) bool { return role.Current[i].Start < role.Current[j].Start })
+		sort.SliceStable(role.Past, func(i, j int) bool { return role.Past[i].End > role.Past[j].End })
+	}
+	return roster
+}
+
+// normalizeStaffMember trims the name and role of a staff member, and its
+// dates
+func normalizeStaffMember(member *StaffMember) {
+	member.Name = strings.Join(strings.Fields(member.Name), " ")
+	member.Role = strings.Join(strings.Fields(member.Role), " ")
+	member.Start = strings.TrimSpace(member.Start)
+	member.End = strings.TrimSpace(member.End)
+}
+
+// validateStaffMember checks what the binding rules can't: that the name
+// isn't blank and the person didn't leave before they started
+func validateStaffMember(member StaffMember) []FieldError {
+	var errs []FieldError
+	if member.Name == "" {
+		errs = append(errs, FieldError{"name", "is required"})
+	}
+	if member.Start != "" && member.End != "" && member.End < member.Start {
+		errs = append(errs, FieldError{"end", "must not be before start"})
+	}
+	return errs
+}
+
+// validateStaffDate checks the date a stint ends on, for a move or
+// retirement: it can't be before the stint started, or in the future
+func validateStaffDate(member StaffMember, date string, now time.Time) []FieldError {
+	if date < member.Start {
+		return []FieldError{{"date", "must not be before " + member.Start}}
+	}
+	if date > now.Format(time.DateOnly) {
+		return []FieldError{{"date", "must not be in the future"}}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaffRoster(t *testing.T) {
+	roster := staffRoster([]StaffMember{
+		{ID: 1, Name: "Nick Kokonas"},
+		{ID: 2, Name: "Joe Catterson", Role: "Wine Director", Start: "2005-05-04", End: "2012-01-01"},
+		{ID: 3, Name: "Craig Sindelar", Role: "Wine Director", Start: "2012-01-01", End: "2015-06-01"},
+		{ID: 4, Name: "Mike Bagale", Role: "Chef de Cuisine", Start: "2012-01-01"},
+		{ID: 5, Name: "Jason Hoy", Role: "Wine Director", Start: "2015-06-01"},
+	})
+
+	if assert.Len(t, roster, 3) {
+		assert.Equal(t, "Chef de Cuisine", roster[0].Role)
+		assert.Equal(t, "Wine Director", roster[1].Role)
+		assert.Equal(t, []StaffMember{{ID: 5, Name: "Jason Hoy", Role: "Wine Director", Start: "2015-06-01"}}, roster[1].Current)
+		if assert.Len(t, roster[1].Past, 2) {
+			assert.Equal(t, "Craig Sindelar", roster[1].Past[0].Name)
+		}
+
+		// Staff without a role come last
+		assert.Equal(t, "", roster[2].Role)
+		assert.Empty(t, roster[2].Past)
+	}
+	assert.Equal(t, []RosterRole{}, staffRoster(nil))
+}
+
+func TestValidateStaffDate(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	member := StaffMember{Start: "2020-01-01"}
+
+	assert.Empty(t, validateStaffDate(member, "2024-06-01", now))
+	assert.Empty(t, validateStaffDate(StaffMember{}, "1999-01-01", now))
+	assert.Equal(t, []FieldError{{"date", "must not be before 2020-01-01"}}, validateStaffDate(member, "2019-12-31", now))
+	assert.Equal(t, []FieldError{{"date", "must not be in the future"}}, validateStaffDate(member, "2024-06-02", now))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by a RestaurantStore when no restaurant has the
+// requested ID
+var ErrNotFound = errors.New("restaurant not found")
+
+// ErrChefNotFound is returned by a RestaurantStore when no chef has the
+// requested ID
+var ErrChefNotFound = errors.New("chef not found")
+
+// ErrChefLinkNotFound is returned when unlinking a chef from a role they
+// don't have at a restaurant
+var ErrChefLinkNotFound = errors.New("chef has no such role at the restaurant")
+
+// ErrStaffNotFound is returned by a RestaurantStore when no current staff
+// member has the requested ID
+var ErrStaffNotFound = errors.New("staff member not found")
+
+// ErrMenuNotFound is returned by a RestaurantStore when no menu has the
+// requested ID
+var ErrMenuNotFound = errors.New("menu not found")
+
+// ErrStaleVersion is returned by Update and Delete when the restaurant was
+// changed after the version being updated or deleted was read
+var ErrStaleVersion = errors.New("restaurant has changed since it was read")
+
+// RestaurantStore persists restaurants along with their staff, photos and
+// menus. Handlers only talk to the database through this interface, so tests
+// can run them against the in-memory implementation.
+type RestaurantStore interface {
+	// List returns one page of the restaurants that match the options, along
+	// with the total number of matching restaurants across every page
+	List(ctx context.Context, opts ListOptions) ([]Restaurant, int, error)
+
+	// Search returns up to limit restaurants whose name, chef, address or
+	// info match the words of a query, best matches first
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+
+	// Nearby returns up to the limit of the restaurants within the radius
+	// of a point, nearest first, with their distance from it. Restaurants
+	// without coordinates are never found.
+	Nearby(ctx context.Context, opts NearbyOptions) ([]NearbyResult, error)
+
+	// Get returns the restaurant with the given ID, or ErrNotFound. Like List
+	// and Search, it doesn't see restaurants in the trash.
+	Get(ctx context.Context, id int) (Restaurant, error)
+
+	// Create stores a new restaurant and returns it with its assigned ID
+	Create(ctx context.Context, restaurant Restaurant) (Restaurant, error)
+
+	// CreateAll stores every restaurant in a single transaction, so either
+	// all of them are created or none are, and returns their new IDs
+	CreateAll(ctx context.Context, restaurants []Restaurant) ([]int, error)
+
+	// Update replaces every field of an existing restaurant and returns the
+	// stored result with its version incremented, or ErrNotFound. When the
+	// restaurant has a version, that has to be the stored version or nothing
+	// changes and ErrStaleVersion is returned. A restaurant with ratings
+	// keeps the stars of its current rating, whatever stars it is given.
+	Update(ctx context.Context, restaurant Restaurant) (Restaurant, error)
+
+	// Delete moves a restaurant to the trash and returns it with DeletedAt
+	// set, or returns ErrNotFound. A version other than 0 has to be the
+	// stored version or nothing changes and ErrStaleVersion is returned.
+	Delete(ctx context.Context, id, version int) (Restaurant, error)
+
+	// Restore takes a restaurant back out of the trash, or returns
+	// ErrNotFound when it isn't in the trash
+	Restore(ctx context.Context, id int) (Restaurant, error)
+
+	// Purge removes the restaurants that were moved to the trash before the
+	// given time, along with their collections, and returns the IDs it
+	// removed in ascending order
+	Purge(ctx context.Context, before time.Time) ([]int, error)
+
+	// AddHistory appends an entry to the history of a restaurant and
+	// returns it with its revision number assigned
+	AddHistory(ctx context.Context, entry HistoryEntry) (HistoryEntry, error)
+
+	// History returns every entry in the history of a restaurant, newest
+	// first, including for restaurants that have since been purged
+	History(ctx context.Context, restaurantID int) ([]HistoryEntry, error)
+
+	// AddRating records the stars a guide gave a restaurant in a year,
+	// replacing any earlier rating from the same guide and year, and returns
+	// the restaurant with Stars set from its current rating. The version only
+	// goes up when that changes Stars.
+	AddRating(ctx context.Context, restaurantID int, rating Rating) (Restaurant, error)
+
+	// Ratings returns every rating of a restaurant, by year and then source
+	Ratings(ctx context.Context, restaurantID int) ([]Rating, error)
+
+	// Chefs returns every chef, by name, with their links to the
+	// restaurants outside the trash
+	Chefs(ctx context.Context) ([]Chef, error)
+
+	// GetChef returns the chef with the given ID, or ErrChefNotFound
+	GetChef(ctx context.Context, id int) (Chef, error)
+
+	// CreateChef stores a new chef and returns it with its assigned ID
+	CreateChef(ctx context.Context, chef Chef) (Chef, error)
+
+	// UpdateChef replaces the name, bio and photo of a chef, or returns
+	// ErrChefNotFound
+	UpdateChef(ctx context.Context, chef Chef) (Chef, error)
+
+	// DeleteChef removes a chef along with their links, or returns
+	// ErrChefNotFound
+	DeleteChef(ctx context.Context, id int) error
+
+	// LinkChef gives a chef a role at a restaurant, replacing the dates of
+	// the same role if they already have it, and returns the stored link.
+	// It returns ErrChefNotFound or ErrNotFound when either end is missing.
+	LinkChef(ctx context.Context, link ChefLink) (ChefLink, error)
+
+	// UnlinkChef takes a role at a restaurant away from a chef, or returns
+	// ErrChefLinkNotFound
+	UnlinkChef(ctx context.Context, chefID, restaurantID int, role string) error
+
+	// Roster returns every stint at a restaurant, current and past, by start
+	// date. A restaurant's Staff are the names of its current staff; writing
+	// Staff adds the new names as staff without a role and retires the
+	// current staff it leaves out.
+	Roster(ctx context.Context, restaurantID int) ([]StaffMember, error)
+
+	// AddStaff stores a stint at a restaurant and returns it with its
+	// assigned ID, or returns ErrNotFound
+	AddStaff(ctx context.Context, member StaffMember) (StaffMember, error)
+
+	// MoveStaff ends a current stint on the move's date and starts the next
+	// one on the same date, which it returns. It returns ErrStaffNotFound
+	// for a stint that isn't current and ErrNotFound for a restaurant that
+	// doesn't exist.
+	MoveStaff(ctx context.Context, id int, move StaffMove) (StaffMember, error)
+
+	// RetireStaff ends a current stint on a date and returns it, or returns
+	// ErrStaffNotFound
+	RetireStaff(ctx context.Context, id int, date string) (StaffMember, error)
+
+	// Menus returns every version of every menu of a restaurant, current and
+	// archived, by start date. A restaurant's Menus are the names of its
+	// current menus; writing Menus adds the new names as menus without
+	// courses and archives the current menus it leaves out.
+	Menus(ctx context.Context, restaurantID int) ([]Menu, error)
+
+	// AddMenu stores a menu and returns it with its assigned ID, or returns
+	// ErrNotFound. A current menu archives the current menu with the same
+	// name as of the day it starts.
+	AddMenu(ctx context.Context, menu Menu) (Menu, error)
+
+	// UpdateMenu replaces every field of a menu of a restaurant and returns
+	// it, or returns ErrMenuNotFound
+	UpdateMenu(ctx context.Context, menu Menu) (Menu, error)
+
+	// ArchiveMenu ends a current menu on a date and returns it, or returns
+	// ErrMenuNotFound
+	ArchiveMenu(ctx context.Context, id int, date string) (Menu, error)
+
+	// DeleteMenu removes a menu, current or archived, or returns
+	// ErrMenuNotFound
+	DeleteMenu(ctx context.Context, id int) error
+}
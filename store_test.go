@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+	"testing"
+	"time"
+
+	"github.com/jcardarelli/fancy-api/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestDB returns a migrated in-memory SQLite database that lives as long
+// as the test
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// forEachStore runs a test against every RestaurantStore implementation
+func forEachStore(t *testing.T, test func(t *testing.T, store RestaurantStore)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteStore(openTestDB(t)))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryStore())
+	})
+}
+
+func TestStoreCreateAndGet(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		created, err := store.Create(ctx, Restaurant{
+			Name:    "The French Laundry",
+			Stars:   3,
+			Address: "6640 Washington St, Yountville",
+			State:   "CA",
+			Staff:   []string{"Thomas Keller", "David Breeden"},
+			Photos:  []string{"dining-room.jpg"},
+		})
+		assert.NoError(t, err)
+		assert.NotZero(t, created.ID)
+		assert.Equal(t, []string{"Thomas Keller", "David Breeden"}, created.Staff)
+		assert.Equal(t, []string{}, created.Menus)
+		assert.Equal(t, AddressParts{"6640 Washington St", "Yountville", "CA", "", "US"}, created.AddressParts)
+
+		got, err := store.Get(ctx, created.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, created, got)
+
+		_, err = store.Get(ctx, created.ID+1)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStoreListUpdateDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		first, _ := store.Create(ctx, Restaurant{Name: "Per Se", Stars: 3})
+		second, _ := store.Create(ctx, Restaurant{Name: "Masa", Stars: 3})
+
+		restaurants, total, err := store.List(ctx, ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []Restaurant{first, second}, restaurants)
+		assert.Equal(t, 2, total)
+
+		first.Stars = 2
+		first.Menus = []string{"Chef's Tasting"}
+		updated, err := store.Update(ctx, first)
+		assert.NoError(t, err)
+		first.Version = 2
+		assert.Equal(t, first, updated)
+
+		// Writing over a version that has since been replaced fails
+		_, err = store.Update(ctx, Restaurant{ID: first.ID, Version: 1, Name: "Per Se"})
+		assert.ErrorIs(t, err, ErrStaleVersion)
+		got, _ := store.Get(ctx, first.ID)
+		assert.Equal(t, updated, got)
+
+		_, err = store.Update(ctx, Restaurant{ID: 99})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Deleting an older version leaves the restaurant where it is
+		_, err = store.Delete(ctx, first.ID, 1)
+		assert.ErrorIs(t, err, ErrStaleVersion)
+		_, err = store.Get(ctx, first.ID)
+		assert.NoError(t, err)
+
+		_, err = store.Delete(ctx, second.ID, second.Version)
+		assert.NoError(t, err)
+		_, err = store.Delete(ctx, second.ID, 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		restaurants, _, err = store.List(ctx, ListOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []Restaurant{updated}, restaurants)
+	})
+}
+
+func TestStoreTrash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Stars: 3, Staff: []string{"Nick Kokonas"}})
+		smyth, _ := store.Create(ctx, Restaurant{Name: "Smyth", Stars: 2})
+		oriole, _ := store.Create(ctx, Restaurant{Name: "Oriole", Stars: 2})
+
+		before := time.Now().Add(-time.Second)
+		deleted, err := store.Delete(ctx, alinea.ID, 0)
+		assert.NoError(t, err)
+		if assert.NotNil(t, deleted.DeletedAt) {
+			assert.WithinDuration(t, time.Now(), *deleted.DeletedAt, time.Minute)
+		}
+		assert.Equal(t, alinea.Staff, deleted.Staff)
+		store.Delete(ctx, smyth.ID, 0)
+
+		// Restaurants in the trash are hidden from everything but the trash
+		_, err = store.Get(ctx, alinea.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.Update(ctx, alinea)
+		assert.ErrorIs(t, err, ErrNotFound)
+		restaurants, total, _ := store.List(ctx, ListOptions{})
+		assert.Equal(t, []Restaurant{oriole}, restaurants)
+		assert.Equal(t, 1, total)
+		results, _ := store.Search(ctx, "alinea", 10)
+		assert.Empty(t, results)
+		trash, total, _ := store.List(ctx, ListOptions{Deleted: true, Sort: "id"})
+		assert.Equal(t, 2, total)
+		assert.Equal(t, "Alinea", trash[0].Name)
+
+		restored, err := store.Restore(ctx, alinea.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, alinea, restored)
+		_, err = store.Restore(ctx, alinea.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Purging only removes what was deleted before the cutoff
+		purged, err := store.Purge(ctx, before)
+		assert.NoError(t, err)
+		assert.Empty(t, purged)
+		purged, err = store.Purge(ctx, time.Now().Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, []int{smyth.ID}, purged)
+		_, err = store.Restore(ctx, smyth.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, total, _ = store.List(ctx, ListOptions{})
+		assert.Equal(t, 2, total)
+	})
+}
+
+func TestStoreListOptions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		for _, restaurant := range []Restaurant{
+			{Name: "Alinea", Stars: 3, State: "IL", Chef: "Grant Achatz"},
+			{Name: "Smyth", Stars: 2, State: "IL", Chef: "John Shields"},
+			{Name: "Saison", Stars: 2, State: "CA", Chef: "Paul Chung"},
+			{Name: "Benu", Stars: 1, State: "CA", Chef: "Corey Lee"},
+		} {
+			_, err := store.Create(ctx, restaurant)
+			assert.NoError(t, err)
+		}
+
+		names := func(opts ListOptions) ([]string, int) {
+			restaurants, total, err := store.List(ctx, opts)
+			assert.NoError(t, err)
+			var names []string
+			for _, restaurant := range restaurants {
+				names = append(names, restaurant.Name)
+			}
+			return names, total
+		}
+
+		two := 2
+		got, total := names(ListOptions{MinStars: &two, Sort: "-name"})
+		assert.Equal(t, []string{"Smyth", "Saison", "Alinea"}, got)
+		assert.Equal(t, 3, total)
+
+		got, _ = names(ListOptions{State: "ca", Sort: "stars"})
+		assert.Equal(t, []string{"Benu", "Saison"}, got)
+
+		got, _ = names(ListOptions{Chef: "SHIELDS"})
+		assert.Equal(t, []string{"Smyth"}, got)
+
+		got, total = names(ListOptions{Sort: "-stars", Limit: 2, Offset: 1})
+		assert.Equal(t, []string{"Smyth", "Saison"}, got)
+		assert.Equal(t, 4, total)
+	})
+}
+
+func TestStoreSearch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		laundry, _ := store.Create(ctx, Restaurant{
+			Name:    "The French Laundry",
+			Chef:    "Thomas Keller",
+			Address: "6640 Washington St, Yountville, CA 94599",
+		})
+		perSe, _ := store.Create(ctx, Restaurant{
+			Name: "Per Se",
+			Chef: "Thomas Keller",
+			Info: "Thomas Keller's New York sibling of The French Laundry",
+		})
+		store.Create(ctx, Restaurant{Name: "Alinea", Chef: "Grant Achatz"})
+
+		results, err := store.Search(ctx, "laun", 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, laundry, results[0].Restaurant)
+			assert.Equal(t, template.HTML("The French <mark>Laundry</mark>"), results[0].Highlights["name"])
+			assert.Equal(t, perSe.ID, results[1].Restaurant.ID)
+			assert.Contains(t, results[1].Highlights["info"], "<mark>Laundry</mark>")
+			assert.Greater(t, results[0].Rank, results[1].Rank)
+		}
+
+		results, err = store.Search(ctx, "keller yountville", 10)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, laundry.ID, results[0].Restaurant.ID)
+		}
+
+		// Edits reach the index
+		laundry.Name = "The Laundry"
+		store.Update(ctx, laundry)
+		results, _ = store.Search(ctx, "french", 10)
+		assert.Len(t, results, 1)
+		store.Delete(ctx, perSe.ID, 0)
+		results, _ = store.Search(ctx, "french", 10)
+		assert.Len(t, results, 0)
+	})
+}
+
+func TestStoreHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+		alinea := Restaurant{ID: 1, Version: 1, Name: "Alinea", Stars: 3, Chefs: []ChefLink{}, Staff: []string{"Nick Kokonas"}, Photos: []string{}, Menus: []string{}}
+
+		first, err := store.AddHistory(ctx, HistoryEntry{
+			RestaurantID: 1,
+			Action:       actionCreate,
+			Actor:        "grant",
+			RequestID:    "abc",
+			Time:         now,
+			Changes:      []FieldChange{{"name", "", "Alinea"}},
+			Restaurant:   alinea,
+		})
+		assert.NoError(t, err)
+		store.AddHistory(ctx, HistoryEntry{RestaurantID: 2, Action: actionCreate, Time: now, Changes: []FieldChange{}})
+		second, err := store.AddHistory(ctx, HistoryEntry{RestaurantID: 1, Action: actionUpdate, Time: now, Changes: []FieldChange{}})
+		assert.NoError(t, err)
+		assert.Greater(t, second.Revision, first.Revision)
+
+		history, err := store.History(ctx, 1)
+		assert.NoError(t, err)
+		if assert.Len(t, history, 2) {
+			assert.Equal(t, second.Revision, history[0].Revision)
+			assert.Equal(t, first.Revision, history[1].Revision)
+			assert.Equal(t, "grant", history[1].Actor)
+			assert.Equal(t, "abc", history[1].RequestID)
+			assert.True(t, now.Equal(history[1].Time))
+			assert.Equal(t, alinea, history[1].Restaurant)
+		}
+
+		history, err = store.History(ctx, 3)
+		assert.NoError(t, err)
+		assert.Empty(t, history)
+	})
+}
+
+func TestStoreRatings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Stars: 3})
+
+		// Stars and the version only change when the current rating does
+		restaurant, err := store.AddRating(ctx, alinea.ID, Rating{2020, "Michelin", 3})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, restaurant.Version)
+		restaurant, err = store.AddRating(ctx, alinea.ID, Rating{2021, "Michelin", 2})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, restaurant.Stars)
+		assert.Equal(t, 2, restaurant.Version)
+
+		// A rating from another guide doesn't outrank the default one
+		restaurant, _ = store.AddRating(ctx, alinea.ID, Rating{2021, "Zagat", 1})
+		assert.Equal(t, 2, restaurant.Stars)
+
+		// Recording the same guide and year again replaces the rating
+		restaurant, err = store.AddRating(ctx, alinea.ID, Rating{2021, "Michelin", 3})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, restaurant.Stars)
+		assert.Equal(t, 3, restaurant.Version)
+
+		ratings, err := store.Ratings(ctx, alinea.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []Rating{{2020, "Michelin", 3}, {2021, "Michelin", 3}, {2021, "Zagat", 1}}, ratings)
+
+		// Updates keep the stars of the current rating
+		restaurant.Stars = 1
+		restaurant, err = store.Update(ctx, restaurant)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, restaurant.Stars)
+		restaurant, _ = store.Get(ctx, alinea.ID)
+		assert.Equal(t, 3, restaurant.Stars)
+
+		ratings, err = store.Ratings(ctx, alinea.ID+1)
+		assert.NoError(t, err)
+		assert.Empty(t, ratings)
+		_, err = store.AddRating(ctx, alinea.ID+1, Rating{2021, "Michelin", 1})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Ratings go when the restaurant is purged
+		store.Delete(ctx, alinea.ID, 0)
+		_, err = store.AddRating(ctx, alinea.ID, Rating{2022, "Michelin", 3})
+		assert.ErrorIs(t, err, ErrNotFound)
+		store.Purge(ctx, time.Now().Add(time.Second))
+		ratings, _ = store.Ratings(ctx, alinea.ID)
+		assert.Empty(t, ratings)
+	})
+}
+
+func TestStoreSchedules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		smyth, err := store.Create(ctx, Restaurant{Name: "Smyth", Schedule: smythSchedule()})
+		assert.NoError(t, err)
+		assert.Equal(t, smythSchedule(), smyth.Schedule)
+		saison, _ := store.Create(ctx, Restaurant{Name: "Saison", Schedule: &Schedule{
+			TimeZone: "America/Los_Angeles",
+			Weekly:   []DayHours{{Day: "tuesday", Services: []Service{{"dinner", "17:30", "21:00"}}}},
+		}})
+		store.Create(ctx, Restaurant{Name: "Alinea"})
+
+		names := func(at time.Time) []string {
+			restaurants, total, err := store.List(ctx, ListOptions{OpenAt: &at})
+			assert.NoError(t, err)
+			assert.Len(t, restaurants, total)
+			names := []string{}
+			for _, restaurant := range restaurants {
+				names = append(names, restaurant.Name)
+			}
+			return names
+		}
+
+		// 19:00 in Chicago is 17:00 in San Francisco, before Saison opens
+		assert.Equal(t, []string{"Smyth"}, names(time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)))
+		assert.Equal(t, []string{"Smyth", "Saison"}, names(time.Date(2024, 6, 5, 1, 0, 0, 0, time.UTC)))
+		assert.Equal(t, []string{"Saison"}, names(time.Date(2024, 6, 5, 3, 30, 0, 0, time.UTC)))
+		assert.Equal(t, []string{}, names(time.Date(2024, 6, 5, 5, 0, 0, 0, time.UTC)))
+
+		saison.Schedule = nil
+		updated, err := store.Update(ctx, saison)
+		assert.NoError(t, err)
+		assert.Nil(t, updated.Schedule)
+	})
+}
+
+func TestStoreChefs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Chef: "Grant Achatz"})
+		next, _ := store.Create(ctx, Restaurant{Name: "Next"})
+
+		grant, err := store.CreateChef(ctx, Chef{Name: "Grant Achatz", Bio: "Molecular gastronomy"})
+		assert.NoError(t, err)
+		assert.Equal(t, Chef{ID: grant.ID, Name: "Grant Achatz", Bio: "Molecular gastronomy", Restaurants: []ChefLink{}}, grant)
+		dave, _ := store.CreateChef(ctx, Chef{Name: "Dave Beran"})
+
+		link, err := store.LinkChef(ctx, ChefLink{ChefID: grant.ID, RestaurantID: alinea.ID, Role: "head chef", Start: "2005-05-04"})
+		assert.NoError(t, err)
+		assert.Equal(t, ChefLink{grant.ID, "Grant Achatz", alinea.ID, "Alinea", "head chef", "2005-05-04", ""}, link)
+		linked, _ := store.Get(ctx, alinea.ID)
+		assert.Equal(t, alinea.Version+1, linked.Version)
+		store.LinkChef(ctx, link)
+		relinked, _ := store.Get(ctx, alinea.ID)
+		assert.Equal(t, linked.Version, relinked.Version)
+		store.LinkChef(ctx, ChefLink{ChefID: grant.ID, RestaurantID: next.ID, Role: "owner", Start: "2011-04-06"})
+		store.LinkChef(ctx, ChefLink{ChefID: dave.ID, RestaurantID: next.ID, Role: "head chef", Start: "2011-04-06", End: "2016-01-01"})
+
+		// Linking the same role again replaces its dates
+		_, err = store.LinkChef(ctx, ChefLink{ChefID: grant.ID, RestaurantID: next.ID, Role: "owner", Start: "2010-01-01"})
+		assert.NoError(t, err)
+
+		grant, err = store.GetChef(ctx, grant.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, grant.Restaurants, 2) {
+			assert.Equal(t, "Alinea", grant.Restaurants[0].RestaurantName)
+			assert.Equal(t, "2010-01-01", grant.Restaurants[1].Start)
+		}
+
+		// Restaurants list their chefs, and renaming either end shows up
+		grant.Name = "Chef Grant Achatz"
+		_, err = store.UpdateChef(ctx, grant)
+		assert.NoError(t, err)
+		// Linking chefs changed the restaurant's version
+		next, _ = store.Get(ctx, next.ID)
+		next.Name = "Next Restaurant"
+		store.Update(ctx, next)
+		restaurant, _ := store.Get(ctx, next.ID)
+		if assert.Len(t, restaurant.Chefs, 2) {
+			assert.Equal(t, "Chef Grant Achatz", restaurant.Chefs[0].ChefName)
+			assert.Equal(t, "Dave Beran", restaurant.Chefs[1].ChefName)
+			assert.Equal(t, "Next Restaurant", restaurant.Chefs[1].RestaurantName)
+		}
+
+		chefs, err := store.Chefs(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, chefs, 2) {
+			assert.Equal(t, "Chef Grant Achatz", chefs[0].Name)
+			assert.Len(t, chefs[1].Restaurants, 1)
+		}
+
+		_, err = store.LinkChef(ctx, ChefLink{ChefID: 99, RestaurantID: alinea.ID, Role: "head chef"})
+		assert.ErrorIs(t, err, ErrChefNotFound)
+		_, err = store.LinkChef(ctx, ChefLink{ChefID: dave.ID, RestaurantID: 99, Role: "head chef"})
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.UpdateChef(ctx, Chef{ID: 99, Name: "Nobody"})
+		assert.ErrorIs(t, err, ErrChefNotFound)
+
+		assert.NoError(t, store.UnlinkChef(ctx, dave.ID, next.ID, "head chef"))
+		unlinked, _ := store.Get(ctx, next.ID)
+		assert.Equal(t, restaurant.Version+1, unlinked.Version)
+		assert.ErrorIs(t, store.UnlinkChef(ctx, dave.ID, next.ID, "head chef"), ErrChefLinkNotFound)
+
+		// Restaurants in the trash drop off the chef's page, and purged ones
+		// lose their links
+		store.Delete(ctx, alinea.ID, 0)
+		grant, _ = store.GetChef(ctx, grant.ID)
+		assert.Len(t, grant.Restaurants, 1)
+		store.Purge(ctx, time.Now().Add(time.Second))
+		store.Restore(ctx, alinea.ID)
+		grant, _ = store.GetChef(ctx, grant.ID)
+		assert.Len(t, grant.Restaurants, 1)
+
+		// Deleting a chef takes their links with them
+		assert.NoError(t, store.DeleteChef(ctx, grant.ID))
+		assert.ErrorIs(t, store.DeleteChef(ctx, grant.ID), ErrChefNotFound)
+		_, err = store.GetChef(ctx, grant.ID)
+		assert.ErrorIs(t, err, ErrChefNotFound)
+		restaurant, _ = store.Get(ctx, next.ID)
+		assert.Empty(t, restaurant.Chefs)
+	})
+}
+
+func TestStoreStaff(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Staff: []string{"Nick Kokonas"}})
+		next, _ := store.Create(ctx, Restaurant{Name: "Next"})
+
+		joe, err := store.AddStaff(ctx, StaffMember{RestaurantID: alinea.ID, Name: "Joe Catterson", Role: "Wine Director", Start: "2005-05-04"})
+		assert.NoError(t, err)
+		assert.NotZero(t, joe.ID)
+		restaurant, _ := store.Get(ctx, alinea.ID)
+		assert.Equal(t, []string{"Nick Kokonas", "Joe Catterson"}, restaurant.Staff)
+		assert.Equal(t, 2, restaurant.Version)
+
+		// Moving ends one stint and starts the next at the other restaurant
+		moved, err := store.MoveStaff(ctx, joe.ID, StaffMove{RestaurantID: next.ID, Date: "2011-04-06"})
+		assert.NoError(t, err)
+		assert.Equal(t, StaffMember{moved.ID, next.ID, "Joe Catterson", "Wine Director", "2011-04-06", ""}, moved)
+		restaurant, _ = store.Get(ctx, alinea.ID)
+		assert.Equal(t, []string{"Nick Kokonas"}, restaurant.Staff)
+		restaurant, _ = store.Get(ctx, next.ID)
+		assert.Equal(t, []string{"Joe Catterson"}, restaurant.Staff)
+
+		_, err = store.MoveStaff(ctx, joe.ID, StaffMove{Role: "Sommelier", Date: "2012-01-01"})
+		assert.ErrorIs(t, err, ErrStaffNotFound)
+		_, err = store.MoveStaff(ctx, moved.ID, StaffMove{RestaurantID: 99, Date: "2012-01-01"})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		retired, err := store.RetireStaff(ctx, moved.ID, "2016-01-01")
+		assert.NoError(t, err)
+		assert.Equal(t, "2016-01-01", retired.End)
+		_, err = store.RetireStaff(ctx, moved.ID, "2016-01-01")
+		assert.ErrorIs(t, err, ErrStaffNotFound)
+
+		roster, err := store.Roster(ctx, alinea.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, roster, 2) {
+			assert.Equal(t, "Nick Kokonas", roster[0].Name)
+			assert.Equal(t, StaffMember{joe.ID, alinea.ID, "Joe Catterson", "Wine Director", "2005-05-04", "2011-04-06"}, roster[1])
+		}
+
+		// Writing Staff retires whoever it leaves out and adds new names
+		restaurant, _ = store.Get(ctx, alinea.ID)
+		restaurant.Staff = []string{"Simon Davies"}
+		restaurant, err = store.Update(ctx, restaurant)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Simon Davies"}, restaurant.Staff)
+		roster, _ = store.Roster(ctx, alinea.ID)
+		if assert.Len(t, roster, 3) {
+			assert.Equal(t, time.Now().Format(time.DateOnly), roster[0].End)
+			assert.Equal(t, "Simon Davies", roster[1].Name)
+			assert.True(t, roster[1].Current())
+		}
+
+		_, err = store.AddStaff(ctx, StaffMember{RestaurantID: 99, Name: "Nobody"})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Staff go when the restaurant is purged
+		store.Delete(ctx, next.ID, 0)
+		store.Purge(ctx, time.Now().Add(time.Second))
+		roster, _ = store.Roster(ctx, next.ID)
+		assert.Empty(t, roster)
+	})
+}
+
+func TestStoreMenus(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea, _ := store.Create(ctx, Restaurant{Name: "Alinea", Menus: []string{"Tasting"}})
+		next, _ := store.Create(ctx, Restaurant{Name: "Next"})
+
+		menus, err := store.Menus(ctx, alinea.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, menus, 1) {
+			assert.Equal(t, Menu{ID: menus[0].ID, RestaurantID: alinea.ID, Name: "Tasting", Courses: []Course{}}, menus[0])
+		}
+
+		// A new version of a menu archives the current one on the day it starts
+		fall := Menu{
+			RestaurantID: alinea.ID,
+			Name:         "tasting",
+			Kind:         "tasting",
+			Currency:     "USD",
+			Price:        "295",
+			Start:        "2024-09-01",
+			Courses: []Course{{Name: "First", Dishes: []Dish{
+				{Name: "Black Truffle Explosion", Diets: []string{}, Allergens: []string{"wheat", "milk"}},
+			}}},
+		}
+		fall, err = store.AddMenu(ctx, fall)
+		assert.NoError(t, err)
+		assert.NotZero(t, fall.ID)
+		menus, _ = store.Menus(ctx, alinea.ID)
+		if assert.Len(t, menus, 2) {
+			assert.Equal(t, "2024-09-01", menus[0].End)
+			assert.Equal(t, fall, menus[1])
+		}
+		restaurant, _ := store.Get(ctx, alinea.ID)
+		assert.Equal(t, []string{"tasting"}, restaurant.Menus)
+		assert.Equal(t, 2, restaurant.Version)
+
+		// Only current menus are searched for dishes
+		list, total, _ := store.List(ctx, ListOptions{Dish: "truffle"})
+		if assert.Equal(t, 1, total) {
+			assert.Equal(t, "Alinea", list[0].Name)
+		}
+		_, total, _ = store.List(ctx, ListOptions{Dish: "truffle", Diets: []string{"vegan"}})
+		assert.Zero(t, total)
+
+		fall.Season = "Fall 2024"
+		fall.Courses = []Course{}
+		updated, err := store.UpdateMenu(ctx, fall)
+		assert.NoError(t, err)
+		assert.Equal(t, fall, updated)
+		fall.RestaurantID = next.ID
+		_, err = store.UpdateMenu(ctx, fall)
+		assert.ErrorIs(t, err, ErrMenuNotFound)
+
+		archived, err := store.ArchiveMenu(ctx, fall.ID, "2024-12-01")
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-12-01", archived.End)
+		_, err = store.ArchiveMenu(ctx, fall.ID, "2024-12-02")
+		assert.ErrorIs(t, err, ErrMenuNotFound)
+		restaurant, _ = store.Get(ctx, alinea.ID)
+		assert.Empty(t, restaurant.Menus)
+
+		assert.NoError(t, store.DeleteMenu(ctx, fall.ID))
+		assert.ErrorIs(t, store.DeleteMenu(ctx, fall.ID), ErrMenuNotFound)
+		_, err = store.AddMenu(ctx, Menu{RestaurantID: 99, Name: "Nothing"})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Writing Menus archives whatever it leaves out and adds new names
+		store.AddMenu(ctx, Menu{RestaurantID: next.ID, Name: "Paris 1906"})
+		restaurant, _ = store.Get(ctx, next.ID)
+		restaurant.Menus = []string{"Kyoto"}
+		restaurant, err = store.Update(ctx, restaurant)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Kyoto"}, restaurant.Menus)
+		menus, _ = store.Menus(ctx, next.ID)
+		if assert.Len(t, menus, 2) {
+			assert.Equal(t, time.Now().Format(time.DateOnly), menus[0].End)
+			assert.True(t, menus[1].Current())
+		}
+
+		// Menus go when the restaurant is purged
+		store.Delete(ctx, next.ID, 0)
+		store.Purge(ctx, time.Now().Add(time.Second))
+		menus, _ = store.Menus(ctx, next.ID)
+		assert.Empty(t, menus)
+	})
+}
+
+func TestStoreNearby(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RestaurantStore) {
+		ctx := context.Background()
+		alinea := Restaurant{Name: "Alinea"}
+		alinea.Latitude, alinea.Longitude = coordinates(41.9134, -87.6482)
+		smyth := Restaurant{Name: "Smyth"}
+		smyth.Latitude, smyth.Longitude = coordinates(41.8842, -87.6522)
+		alinea, _ = store.Create(ctx, alinea)
+		smyth, _ = store.Create(ctx, smyth)
+		store.Create(ctx, Restaurant{Name: "Somewhere"})
+		fiji := Restaurant{Name: "Island"}
+		fiji.Latitude, fiji.Longitude = coordinates(-17.7, -179.9)
+		store.Create(ctx, fiji)
+
+		names := func(opts NearbyOptions) []string {
+			results, err := store.Nearby(ctx, opts)
+			assert.NoError(t, err)
+			var names []string
+			for _, result := range results {
+				names = append(names, result.Restaurant.Name)
+			}
+			return names
+		}
+		assert.Equal(t, []string{"Smyth", "Alinea"}, names(NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000}))
+		assert.Equal(t, []string{"Alinea", "Smyth"}, names(NearbyOptions{Latitude: 41.9134, Longitude: -87.6482, Radius: 5_000}))
+		assert.Equal(t, []string{"Smyth"}, names(NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 1_000}))
+		assert.Equal(t, []string{"Smyth"}, names(NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000, Limit: 1}))
+
+		// The search reaches across the antimeridian
+		assert.Equal(t, []string{"Island"}, names(NearbyOptions{Latitude: -17.7, Longitude: 179.95, Radius: 50_000}))
+
+		// Moving a restaurant moves it in the index, and so does forgetting
+		// where it is or deleting it
+		alinea.Latitude, alinea.Longitude = coordinates(40.7424, -73.9878)
+		alinea, err := store.Update(ctx, alinea)
+		assert.NoError(t, err)
+		assert.Equal(t, 40.7424, *alinea.Latitude)
+		assert.Equal(t, []string{"Smyth"}, names(NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000}))
+		assert.Equal(t, []string{"Alinea"}, names(NearbyOptions{Latitude: 40.7424, Longitude: -73.9878, Radius: 100}))
+		smyth.Latitude, smyth.Longitude = nil, nil
+		store.Update(ctx, smyth)
+		assert.Empty(t, names(NearbyOptions{Latitude: 41.8841, Longitude: -87.6520, Radius: 5_000}))
+		store.Delete(ctx, alinea.ID, 0)
+		assert.Empty(t, names(NearbyOptions{Latitude: 40.7424, Longitude: -73.9878, Radius: 100}))
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// defaultTrashRetention is how long a deleted restaurant stays in the
+	// trash, where it can still be restored, when TRASH_RETENTION isn't set
+	defaultTrashRetention = 30 * 24 * time.Hour
+
+	// purgeInterval is how often the purger empties expired restaurants out
+	// of the trash
+	purgeInterval = time.Hour
+)
+
+// trashRetention reads the retention period from the TRASH_RETENTION env
+// var, which takes a Go duration such as 168h
+func trashRetention() (time.Duration, error) {
+	value, ok := os.LookupEnv("TRASH_RETENTION")
+	if !ok || value == "" {
+		return defaultTrashRetention, nil
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if retention <= 0 {
+		return 0, fmt.Errorf("retention must be positive, got %s", retention)
+	}
+	return retention, nil
+}
+
+// purgeTrash removes the restaurants that have been in the trash for longer
+// than the retention period, and their photo files when there is photo
+// storage. The restaurants are gone by the time the files are deleted, so a
+// file that can't be deleted is only logged.
+func purgeTrash(ctx context.Context, store RestaurantStore, photos PhotoStorage, retention time.Duration, now time.Time) (int, error) {
+	purged, err := store.Purge(ctx, now.Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	if photos != nil {
+		for _, id := range purged {
+			if err := photos.DeleteAll(ctx, restaurantPhotoDir(id)); err != nil {
+				log.Println("Error deleting photos:", err)
+			}
+		}
+	}
+	return len(purged), nil
+}
+
+// runPurger purges the trash once at startup and then every interval until
+// the context is cancelled. Failures are logged and retried on the next run.
+func runPurger(ctx context.Context, store RestaurantStore, photos PhotoStorage, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := purgeTrash(ctx, store, photos, retention, time.Now())
+		if err != nil {
+			log.Println("Error purging trash:", err)
+		} else if purged > 0 {
+			log.Println("Purged restaurants from the trash:", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
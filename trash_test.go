@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashRetention(t *testing.T) {
+	t.Setenv("TRASH_RETENTION", "")
+	retention, err := trashRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultTrashRetention, retention)
+
+	t.Setenv("TRASH_RETENTION", "168h")
+	retention, err = trashRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, retention)
+
+	for _, value := range []string{"a week", "-1h", "0s"} {
+		t.Setenv("TRASH_RETENTION", value)
+		_, err = trashRetention()
+		assert.Error(t, err, value)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	store, restaurant := seedStore(t)
+	next, _ := store.Create(ctx, Restaurant{Name: "Next"})
+	photos := newLocalPhotoStorage(t.TempDir())
+	photos.Put(ctx, restaurantPhotoDir(restaurant.ID)+"/a.jpg", "image/jpeg", []byte("photo"))
+	photos.Put(ctx, restaurantPhotoDir(next.ID)+"/b.jpg", "image/jpeg", []byte("photo"))
+	store.Delete(ctx, restaurant.ID, 0)
+
+	purged, err := purgeTrash(ctx, store, photos, time.Hour, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = purgeTrash(ctx, store, photos, time.Hour, time.Now().Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = store.Restore(ctx, restaurant.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// The purged restaurant's photo files go with it
+	_, _, err = photos.Get(ctx, restaurantPhotoDir(restaurant.ID)+"/a.jpg")
+	assert.ErrorIs(t, err, ErrPhotoNotFound)
+	_, _, err = photos.Get(ctx, restaurantPhotoDir(next.ID)+"/b.jpg")
+	assert.NoError(t, err)
+
+	// Without photo storage there are only rows to purge
+	_, err = purgeTrash(ctx, store, nil, time.Hour, time.Now())
+	assert.NoError(t, err)
+}
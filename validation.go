@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes why one field of a restaurant is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+// usStates are the postal codes of the states, DC and the territories
+var usStates = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields(`
+		AL AK AZ AR CA CO CT DE FL GA HI ID IL IN IA KS KY LA ME MD
+		MA MI MN MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC
+		SD TN TX UT VT VA WA WV WI WY DC AS GU MP PR VI`) {
+		usStates[code] = true
+	}
+
+	// The rules live in the binding tags of Restaurant and run on Gin's
+	// validator. Errors name fields by their JSON names, and usstate checks
+	// for a US postal code. The menu rules check prices and dish tags.
+	engine := binding.Validator.Engine().(*validator.Validate)
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	engine.RegisterValidation("usstate", func(fl validator.FieldLevel) bool {
+		return usStates[fl.Field().String()]
+	})
+	engine.RegisterValidation("clock", func(fl validator.FieldLevel) bool {
+		return clockPattern.MatchString(fl.Field().String())
+	})
+	engine.RegisterValidation("price", func(fl validator.FieldLevel) bool {
+		return pricePattern.MatchString(fl.Field().String())
+	})
+	engine.RegisterValidation("diet", func(fl validator.FieldLevel) bool {
+		return slices.Contains(menuDiets, fl.Field().String())
+	})
+	engine.RegisterValidation("allergen", func(fl validator.FieldLevel) bool {
+		return slices.Contains(menuAllergens, fl.Field().String())
+	})
+}
+
+// normalizeRestaurant tidies up user input before it is validated: it trims
+// the text fields, writes the address the standard way and takes the state
+// from it when none was given, upper-cases the state code, tidies the
+// schedule, dropping it when it is empty, and turns missing collections into
+// empty ones
+func normalizeRestaurant(restaurant *Restaurant) {
+	for _, field := range []*string{
+		&restaurant.Name,
+		&restaurant.Address,
+		&restaurant.State,
+		&restaurant.Hours,
+		&restaurant.Chef,
+		&restaurant.Website,
+		&restaurant.Info,
+	} {
+		*field = strings.TrimSpace(*field)
+	}
+	parts := parseAddress(restaurant.Address)
+	restaurant.Address = parts.String()
+	if restaurant.State == "" {
+		restaurant.State = parts.State
+	}
+	restaurant.State = strings.ToUpper(restaurant.State)
+	restaurant.AddressParts = addressParts(restaurant.Address, restaurant.State)
+	if restaurant.Schedule.isZero() {
+		restaurant.Schedule = nil
+	} else {
+		restaurant.Schedule.normalize()
+	}
+	if restaurant.Staff == nil {
+		restaurant.Staff = []string{}
+	}
+	if restaurant.Menus == nil {
+		restaurant.Menus = []string{}
+	}
+	for _, collection := range restaurantCollections {
+		if field := collection.field(restaurant); *field == nil {
+			*field = []string{}
+		}
+	}
+}
+
+// validateRestaurant checks a restaurant against the binding rules on its
+// fields and returns one error per invalid field. Opening hours also need a
+// time zone to say when they are, and coordinates come in pairs.
+func validateRestaurant(restaurant Restaurant) []FieldError {
+	errs := fieldErrors("restaurant", binding.Validator.ValidateStruct(restaurant))
+	if restaurant.Schedule.hasHours() && restaurant.Schedule.TimeZone == "" {
+		errs = append(errs, FieldError{"schedule.time_zone", "is required with opening hours"})
+	}
+	if state := parseAddress(restaurant.Address).State; state != "" && state != restaurant.State {
+		errs = append(errs, FieldError{"state", "must match the address, which is in " + state})
+	}
+	switch {
+	case restaurant.Latitude != nil && restaurant.Longitude == nil:
+		errs = append(errs, FieldError{"longitude", "is required with latitude"})
+	case restaurant.Latitude == nil && restaurant.Longitude != nil:
+		errs = append(errs, FieldError{"latitude", "is required with longitude"})
+	}
+	return errs
+}
+
+// fieldErrors turns the error from Gin's validator into one error per
+// invalid field, naming nested fields by their path such as
+// schedule.weekly[0].day. Anything other than a validation error is put down
+// to the whole of what was being validated, under the name given.
+func fieldErrors(name string, err error) []FieldError {
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return []FieldError{{name, err.Error()}}
+	}
+	errs := make([]FieldError, len(invalid))
+	for i, fieldErr := range invalid {
+		_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+		errs[i] = FieldError{path, validationMessage(fieldErr)}
+	}
+	return errs
+}
+
+// validationMessage explains a failed binding rule
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fieldErr.Param()
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return "must be at most " + fieldErr.Param() + " characters"
+		}
+		return "must be at most " + fieldErr.Param()
+	case "usstate":
+		return "must be a two letter US state code"
+	case "http_url":
+		return "must be an http or https URL"
+	case "oneof":
+		return "must be one of " + fieldErr.Param()
+	case "clock":
+		return "must be a 24 hour time such as 17:30"
+	case "timezone":
+		return "must be an IANA time zone such as America/Chicago"
+	case "datetime":
+		return "must be a date such as 2024-12-25"
+	case "iso4217":
+		return "must be a currency code such as USD"
+	case "price":
+		return "must be an amount such as 28.50"
+	case "diet":
+		return "must be one of " + strings.Join(menuDiets, " ")
+	case "allergen":
+		return "must be one of " + strings.Join(menuAllergens, " ")
+	case "latitude":
+		return "must be a latitude from -90 to 90"
+	case "longitude":
+		return "must be a longitude from -180 to 180"
+	}
+	return "is invalid"
+}
+
+// respondInvalid sends the 422 response for a restaurant that failed
+// validation
+func respondInvalid(c *gin.Context, errs []FieldError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":  "Validation failed",
+		"fields": errs,
+	})
+}
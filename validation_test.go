@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRestaurant(t *testing.T) {
+	valid := Restaurant{
+		Name:    "Alinea",
+		Stars:   3,
+		Address: "1723 N Halsted St",
+		State:   "IL",
+		Website: "https://www.alinearestaurant.com",
+	}
+	assert.Empty(t, validateRestaurant(valid))
+
+	// State and website are optional
+	assert.Empty(t, validateRestaurant(Restaurant{Name: "Smyth", Address: "177 N Ada St"}))
+
+	invalid := valid
+	invalid.Name = ""
+	invalid.Stars = -1
+	invalid.State = "Illinois"
+	invalid.Website = "ftp://alinea"
+	assert.Equal(t, []FieldError{
+		{"name", "is required"},
+		{"stars", "must be at least 0"},
+		{"state", "must be a two letter US state code"},
+		{"website", "must be an http or https URL"},
+	}, validateRestaurant(invalid))
+
+	// Coordinates have to be on the globe, and come together
+	located := valid
+	located.Latitude, located.Longitude = coordinates(41.9134, -87.6482)
+	assert.Empty(t, validateRestaurant(located))
+	located.Latitude, located.Longitude = coordinates(91, -187.6482)
+	assert.Equal(t, []FieldError{
+		{"latitude", "must be a latitude from -90 to 90"},
+		{"longitude", "must be a longitude from -180 to 180"},
+	}, validateRestaurant(located))
+	located.Longitude = nil
+	assert.Contains(t, validateRestaurant(located), FieldError{"longitude", "is required with latitude"})
+}
+
+func TestValidateSchedule(t *testing.T) {
+	restaurant := Restaurant{Name: "Smyth", Address: "177 N Ada St", Schedule: smythSchedule()}
+	assert.Empty(t, validateRestaurant(restaurant))
+
+	restaurant.Schedule = &Schedule{
+		Weekly:     []DayHours{{Day: "someday", Services: []Service{{"dinner", "17:00", "25:00"}}}},
+		Exceptions: []DateHours{{Date: "Christmas"}},
+	}
+	assert.Equal(t, []FieldError{
+		{"schedule.weekly[0].day", "must be one of monday tuesday wednesday thursday friday saturday sunday"},
+		{"schedule.weekly[0].services[0].closes", "must be a 24 hour time such as 17:30"},
+		{"schedule.exceptions[0].date", "must be a date such as 2024-12-25"},
+		{"schedule.time_zone", "is required with opening hours"},
+	}, validateRestaurant(restaurant))
+
+	restaurant.Schedule = &Schedule{TimeZone: "America/Springfield"}
+	assert.Equal(t, []FieldError{
+		{"schedule.time_zone", "must be an IANA time zone such as America/Chicago"},
+	}, validateRestaurant(restaurant))
+}
+
+func TestNormalizeRestaurant(t *testing.T) {
+	restaurant := Restaurant{Name: " Alinea ", State: " il", Website: "https://alinea.com\n", Schedule: &Schedule{}}
+	normalizeRestaurant(&restaurant)
+	assert.Equal(t, Restaurant{
+		Name:    "Alinea",
+		State:   "IL",
+		Website: "https://alinea.com",
+		Staff:   []string{},
+		Photos:  []string{},
+		Menus:   []string{},
+
+		AddressParts: AddressParts{State: "IL", Country: "US"},
+	}, restaurant)
+
+	// The state comes from the address when none is given
+	restaurant = Restaurant{Name: "Le Bernardin", Address: "155 West 51st Street,  new york, New York 10019, USA"}
+	normalizeRestaurant(&restaurant)
+	assert.Equal(t, "155 W 51st St, new york, NY 10019", restaurant.Address)
+	assert.Equal(t, "NY", restaurant.State)
+	assert.Equal(t, AddressParts{"155 W 51st St", "new york", "NY", "10019", "US"}, restaurant.AddressParts)
+
+	// A state that is given is kept, and has to agree with the address
+	restaurant = Restaurant{Name: "Le Bernardin", Address: "155 W 51st St, New York, NY 10019", State: "il"}
+	normalizeRestaurant(&restaurant)
+	assert.Equal(t, "IL", restaurant.State)
+	assert.Equal(t, []FieldError{{"state", "must match the address, which is in NY"}}, validateRestaurant(restaurant))
+}
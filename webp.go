@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// The standard library decodes JPEG, PNG and GIF but writes no WebP, so the
+// WebP variants of photos are encoded here. They use the lossless format
+// (VP8L), which is far simpler than the lossy one: the pixels go through the
+// subtract green and predictor transforms and are then written as literals
+// with one set of prefix codes for the whole image.
+
+const (
+	vp8lSignature = 0x2f
+
+	// vp8lPredictorBits is the log2 of the side of the square tiles that
+	// share a predictor
+	vp8lPredictorBits = 4
+
+	// Alphabet sizes of the five prefix codes of an image: green with the
+	// 24 backward reference length codes, red, blue, alpha and distance
+	vp8lGreenAlphabet    = 256 + 24
+	vp8lColorAlphabet    = 256
+	vp8lDistanceAlphabet = 40
+)
+
+// errWebPSize is returned for an image too large or small to encode
+var errWebPSize = errors.New("webp: image must be 1 to 16384 pixels on a side")
+
+// vp8lCodeLengthOrder is the order the lengths of the code length code are
+// written in
+var vp8lCodeLengthOrder = []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lPredictors are the predictor modes a tile can pick from. Modes that
+// need the pixel above and to the right are left out, as they are rarely
+// better for photos and have edge cases of their own.
+var vp8lPredictors = []struct {
+	mode    uint32
+	predict func(left, top, topLeft uint32) uint32
+}{
+	{1, func(left, top, topLeft uint32) uint32 { return left }},
+	{2, func(left, top, topLeft uint32) uint32 { return top }},
+	{7, func(left, top, topLeft uint32) uint32 { return average2(left, top) }},
+	{12, clampAddSubtractFull},
+}
+
+// encodeWebP writes img as a lossless WebP image. Images larger than 16384
+// pixels on a side can't be stored in the format.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errWebPSize
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	pixels := make([]uint32, width*height)
+	opaque := true
+	for i := range pixels {
+		p := nrgba.Pix[i*4 : i*4+4]
+		pixels[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		opaque = opaque && p[3] == 0xff
+	}
+
+	var bits bitWriter
+	bits.write(vp8lSignature, 8)
+	bits.write(uint32(width-1), 14)
+	bits.write(uint32(height-1), 14)
+	if opaque {
+		bits.write(0, 1)
+	} else {
+		bits.write(1, 1)
+	}
+	bits.write(0, 3)
+
+	// Subtract green: red and blue become differences from green, which
+	// takes out most of what the channels have in common
+	bits.write(1, 1)
+	bits.write(2, 2)
+	for i, argb := range pixels {
+		green := argb >> 8 & 0xff
+		red := (argb>>16 - green) & 0xff
+		blue := (argb - green) & 0xff
+		pixels[i] = argb&0xff00ff00 | red<<16 | blue
+	}
+
+	// Predictor: each pixel becomes its difference from a prediction made
+	// from its neighbours, with the best mode picked tile by tile
+	bits.write(1, 1)
+	bits.write(0, 2)
+	bits.write(vp8lPredictorBits-2, 3)
+	modes, residuals := predictPixels(pixels, width, height)
+	bits.writeImage(modes, false)
+	bits.write(0, 1)
+
+	bits.writeImage(residuals, true)
+	bits.flush()
+
+	data := bits.buf.Bytes()
+	padded := len(data) + len(data)%2
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// predictPixels picks a predictor mode for every tile and returns the
+// predictor image, with each tile's mode in its green channel, and the
+// residuals of the pixels. The first row is predicted from the left, the
+// first column from above, and the first pixel from opaque black, whatever
+// their tile's mode.
+func predictPixels(pixels []uint32, width, height int) (modes, residuals []uint32) {
+	tiles := 1 << vp8lPredictorBits
+	tilesWide := (width + tiles - 1) / tiles
+	tilesHigh := (height + tiles - 1) / tiles
+	modes = make([]uint32, tilesWide*tilesHigh)
+	residuals = make([]uint32, len(pixels))
+
+	predict := func(p, x, y int) uint32 {
+		i := y*width + x
+		switch {
+		case x == 0 && y == 0:
+			return 0xff000000
+		case y == 0:
+			return pixels[i-1]
+		case x == 0:
+			return pixels[i-width]
+		}
+		return vp8lPredictors[p].predict(pixels[i-1], pixels[i-width], pixels[i-width-1])
+	}
+
+	for ty := 0; ty < tilesHigh; ty++ {
+		for tx := 0; tx < tilesWide; tx++ {
+			best, bestCost := 0, -1
+			for p := range vp8lPredictors {
+				cost := 0
+				for y := ty * tiles; y < min((ty+1)*tiles, height); y++ {
+					for x := tx * tiles; x < min((tx+1)*tiles, width); x++ {
+						cost += residualCost(subPixels(pixels[y*width+x], predict(p, x, y)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = p, cost
+				}
+			}
+			modes[ty*tilesWide+tx] = 0xff000000 | vp8lPredictors[best].mode<<8
+			for y := ty * tiles; y < min((ty+1)*tiles, height); y++ {
+				for x := tx * tiles; x < min((tx+1)*tiles, width); x++ {
+					residuals[y*width+x] = subPixels(pixels[y*width+x], predict(best, x, y))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	var result uint32
+	for shift := 0; shift < 32; shift += 8 {
+		result |= (a>>shift - b>>shift) & 0xff << shift
+	}
+	return result
+}
+
+// residualCost estimates how many bits a residual takes by how far each
+// channel is from zero
+func residualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		c := int(int8(residual >> shift))
+		cost += max(c, -c)
+	}
+	return cost
+}
+
+// average2 averages two pixels channel by channel
+func average2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+// clampAddSubtractFull predicts left + top - topLeft, clamped to 0-255,
+// channel by channel
+func clampAddSubtractFull(left, top, topLeft uint32) uint32 {
+	var result uint32
+	for shift := 0; shift < 32; shift += 8 {
+		c := int(left>>shift&0xff) + int(top>>shift&0xff) - int(topLeft>>shift&0xff)
+		result |= uint32(min(max(c, 0), 255)) << shift
+	}
+	return result
+}
+
+// bitWriter packs values into bytes least significant bit first, the order
+// the VP8L bitstream uses
+type bitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.acc |= uint64(value) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+// flush writes out the last partial byte
+func (w *bitWriter) flush() {
+	if w.nbits > 0 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+}
+
+// writeImage writes an entropy coded image without a color cache or
+// backward references. Only the main image says whether it has meta prefix
+// codes; it never does here.
+func (w *bitWriter) writeImage(pixels []uint32, main bool) {
+	w.write(0, 1)
+	if main {
+		w.write(0, 1)
+	}
+
+	histograms := [][]int{
+		make([]int, vp8lGreenAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lColorAlphabet),
+		make([]int, vp8lDistanceAlphabet),
+	}
+	for _, argb := range pixels {
+		histograms[0][argb>>8&0xff]++
+		histograms[1][argb>>16&0xff]++
+		histograms[2][argb&0xff]++
+		histograms[3][argb>>24]++
+	}
+	codes := make([]prefixCode, len(histograms))
+	for i, histogram := range histograms {
+		codes[i] = w.writePrefixCode(histogram)
+	}
+
+	for _, argb := range pixels {
+		codes[0].write(w, argb>>8&0xff)
+		codes[1].write(w, argb>>16&0xff)
+		codes[2].write(w, argb&0xff)
+		codes[3].write(w, argb>>24)
+	}
+}
+
+// prefixCode is a canonical prefix code, with the code and its length for
+// every symbol
+type prefixCode struct {
+	codes   []uint32
+	lengths []int
+}
+
+// write writes the code of a symbol, most significant bit first
+func (c prefixCode) write(w *bitWriter, symbol uint32) {
+	length := c.lengths[symbol]
+	if length == 0 {
+		return
+	}
+	code, reversed := c.codes[symbol], uint32(0)
+	for i := 0; i < length; i++ {
+		reversed = reversed<<1 | code>>i&1
+	}
+	w.write(reversed, uint(length))
+}
+
+// writePrefixCode writes the prefix code for a histogram and returns it. A
+// code for no symbols or for a single one is written as a simple code, whose
+// symbol then takes no bits at all.
+func (w *bitWriter) writePrefixCode(histogram []int) prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) <= 1 {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		w.write(1, 1)
+		w.write(0, 1)
+		if symbol < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbol), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbol), 8)
+		}
+		return prefixCode{codes: make([]uint32, len(histogram)), lengths: make([]int, len(histogram))}
+	}
+
+	lengths := huffmanLengths(histogram, 15)
+	w.write(0, 1)
+
+	// The code lengths are written with a code of their own, which needs at
+	// least two symbols for its lengths to add up to a complete code
+	lengthHistogram := make([]int, len(vp8lCodeLengthOrder))
+	for _, length := range lengths {
+		lengthHistogram[length]++
+	}
+	if nonZero(lengthHistogram) < 2 {
+		if lengthHistogram[0] == 0 {
+			lengthHistogram[0] = 1
+		} else {
+			lengthHistogram[1] = 1
+		}
+	}
+	lengthCode := canonicalCode(huffmanLengths(lengthHistogram, 7))
+	count := 4
+	for i, symbol := range vp8lCodeLengthOrder {
+		if lengthCode.lengths[symbol] > 0 {
+			count = max(count, i+1)
+		}
+	}
+	w.write(uint32(count-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:count] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+
+	// Every symbol of the alphabet gets a length, so there is no max_symbol
+	w.write(0, 1)
+	for _, length := range lengths {
+		lengthCode.write(w, uint32(length))
+	}
+	return canonicalCode(lengths)
+}
+
+// nonZero counts the non-zero entries of a histogram
+func nonZero(histogram []int) int {
+	n := 0
+	for _, count := range histogram {
+		if count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// canonicalCode assigns codes to code lengths the way DEFLATE does: shorter
+// codes first, and symbols in order within a length
+func canonicalCode(lengths []int) prefixCode {
+	maxLength := 0
+	for _, length := range lengths {
+		maxLength = max(maxLength, length)
+	}
+	counts := make([]uint32, maxLength+1)
+	for _, length := range lengths {
+		if length > 0 {
+			counts[length]++
+		}
+	}
+	next := make([]uint32, maxLength+2)
+	for length := 1; length <= maxLength; length++ {
+		next[length+1] = (next[length] + counts[length]) << 1
+	}
+	codes := make([]uint32, len(lengths))
+	for symbol, length := range lengths {
+		if length > 0 {
+			codes[symbol] = next[length]
+			next[length]++
+		}
+	}
+	return prefixCode{codes: codes, lengths: lengths}
+}
+
+// huffmanLengths returns the Huffman code lengths of a histogram with at
+// least two non-zero counts, limited to maxLength bits. When the tree comes
+// out too deep the counts are flattened and it is built again, which ends
+// with a balanced tree at worst.
+func huffmanLengths(histogram []int, maxLength int) []int {
+	counts := append([]int{}, histogram...)
+	for {
+		lengths := huffmanTree(counts)
+		deepest := 0
+		for _, length := range lengths {
+			deepest = max(deepest, length)
+		}
+		if deepest <= maxLength {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = count/2 + 1
+			}
+		}
+	}
+}
+
+// huffmanTree builds a Huffman tree over the non-zero counts and returns the
+// depth of every symbol in it
+func huffmanTree(counts []int) []int {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right int
+	}
+	var nodes []node
+	for symbol, count := range counts {
+		if count > 0 {
+			nodes = append(nodes, node{weight: count, symbol: symbol, left: -1, right: -1})
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+	// Leaves are taken in weight order from the front of nodes, and the
+	// merged nodes appended after them come out in weight order too
+	leaves, merged := 0, len(nodes)
+	leafCount := len(nodes)
+	lightest := func() int {
+		if leaves < leafCount && (merged >= len(nodes) || nodes[leaves].weight <= nodes[merged].weight) {
+			leaves++
+			return leaves - 1
+		}
+		merged++
+		return merged - 1
+	}
+	for remaining := leafCount; remaining > 1; remaining-- {
+		a, b := lightest(), lightest()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+	}
+
+	lengths := make([]int, len(counts))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].symbol >= 0 {
+			lengths[nodes[i].symbol] = depth
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths
+}
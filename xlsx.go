@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxWriter streams a single-sheet spreadsheet in the Office Open XML
+// format. Rows go straight into the zip entry of the sheet as they are
+// written, so the sheet is never held in memory.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+// xlsxParts are the fixed parts of a workbook with one sheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+func newXLSXWriter(w io.Writer, sheetName string) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		if err := writeZipEntry(archive, part.name, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName))
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	if err := writeZipEntry(archive, "xl/workbook.xml", workbook); err != nil {
+		return nil, err
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxWriter{zip: archive, sheet: sheet}, nil
+}
+
+// WriteRow appends a row to the sheet. Numbers become number cells and
+// everything else becomes text.
+func (w *xlsxWriter) WriteRow(cells []any) error {
+	w.row++
+	if _, err := fmt.Fprintf(w.sheet, `<row r="%d">`, w.row); err != nil {
+		return err
+	}
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(w.row)
+		var err error
+		switch value := cell.(type) {
+		case int:
+			_, err = fmt.Fprintf(w.sheet, `<c r="%s"><v>%d</v></c>`, ref, value)
+		case float64:
+			_, err = fmt.Fprintf(w.sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(value, 'g', -1, 64))
+		default:
+			_, err = fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err == nil {
+				err = xml.EscapeText(w.sheet, []byte(fmt.Sprint(value)))
+			}
+			if err == nil {
+				_, err = io.WriteString(w.sheet, `</t></is></c>`)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w.sheet, `</row>`)
+	return err
+}
+
+// Close finishes the sheet and the zip archive
+func (w *xlsxWriter) Close() error {
+	if _, err := io.WriteString(w.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// xlsxColumn returns the spreadsheet column letters for a zero-based index
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func writeZipEntry(archive *zip.Writer, name, content string) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(entry, content)
+	return err
+}